@@ -22,11 +22,9 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"os"
 )
 
 var accountsCmd = &cobra.Command{
@@ -39,48 +37,40 @@ message body must contain the JSON email address list.
 `,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		filename := args[0]
-		var err error
-		var file *os.File
+		RunBodyCommand(cmd, args[0])
+	},
+}
 
-		if filename == "" || filename == "-" {
-			file = os.Stdin
-		} else {
-			file, err = os.Open(filename)
-			cobra.CheckErr(err)
-			if !viper.GetBool("no_remove") {
-				defer func() {
-					err := os.Remove(filename)
-					cobra.CheckErr(err)
-				}()
-			}
-			defer file.Close()
-		}
-		filterctl := NewFilterctlClient()
-		decoder := json.NewDecoder(file)
-		users := []string{}
-		err = decoder.Decode(&users)
-		cobra.CheckErr(err)
-		var table APIAccountsResponse
-		table.Accounts = make(map[string]string)
-		table.User = viper.GetString("sender")
-		table.Request = "accounts query"
-		table.Message = "cardDAV user accounts"
-		table.Success = true
-		for _, user := range users {
-			var response APIPasswordResponse
-			path := fmt.Sprintf("/filterctl/passwd/%s/", user)
-			viper.Set("sender", user)
-			_, err := filterctl.Get(path, &response)
-			cobra.CheckErr(err)
-			table.Accounts[response.User] = response.Password
+type accountsCommand struct{}
+
+func (accountsCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	users := []string{}
+	err = json.Unmarshal(rc.Body, &users)
+	if err != nil {
+		return nil, err
+	}
+	var table APIAccountsResponse
+	table.Accounts = make(map[string]string)
+	table.User = rc.Sender
+	table.Request = "accounts query"
+	table.Message = "cardDAV user accounts"
+	table.Success = true
+	for _, user := range users {
+		filterctl.User = user
+		response, err := filterctl.Password(ctx, user)
+		if err != nil {
+			return nil, err
 		}
-		text, err := json.MarshalIndent(&table, "", "  ")
-		cobra.CheckErr(err)
-		fmt.Println(string(text))
-	},
+		table.Accounts[response.User] = response.Password
+	}
+	return &table, nil
 }
 
 func init() {
 	rootCmd.AddCommand(accountsCmd)
+	RegisterBodyCommand(accountsCmd, accountsCommand{})
 }
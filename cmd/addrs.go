@@ -22,10 +22,9 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // mkbookCmd represents the mkbook command
@@ -37,17 +36,22 @@ Return the list of addresses contained by an address book
 `,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		username := viper.GetString("sender")
-		bookname := args[0]
-		filterctl := NewFilterctlClient()
-		var response APIAddressesResponse
-		path := fmt.Sprintf("/filterctl/addresses/%s/%s/", username, bookname)
-		ret, err := filterctl.Get(path, &response)
-		cobra.CheckErr(err)
-		fmt.Printf(ret)
+		RunCommand(cmd, args, nil)
 	},
 }
 
+type addrsCommand struct{}
+
+func (addrsCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	bookname := rc.Args[0]
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	return filterctl.Addresses(ctx, rc.Sender, bookname)
+}
+
 func init() {
 	rootCmd.AddCommand(addrsCmd)
+	RegisterCommand(addrsCmd, addrsCommand{})
 }
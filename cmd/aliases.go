@@ -0,0 +1,240 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/rstms/rspamd-classes/classes"
+)
+
+var ALIAS_SUFFIX_PATTERN = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// ClassScope selects the class table read or changed by a command: the
+// sender's table, or the table of one of the sender's plus-suffix addresses
+type ClassScope struct {
+	Sender string
+	Suffix string
+}
+
+// AliasCommand is implemented by class commands which accept a leading
+// +SUFFIX argument.  The history snapshot of such a command holds the class
+// table of the selected address.
+type AliasCommand interface {
+	ClassScope(rc *RequestContext) (ClassScope, error)
+}
+
+// return the scope selected by a leading +SUFFIX argument, and the
+// remaining arguments
+func parseClassScope(sender string, args []string) (ClassScope, []string, error) {
+	scope := ClassScope{Sender: sender}
+	if len(args) == 0 || !strings.HasPrefix(args[0], "+") {
+		return scope, args, nil
+	}
+	suffix := strings.TrimPrefix(args[0], "+")
+	if !ALIAS_SUFFIX_PATTERN.MatchString(suffix) {
+		return scope, nil, validationResult([]string{fmt.Sprintf("invalid address suffix: '%s'", args[0])})
+	}
+	local, _, found := strings.Cut(sender, "@")
+	if !found || strings.Contains(local, "+") {
+		return scope, nil, validationResult([]string{fmt.Sprintf("cannot add a suffix to sender address '%s'", sender)})
+	}
+	scope.Suffix = suffix
+	return scope, args[1:], nil
+}
+
+// Address returns the email address whose class table the scope selects
+func (s ClassScope) Address() string {
+	if s.Suffix == "" {
+		return s.Sender
+	}
+	local, domain, _ := strings.Cut(s.Sender, "@")
+	return local + "+" + s.Suffix + "@" + domain
+}
+
+// return the sender's alias registry filename
+func aliasesFile(sender string) (string, error) {
+	path, err := userPath("aliases_dir", sender)
+	if err != nil {
+		return "", err
+	}
+	return path + ".json", nil
+}
+
+// ReadAliases returns the sender's address suffixes which have their own
+// class table, sorted.  filterctld creates a default table when a missing
+// table is read, so only these addresses are ever requested.
+func ReadAliases(sender string) ([]string, error) {
+	filename, err := aliasesFile(sender)
+	if err != nil {
+		return nil, err
+	}
+	suffixes := []string{}
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return suffixes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &suffixes)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading aliases %s: %v", filename, err)
+	}
+	slices.Sort(suffixes)
+	return suffixes, nil
+}
+
+// add or remove suffix in the sender's alias registry.  A lock file
+// serializes concurrent updates from the same sender, and the registry is
+// replaced by renaming a complete new file so readers never see a partial
+// write.
+func updateAliases(sender, suffix string, present bool) error {
+	filename, err := aliasesFile(sender)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(filename+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("failed opening alias lock: %v", err)
+	}
+	defer lock.Close()
+	err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		return fmt.Errorf("failed locking aliases: %v", err)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+	suffixes, err := ReadAliases(sender)
+	if err != nil {
+		return err
+	}
+	index, found := slices.BinarySearch(suffixes, suffix)
+	switch {
+	case present && !found:
+		suffixes = slices.Insert(suffixes, index, suffix)
+	case !present && found:
+		suffixes = slices.Delete(suffixes, index, index+1)
+	default:
+		return nil
+	}
+	data, err := json.MarshalIndent(suffixes, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(filename, data)
+}
+
+// write data to a temporary file in the same directory and rename it to
+// filename
+func replaceFile(filename string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed writing %s: %v", filename, err)
+	}
+	return os.Rename(file.Name(), filename)
+}
+
+// return the class table in effect for scope, and whether the scope has its
+// own table.  A suffix without a table uses the sender's table.
+func scopeClasses(ctx context.Context, filterctl *APIClient, scope ClassScope) ([]classes.SpamClass, bool, error) {
+	if scope.Suffix != "" {
+		suffixes, err := ReadAliases(scope.Sender)
+		if err != nil {
+			return nil, false, err
+		}
+		if slices.Contains(suffixes, scope.Suffix) {
+			table, err := currentClasses(ctx, filterctl, scope.Address())
+			return table, true, err
+		}
+	}
+	table, err := currentClasses(ctx, filterctl, scope.Sender)
+	return table, scope.Suffix == "", err
+}
+
+// replace the class table for scope, recording the table of a suffix
+func resetScopeClasses(ctx context.Context, filterctl *APIClient, scope ClassScope, table []classes.SpamClass) (*APIClassesResponse, error) {
+	response, err := filterctl.ResetClasses(ctx, scope.Address(), table)
+	if err != nil {
+		return nil, err
+	}
+	if scope.Suffix != "" {
+		err = updateAliases(scope.Sender, scope.Suffix, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// remove the class table of a suffix so it reverts to the sender's table
+func deleteScopeClasses(ctx context.Context, filterctl *APIClient, scope ClassScope) (*APIResponse, error) {
+	response, err := filterctl.DeleteClasses(ctx, scope.Address())
+	if err != nil {
+		return nil, err
+	}
+	err = updateAliases(scope.Sender, scope.Suffix, false)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// return the class tables of the sender's suffixes, keyed by suffix
+func aliasClasses(ctx context.Context, filterctl *APIClient, sender string) (map[string][]classes.SpamClass, error) {
+	suffixes, err := ReadAliases(sender)
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string][]classes.SpamClass)
+	for _, suffix := range suffixes {
+		scope := ClassScope{Sender: sender, Suffix: suffix}
+		tables[suffix], err = currentClasses(ctx, filterctl, scope.Address())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tables, nil
+}
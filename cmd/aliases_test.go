@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func setAliasesDir(t *testing.T) {
+	viper.Set("aliases_dir", t.TempDir())
+	t.Cleanup(func() { viper.Set("aliases_dir", "") })
+	viper.Set("history_dir", t.TempDir())
+	t.Cleanup(func() { viper.Set("history_dir", "") })
+}
+
+func TestParseClassScope(t *testing.T) {
+	sender := "user@example.com"
+	scope, args, err := parseClassScope(sender, []string{"ham=3"})
+	require.Nil(t, err)
+	require.Equal(t, ClassScope{Sender: sender}, scope)
+	require.Equal(t, []string{"ham=3"}, args)
+	require.Equal(t, sender, scope.Address())
+
+	scope, args, err = parseClassScope(sender, []string{"+lists", "bulk=3"})
+	require.Nil(t, err)
+	require.Equal(t, ClassScope{Sender: sender, Suffix: "lists"}, scope)
+	require.Equal(t, []string{"bulk=3"}, args)
+	require.Equal(t, "user+lists@example.com", scope.Address())
+
+	for _, arg := range []string{"+", "+a/b", "++lists", "+.lists"} {
+		_, _, err = parseClassScope(sender, []string{arg})
+		var invalid *ValidationError
+		require.True(t, errors.As(err, &invalid), arg)
+	}
+	_, _, err = parseClassScope("user+shop@example.com", []string{"+lists"})
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid), err)
+	require.Equal(t, []string{"cannot add a suffix to sender address 'user+shop@example.com'"}, invalid.Violations)
+}
+
+func TestReadAliases(t *testing.T) {
+	setAliasesDir(t)
+	sender := "user@example.com"
+	suffixes, err := ReadAliases(sender)
+	require.Nil(t, err)
+	require.Empty(t, suffixes)
+	require.Nil(t, updateAliases(sender, "shop", true))
+	require.Nil(t, updateAliases(sender, "lists", true))
+	require.Nil(t, updateAliases(sender, "lists", true))
+	suffixes, err = ReadAliases(sender)
+	require.Nil(t, err)
+	require.Equal(t, []string{"lists", "shop"}, suffixes)
+	require.Nil(t, updateAliases(sender, "shop", false))
+	require.Nil(t, updateAliases(sender, "other", false))
+	suffixes, err = ReadAliases(sender)
+	require.Nil(t, err)
+	require.Equal(t, []string{"lists"}, suffixes)
+
+	// concurrent updates are applied in turn
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = updateAliases(sender, fmt.Sprintf("s%d", i), true)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.Nil(t, err)
+	}
+	suffixes, err = ReadAliases(sender)
+	require.Nil(t, err)
+	require.Len(t, suffixes, 11)
+}
+
+func TestAliasClasses(t *testing.T) {
+	configure(t)
+	setAliasesDir(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	alias := "test+lists@mailcapsule.io"
+	server.Filterctld.AddUser(sender, "test-password")
+	ctx := context.Background()
+
+	rc := RequestContext{Sender: sender, Command: "classes", Args: []string{"+lists"}}
+	result, err := classesCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	response := result.(*APIAliasClassesResponse)
+	require.True(t, response.Inherited)
+	require.Equal(t, alias, response.Address)
+	require.Equal(t, classes.DefaultClasses, response.Classes)
+
+	rc = RequestContext{Sender: sender, Command: "set", Args: []string{"+lists", "bulk=3"}}
+	_, err = runWithSnapshot(ctx, setCommand{}, &rc)
+	require.Nil(t, err)
+	expected := []classes.SpamClass{{Name: "bulk", Score: 3}, {Name: "ham", Score: 5}, {Name: "probable", Score: 10}, {Name: "spam", Score: 999}}
+	require.Equal(t, expected, server.Filterctld.Classes(alias))
+	require.Equal(t, classes.DefaultClasses, server.Filterctld.Classes(sender))
+
+	rc = RequestContext{Sender: sender, Command: "classes", Args: []string{"+lists"}}
+	result, err = classesCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	require.False(t, result.(*APIAliasClassesResponse).Inherited)
+
+	rc = RequestContext{Sender: sender, Command: "dump"}
+	result, err = dumpCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	dump := result.(*APIUserDumpResponse)
+	require.Equal(t, map[string][]classes.SpamClass{"lists": expected}, dump.Aliases)
+
+	// undo the set, which removes the table created for the suffix
+	rc = RequestContext{Sender: sender, Command: "undo"}
+	_, err = runWithSnapshot(ctx, undoCommand{}, &rc)
+	require.Nil(t, err)
+	suffixes, err := ReadAliases(sender)
+	require.Nil(t, err)
+	require.Empty(t, suffixes)
+
+	// undo the undo, which restores the suffix table
+	rc = RequestContext{Sender: sender, Command: "undo"}
+	_, err = runWithSnapshot(ctx, undoCommand{}, &rc)
+	require.Nil(t, err)
+	require.Equal(t, expected, server.Filterctld.Classes(alias))
+
+	rc = RequestContext{Sender: sender, Command: "reset", Args: []string{"+lists"}}
+	result, err = resetCommand{}.DryRun(ctx, &rc)
+	require.Nil(t, err)
+	require.Equal(t, []ClassChange{{Class: "bulk", Action: "delete", Old: score(3)}}, result.(*APIDryRunResponse).Classes)
+	_, err = resetCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	suffixes, err = ReadAliases(sender)
+	require.Nil(t, err)
+	require.Empty(t, suffixes)
+
+	// restore the dumped alias table
+	body, err := json.Marshal(map[string]any{"Aliases": dump.Aliases})
+	require.Nil(t, err)
+	rc = RequestContext{Sender: sender, Command: "restore", Body: body}
+	result, err = restoreCommand{}.DryRun(ctx, &rc)
+	require.Nil(t, err)
+	require.Equal(t, map[string][]ClassChange{"lists": {{Class: "bulk", Action: "add", New: score(3)}}}, result.(*APIRestoreDryRunResponse).Aliases)
+	_, err = restoreCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	require.Equal(t, expected, server.Filterctld.Classes(alias))
+	suffixes, err = ReadAliases(sender)
+	require.Nil(t, err)
+	require.Equal(t, []string{"lists"}, suffixes)
+
+	rc = RequestContext{Sender: sender, Command: "restore", Body: []byte(`{"Aliases": {"shop": [{"name": "ham", "score": 5}]}}`)}
+	_, err = restoreCommand{}.Run(ctx, &rc)
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid))
+	require.Contains(t, invalid.Violations[0], "alias '+shop': ")
+}
+
+func TestRestoreUndoAliases(t *testing.T) {
+	configure(t)
+	setAliasesDir(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	server.Filterctld.AddUser(sender, "test-password")
+	ctx := context.Background()
+
+	rc := RequestContext{Sender: sender, Command: "set", Args: []string{"+lists", "bulk=3"}}
+	_, err := runWithSnapshot(ctx, setCommand{}, &rc)
+	require.Nil(t, err)
+	lists := server.Filterctld.Classes("test+lists@mailcapsule.io")
+
+	body := []byte(`{"Aliases": {
+		"lists": [{"name": "ham", "score": 4}, {"name": "spam", "score": 999}],
+		"shop": [{"name": "ham", "score": 2}, {"name": "spam", "score": 999}]
+	}}`)
+	rc = RequestContext{Sender: sender, Command: "restore", Body: body}
+	_, err = runWithSnapshot(ctx, restoreCommand{}, &rc)
+	require.Nil(t, err)
+	require.Equal(t, []classes.SpamClass{{Name: "ham", Score: 2}, {Name: "spam", Score: 999}}, server.Filterctld.Classes("test+shop@mailcapsule.io"))
+	suffixes, err := ReadAliases(sender)
+	require.Nil(t, err)
+	require.Equal(t, []string{"lists", "shop"}, suffixes)
+
+	rc = RequestContext{Sender: sender, Command: "undo"}
+	result, err := undoCommand{}.DryRun(ctx, &rc)
+	require.Nil(t, err)
+	preview := result.(*APIRestoreDryRunResponse)
+	require.Contains(t, preview.Aliases, "lists")
+	require.Contains(t, preview.Aliases, "shop")
+
+	// undo reverts the restored table and removes the table the restore created
+	result, err = runWithSnapshot(ctx, undoCommand{}, &rc)
+	require.Nil(t, err)
+	require.Contains(t, result.(*APIUndoResponse).Aliases, "lists")
+	require.Equal(t, lists, server.Filterctld.Classes("test+lists@mailcapsule.io"))
+	suffixes, err = ReadAliases(sender)
+	require.Nil(t, err)
+	require.Equal(t, []string{"lists"}, suffixes)
+
+	// undoing the undo restores both tables again
+	rc = RequestContext{Sender: sender, Command: "undo"}
+	_, err = runWithSnapshot(ctx, undoCommand{}, &rc)
+	require.Nil(t, err)
+	require.Equal(t, []classes.SpamClass{{Name: "ham", Score: 4}, {Name: "spam", Score: 999}}, server.Filterctld.Classes("test+lists@mailcapsule.io"))
+	suffixes, err = ReadAliases(sender)
+	require.Nil(t, err)
+	require.Equal(t, []string{"lists", "shop"}, suffixes)
+}
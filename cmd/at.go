@@ -0,0 +1,87 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// atCmd represents the at command
+var atCmd = &cobra.Command{
+	Use:   "at WHEN COMMAND [ARG ...]",
+	Short: "run a command later",
+	Long: `
+Schedule COMMAND to run once at the time specified by WHEN.  The response
+is sent when the command runs.  WHEN may be an interval from now, such as
+'90m', '12h', '7d' or '2w', a time of day as HH:MM, a day such as 'tomorrow'
+or 'monday' optionally followed by '@HH:MM', or a date as YYYY-MM-DD
+optionally followed by '@HH:MM'.
+For example: 'at friday@18:00 reset --dry-run ham=2 spam=999'.
+`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		RunCommand(cmd, args, nil)
+	},
+}
+
+type atCommand struct{}
+
+// return the job requested by the at command arguments
+func planAt(rc *RequestContext) (*Job, error) {
+	next, err := ParseWhen(rc.Args[0], time.Now())
+	if err != nil {
+		return nil, validationResult([]string{err.Error()})
+	}
+	return NewJob(rc, "", next, rc.Args[1:])
+}
+
+func (atCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	job, err := planAt(rc)
+	if err != nil {
+		return nil, err
+	}
+	err = AddJob(job)
+	if err != nil {
+		return nil, err
+	}
+	return newJobResponse(rc, job, "scheduled job "+job.ID), nil
+}
+
+func (atCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	job, err := planAt(rc)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAddJob(job)
+	if err != nil {
+		return nil, err
+	}
+	return newJobDryRunResponse(rc, job, "dry run: would schedule job "+job.ID), nil
+}
+
+func init() {
+	rootCmd.AddCommand(atCmd)
+	RegisterNestedCommand(atCmd, atCommand{})
+}
@@ -0,0 +1,223 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var SECRET_PATTERN = regexp.MustCompile(`(?i)(pass|secret|token|key)`)
+
+const REDACTED = "[REDACTED]"
+
+type AuditRecord struct {
+	Time         time.Time
+	Sender       string
+	RequestID    string
+	Command      string
+	Args         []string
+	Authorized   bool
+	Reason       string `json:",omitempty"`
+	Status       string
+	HTTPStatus   int `json:",omitempty"`
+	ResponseSize int
+	Error        string `json:",omitempty"`
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "query the audit log",
+	Long: `
+Output the audit log records matching the selection flags as JSON lines.
+With no flags, all records are output.  SINCE and UNTIL are RFC3339
+timestamps or durations relative to the current time, such as '24h'.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		since, err := parseAuditTime(viper.GetString("audit_since"))
+		cobra.CheckErr(err)
+		until, err := parseAuditTime(viper.GetString("audit_until"))
+		cobra.CheckErr(err)
+		filter := func(record *AuditRecord) bool {
+			if sender := viper.GetString("audit_sender"); sender != "" && record.Sender != sender {
+				return false
+			}
+			if command := viper.GetString("audit_command"); command != "" && record.Command != command {
+				return false
+			}
+			if !since.IsZero() && record.Time.Before(since) {
+				return false
+			}
+			if !until.IsZero() && record.Time.After(until) {
+				return false
+			}
+			return true
+		}
+		records, err := ReadAudit(viper.GetString("audit_file"), filter)
+		cobra.CheckErr(err)
+		for _, record := range records {
+			line, err := json.Marshal(record)
+			cobra.CheckErr(err)
+			fmt.Println(string(line))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.Flags().String("select-sender", "", "select records by sender address")
+	viper.BindPFlag("audit_sender", auditCmd.Flags().Lookup("select-sender"))
+	auditCmd.Flags().String("select-command", "", "select records by command")
+	viper.BindPFlag("audit_command", auditCmd.Flags().Lookup("select-command"))
+	auditCmd.Flags().String("since", "", "select records at or after SINCE")
+	viper.BindPFlag("audit_since", auditCmd.Flags().Lookup("since"))
+	auditCmd.Flags().String("until", "", "select records at or before UNTIL")
+	viper.BindPFlag("audit_until", auditCmd.Flags().Lookup("until"))
+}
+
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time '%s': expected RFC3339 or duration", value)
+	}
+	return timestamp, nil
+}
+
+// replace the values of secret-bearing options and KEY=VALUE arguments
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	hidden := false
+	for i, arg := range args {
+		switch {
+		case hidden:
+			redacted[i] = REDACTED
+			hidden = false
+		case strings.Contains(arg, "="):
+			key, _, _ := strings.Cut(arg, "=")
+			if SECRET_PATTERN.MatchString(key) {
+				redacted[i] = key + "=" + REDACTED
+			} else {
+				redacted[i] = arg
+			}
+		case strings.HasPrefix(arg, "-") && SECRET_PATTERN.MatchString(arg):
+			redacted[i] = arg
+			hidden = true
+		default:
+			redacted[i] = arg
+		}
+	}
+	return redacted
+}
+
+// WriteAudit appends a record to the audit log.  An exclusive lock
+// serializes writers from concurrent filterctl processes.
+func WriteAudit(record AuditRecord) error {
+	filename := viper.GetString("audit_file")
+	if filename == "" {
+		return nil
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	record.Args = redactArgs(record.Args)
+	line, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0660)
+	if err != nil {
+		return fmt.Errorf("failed opening audit log: %v", err)
+	}
+	defer file.Close()
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		return fmt.Errorf("failed locking audit log: %v", err)
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed writing audit log: %v", err)
+	}
+	err = file.Sync()
+	if err != nil {
+		return fmt.Errorf("failed syncing audit log: %v", err)
+	}
+	return nil
+}
+
+// write an audit record, logging any failure without interrupting the request
+func audit(record AuditRecord) {
+	err := WriteAudit(record)
+	if err != nil {
+		log.Printf("WARNING: %v\n", err)
+	}
+}
+
+// ReadAudit returns the audit log records accepted by filter
+func ReadAudit(filename string, filter func(*AuditRecord) bool) ([]AuditRecord, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening audit log: %v", err)
+	}
+	defer file.Close()
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_SH)
+	if err != nil {
+		return nil, fmt.Errorf("failed locking audit log: %v", err)
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	records := []AuditRecord{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record AuditRecord
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", filename, line, err)
+		}
+		if filter == nil || filter(&record) {
+			records = append(records, record)
+		}
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
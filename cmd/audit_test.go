@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedactArgs(t *testing.T) {
+	args := redactArgs([]string{"friends", "--api-key", "s3cr3t", "password=hunter2", "ham=5"})
+	require.Equal(t, []string{"friends", "--api-key", REDACTED, "password=" + REDACTED, "ham=5"}, args)
+}
+
+func TestAuditLog(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit")
+	viper.Set("audit_file", filename)
+	defer viper.Set("audit_file", "")
+	require.Nil(t, WriteAudit(AuditRecord{Sender: "a@example.org", Command: "classes", Authorized: true, Status: "success"}))
+	require.Nil(t, WriteAudit(AuditRecord{Sender: "b@example.org", Command: "reset", Args: []string{"token=x"}, Authorized: true, Status: "success"}))
+	require.Nil(t, WriteAudit(AuditRecord{Sender: "b@example.org", Command: "help", Authorized: false, Reason: "missing DKIM signature", Status: "rejected"}))
+	records, err := ReadAudit(filename, nil)
+	require.Nil(t, err)
+	require.Len(t, records, 3)
+	require.False(t, records[0].Time.IsZero())
+	require.Equal(t, []string{"token=" + REDACTED}, records[1].Args)
+	records, err = ReadAudit(filename, func(r *AuditRecord) bool { return r.Sender == "b@example.org" && r.Authorized })
+	require.Nil(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, "reset", records[0].Command)
+}
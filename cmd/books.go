@@ -22,11 +22,9 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"context"
 
-	"github.com/rstms/mabctl/api"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // booksCmd represents the books command
@@ -37,15 +35,21 @@ var booksCmd = &cobra.Command{
 Return a list of the sender's address books.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		filterctl := NewFilterctlClient()
-		path := fmt.Sprintf("/filterctl/books/%s/", viper.GetString("sender"))
-		var response api.BooksResponse
-		ret, err := filterctl.Get(path, &response)
-		cobra.CheckErr(err)
-		fmt.Println(ret)
+		RunCommand(cmd, args, nil)
 	},
 }
 
+type booksCommand struct{}
+
+func (booksCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	return filterctl.Books(ctx, rc.Sender)
+}
+
 func init() {
 	rootCmd.AddCommand(booksCmd)
+	RegisterCommand(booksCmd, booksCommand{})
 }
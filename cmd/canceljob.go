@@ -0,0 +1,91 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// canceljobCmd represents the canceljob command
+var canceljobCmd = &cobra.Command{
+	Use:   "canceljob ID",
+	Short: "cancel a scheduled command",
+	Long: `
+Remove the job matching ID from the sender's scheduled commands.  Use the
+jobs command to list the scheduled job IDs.
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		RunCommand(cmd, args, nil)
+	},
+}
+
+type canceljobCommand struct{}
+
+func (canceljobCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	id := rc.Args[0]
+	var cancelled *Job
+	err := UpdateJobs(rc.Sender, func(jobs []*Job) ([]*Job, error) {
+		remaining := []*Job{}
+		for _, job := range jobs {
+			if job.ID == id {
+				cancelled = job
+			} else {
+				remaining = append(remaining, job)
+			}
+		}
+		if cancelled == nil {
+			return nil, jobNotFound(id)
+		}
+		return remaining, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newJobResponse(rc, cancelled, "cancelled job "+id), nil
+}
+
+func (canceljobCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	id := rc.Args[0]
+	jobs, err := ReadJobs(rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.ID == id {
+			return newJobDryRunResponse(rc, job, "dry run: would cancel job "+id), nil
+		}
+	}
+	return nil, jobNotFound(id)
+}
+
+func jobNotFound(id string) error {
+	return validationResult([]string{fmt.Sprintf("job not found: %s", id)})
+}
+
+func init() {
+	rootCmd.AddCommand(canceljobCmd)
+	RegisterCommand(canceljobCmd, canceljobCommand{})
+}
@@ -0,0 +1,101 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/rstms/filterctl/pkg/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// certsCmd represents the certs command
+var certsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "check client certificates",
+	Long: `
+Report the subject, issuer, names and validity of the configured client
+certificate and certificate authority, whether the key matches the client
+certificate, and whether the client certificate chains to the CA.
+
+A warning is listed for each certificate expiring within --warn-before.  If
+--admin is set, any warnings or errors are also mailed to that address, so
+this command may be run daily by cron:
+
+    0 6 * * * /usr/local/bin/filterctl certs --admin postmaster@example.com
+
+The command exits non-zero if the certificates are unusable.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := certConfig()
+		cobra.CheckErr(err)
+		now := time.Now()
+		report := APICertsReport{CertReport: client.CheckCertificates(config, now)}
+		report.Warnings = report.Expiring(now, viper.GetDuration("certs.warn_before"))
+		text, err := json.MarshalIndent(&report, "", "  ")
+		cobra.CheckErr(err)
+		fmt.Println(string(text))
+		for _, warning := range report.Warnings {
+			log.Printf("WARNING: %s\n", warning)
+		}
+		admin := viper.GetString("certs.admin")
+		if admin != "" && (len(report.Warnings) > 0 || len(report.Errors) > 0) {
+			cobra.CheckErr(mailCertReport(cmd, admin, text))
+		}
+		if len(report.Errors) > 0 {
+			cobra.CheckErr(errors.New(strings.Join(report.Errors, "; ")))
+		}
+	},
+}
+
+type APICertsReport struct {
+	*client.CertReport
+	Warnings []string
+}
+
+func mailCertReport(cmd *cobra.Command, admin string, report []byte) error {
+	subject := fmt.Sprintf("filterctl certificate warning for %s", Hostname)
+	message, err := formatEmailMessage(fmt.Sprintf("certs.%d@%s", time.Now().Unix(), Hostname), subject, admin, "filterctl@"+Domains[0], report)
+	if err != nil {
+		return err
+	}
+	if viper.GetBool("disable_response") {
+		fmt.Println(string(message))
+		return nil
+	}
+	return sendMail(cmd.Context(), admin, message)
+}
+
+func init() {
+	rootCmd.AddCommand(certsCmd)
+	certsCmd.Flags().Duration("warn-before", 30*24*time.Hour, "warn of certificates expiring within this duration")
+	viper.BindPFlag("certs.warn_before", certsCmd.Flags().Lookup("warn-before"))
+	certsCmd.Flags().String("admin", "", "mail warnings to this address")
+	viper.BindPFlag("certs.admin", certsCmd.Flags().Lookup("admin"))
+}
@@ -22,29 +22,69 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var classesCmd = &cobra.Command{
-	Use:   "classes",
+	Use:   "classes [+SUFFIX]",
 	Short: "list rspamd classes",
 	Long: `
 Return the complete set of rspamd class names and threshold values for the
-sender address.
+sender address.  With a +SUFFIX argument, return the classes used for mail
+addressed to the sender's plus-suffix address, such as 'classes +lists'.
+A suffix without its own class table uses the sender's classes.
 `,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		filterctl := NewFilterctlClient()
-		var data APIClassesResponse
-		path := fmt.Sprintf("/filterctl/classes/%s/", viper.GetString("sender"))
-		response, err := filterctl.Get(path, &data)
-		cobra.CheckErr(err)
-		fmt.Println(response)
+		RunCommand(cmd, args, nil)
 	},
 }
 
+type APIAliasClassesResponse struct {
+	APIClassesResponse
+	Address   string
+	Inherited bool
+}
+
+type classesCommand struct{}
+
+func (classesCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	scope, args, err := parseClassScope(rc.Sender, rc.Args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 0 {
+		return nil, validationResult([]string{fmt.Sprintf("unexpected argument '%s'; expected +SUFFIX", args[0])})
+	}
+	if scope.Suffix == "" {
+		return filterctl.Classes(ctx, rc.Sender)
+	}
+	table, own, err := scopeClasses(ctx, filterctl, scope)
+	if err != nil {
+		return nil, err
+	}
+	var response APIAliasClassesResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s classes", scope.Address())
+	if !own {
+		response.Message = fmt.Sprintf("%s classes: no table for +%s; using the classes of %s", rc.Sender, scope.Suffix, rc.Sender)
+	}
+	response.Classes = table
+	response.Address = scope.Address()
+	response.Inherited = !own
+	return &response, nil
+}
+
 func init() {
 	rootCmd.AddCommand(classesCmd)
+	RegisterCommand(classesCmd, classesCommand{})
 }
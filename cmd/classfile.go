@@ -0,0 +1,227 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"gopkg.in/yaml.v3"
+)
+
+const YAML_FORMAT = "yaml"
+const CSV_FORMAT = "csv"
+const JSON_FORMAT = "json"
+
+var CLASS_FILE_FORMATS = []string{YAML_FORMAT, CSV_FORMAT, JSON_FORMAT}
+
+var CLASS_FILE_CONTENT_TYPES = map[string]string{
+	YAML_FORMAT: "application/yaml",
+	CSV_FORMAT:  "text/csv",
+	JSON_FORMAT: "application/json",
+}
+
+// the heading row of a CSV class file
+var CSV_HEADING = []string{"class", "threshold"}
+
+// return the content of a class file in format.  A YAML file maps each class
+// name to its threshold, a CSV file has a class and threshold on each row,
+// and a JSON file is a list of objects with 'name' and 'score' values.
+func formatClassFile(table []classes.SpamClass, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case YAML_FORMAT:
+		for _, class := range table {
+			fmt.Fprintf(&buf, "%s: %s\n", class.Name, formatThreshold(class.Score))
+		}
+	case CSV_FORMAT:
+		w := csv.NewWriter(&buf)
+		w.Write(CSV_HEADING)
+		for _, class := range table {
+			w.Write([]string{class.Name, formatThreshold(class.Score)})
+		}
+		w.Flush()
+		if w.Error() != nil {
+			return nil, w.Error()
+		}
+	case JSON_FORMAT:
+		data, err := json.MarshalIndent(table, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		buf.WriteString("\n")
+	default:
+		return nil, fmt.Errorf("unknown class file format: '%s'", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// return the format of a class file, from the filename extension if it has
+// one, or from the content
+func classFileFormat(filename string, content []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return YAML_FORMAT
+	case ".csv":
+		return CSV_FORMAT
+	case ".json":
+		return JSON_FORMAT
+	}
+	text := strings.TrimSpace(string(content))
+	firstLine, _, _ := strings.Cut(text, "\n")
+	switch {
+	case strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{"):
+		return JSON_FORMAT
+	case strings.Contains(firstLine, ":"):
+		return YAML_FORMAT
+	}
+	return CSV_FORMAT
+}
+
+// parse a class file, reporting every invalid entry.  The resulting table
+// is not checked against the class table rules.
+func parseClassFile(filename string, content []byte) ([]classes.SpamClass, error) {
+	var table []classes.SpamClass
+	var violations []string
+	switch classFileFormat(filename, content) {
+	case YAML_FORMAT:
+		table, violations = parseYAMLClasses(content)
+	case CSV_FORMAT:
+		table, violations = parseCSVClasses(content)
+	default:
+		table, violations = parseJSONClasses(content)
+	}
+	if len(violations) == 0 && len(table) == 0 {
+		violations = append(violations, "no classes found in file")
+	}
+	return table, validationResult(violations)
+}
+
+// append the class to table if name and threshold are valid
+func parseClassEntry(table []classes.SpamClass, violations []string, location, name, threshold string) ([]classes.SpamClass, []string) {
+	name = strings.TrimSpace(name)
+	if !CLASS_NAME_PATTERN.MatchString(name) {
+		return table, append(violations, fmt.Sprintf("%s: invalid class name '%s'", location, name))
+	}
+	score, err := strconv.ParseFloat(strings.TrimSpace(threshold), 32)
+	if err != nil || math.IsNaN(score) || math.IsInf(score, 0) {
+		return table, append(violations, fmt.Sprintf("%s: invalid threshold '%s' for class '%s'", location, threshold, name))
+	}
+	return append(table, classes.SpamClass{Name: name, Score: float32(score)}), violations
+}
+
+func parseYAMLClasses(content []byte) ([]classes.SpamClass, []string) {
+	var document yaml.Node
+	err := yaml.Unmarshal(content, &document)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("failed parsing YAML: %v", err)}
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, []string{"YAML file must map class names to thresholds"}
+	}
+	mapping := document.Content[0].Content
+	table := []classes.SpamClass{}
+	violations := []string{}
+	for i := 0; i+1 < len(mapping); i += 2 {
+		key, value := mapping[i], mapping[i+1]
+		location := fmt.Sprintf("line %d", key.Line)
+		if value.Kind != yaml.ScalarNode {
+			violations = append(violations, fmt.Sprintf("%s: invalid threshold for class '%s'", location, key.Value))
+			continue
+		}
+		table, violations = parseClassEntry(table, violations, location, key.Value, value.Value)
+	}
+	return table, violations
+}
+
+func parseCSVClasses(content []byte) ([]classes.SpamClass, []string) {
+	r := csv.NewReader(bytes.NewReader(content))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	table := []classes.SpamClass{}
+	violations := []string{}
+	for row := 1; ; row++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, []string{fmt.Sprintf("failed parsing CSV: %v", err)}
+		}
+		location := fmt.Sprintf("row %d", row)
+		if row == 1 && len(record) == 2 && strings.EqualFold(strings.TrimSpace(record[0]), CSV_HEADING[0]) {
+			continue
+		}
+		if len(record) != 2 {
+			violations = append(violations, fmt.Sprintf("%s: expected 2 fields, found %d", location, len(record)))
+			continue
+		}
+		table, violations = parseClassEntry(table, violations, location, record[0], record[1])
+	}
+	return table, violations
+}
+
+// parse a JSON class list, or an object with a Classes list such as the
+// classes command response
+func parseJSONClasses(content []byte) ([]classes.SpamClass, []string) {
+	if strings.HasPrefix(strings.TrimSpace(string(content)), "{") {
+		var response struct {
+			Classes json.RawMessage
+		}
+		err := json.Unmarshal(content, &response)
+		if err != nil {
+			return nil, []string{fmt.Sprintf("failed parsing JSON: %v", err)}
+		}
+		if response.Classes == nil {
+			return nil, []string{"JSON object must have a 'Classes' list"}
+		}
+		content = response.Classes
+	}
+	var entries []struct {
+		Name  *string  `json:"name"`
+		Score *float32 `json:"score"`
+	}
+	err := json.Unmarshal(content, &entries)
+	if err != nil {
+		return nil, []string{fmt.Sprintf("failed parsing JSON: %v", err)}
+	}
+	table := []classes.SpamClass{}
+	violations := []string{}
+	for i, entry := range entries {
+		location := fmt.Sprintf("entry %d", i+1)
+		if entry.Name == nil || entry.Score == nil {
+			violations = append(violations, fmt.Sprintf("%s: expected 'name' and 'score' values", location))
+			continue
+		}
+		table, violations = parseClassEntry(table, violations, location, *entry.Name, formatThreshold(*entry.Score))
+	}
+	return table, violations
+}
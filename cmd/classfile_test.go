@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassFileRoundTrip(t *testing.T) {
+	table := []classes.SpamClass{{Name: "ham", Score: -1.5}, {Name: "bulk", Score: 7.25}, {Name: "spam", Score: 999}}
+	for _, format := range CLASS_FILE_FORMATS {
+		content, err := formatClassFile(table, format)
+		require.Nil(t, err, format)
+		require.Equal(t, format, classFileFormat("", content), format)
+		parsed, err := parseClassFile("classes."+format, content)
+		require.Nil(t, err, format)
+		require.Equal(t, table, parsed, format)
+	}
+	content, err := formatClassFile(table, YAML_FORMAT)
+	require.Nil(t, err)
+	require.Equal(t, "ham: -1.5\nbulk: 7.25\nspam: 999\n", string(content))
+	_, err = formatClassFile(table, "xml")
+	require.ErrorContains(t, err, "unknown class file format")
+}
+
+func TestClassFileFormat(t *testing.T) {
+	require.Equal(t, YAML_FORMAT, classFileFormat("Classes.YML", []byte("ham,5")))
+	require.Equal(t, CSV_FORMAT, classFileFormat("", []byte("ham,5\nspam,999\n")))
+	require.Equal(t, YAML_FORMAT, classFileFormat("", []byte("\nham: 5\n")))
+	require.Equal(t, JSON_FORMAT, classFileFormat("notes.txt", []byte(` [{"name": "ham", "score": 5}]`)))
+}
+
+func TestParseClassFileViolations(t *testing.T) {
+	cases := []struct {
+		Filename   string
+		Content    string
+		Violations []string
+	}{
+		{"a.yaml", "ham: five\n1bad: 3\nspam: 999\n", []string{"line 1: invalid threshold 'five' for class 'ham'", "line 2: invalid class name '1bad'"}},
+		{"a.yaml", "- ham\n- spam\n", []string{"YAML file must map class names to thresholds"}},
+		{"a.csv", "class,threshold\nham,5,x\nspam,\n", []string{"row 2: expected 2 fields, found 3", "row 3: invalid threshold '' for class 'spam'"}},
+		{"a.csv", "ham,nan\nbulk,inf\nspam,999\n", []string{"row 1: invalid threshold 'nan' for class 'ham'", "row 2: invalid threshold 'inf' for class 'bulk'"}},
+		{"a.yaml", "ham: NaN\nspam: 1e400\n", []string{"line 1: invalid threshold 'NaN' for class 'ham'", "line 2: invalid threshold '1e400' for class 'spam'"}},
+		{"a.json", `[{"name": "ham"}]`, []string{"entry 1: expected 'name' and 'score' values"}},
+		{"a.csv", "class,threshold\n", []string{"no classes found in file"}},
+		{"a.json", `{"User": "test@mailcapsule.io"}`, []string{"JSON object must have a 'Classes' list"}},
+	}
+	for _, c := range cases {
+		_, err := parseClassFile(c.Filename, []byte(c.Content))
+		var invalid *ValidationError
+		require.True(t, errors.As(err, &invalid), c.Content)
+		require.Equal(t, c.Violations, invalid.Violations, c.Content)
+	}
+}
+
+func TestParseClassFileClassesResponse(t *testing.T) {
+	response := APIClassesResponse{Classes: []classes.SpamClass{{Name: "ham", Score: 4}, {Name: "spam", Score: 999}}}
+	response.User = "test@mailcapsule.io"
+	response.Success = true
+	content, err := json.MarshalIndent(&response, "", "  ")
+	require.Nil(t, err)
+	table, err := parseClassFile("classes.json", content)
+	require.Nil(t, err)
+	require.Equal(t, response.Classes, table)
+}
@@ -22,31 +22,196 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rstms/rspamd-classes/classes"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
+const CLASSIFY_LIMIT = 1000
+const CHART_WIDTH = 40
+
+// the address under which newClassifier stores its table
+const CLASSIFIER_ADDRESS = "classify"
+
+var SCORE_RANGE_PATTERN = regexp.MustCompile(`^(-?[0-9.]+)\.\.(-?[0-9.]+)(?:/([0-9.]+))?$`)
+
 // classifyCmd represents the classify command
 var classifyCmd = &cobra.Command{
-	Use:   "classify SCORE",
-	Short: "lookup class for score",
+	Use:   "classify SCORE|LOW..HIGH[/STEP] ...",
+	Short: "lookup class for scores",
 	Long: `
 Lookup SCORE in the sender's spam class table, returning the resulting CLASS.
+Several scores may be given, and LOW..HIGH/STEP selects every STEP from LOW
+to HIGH; STEP defaults to 1.  For example: 'classify -5..15/0.5'
+When more than one score is requested, the response lists the class for
+each score and a chart of the score bands assigned to each class.
 `,
-	Args: cobra.ExactArgs(1),
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		filterctl := NewFilterctlClient()
-		score := args[0]
-		path := fmt.Sprintf("/filterctl/class/%s/%s/", viper.GetString("sender"), score)
-		var response APIResponse
-		text, err := filterctl.Get(path, &response)
-		cobra.CheckErr(err)
-		fmt.Println(text)
+		RunCommand(cmd, args, nil)
 	},
 }
 
+type ScoreClass struct {
+	Score float32
+	Class string
+}
+
+// ClassBand is the part of the requested score span assigned to Class,
+// from Min up to Max.  Max itself belongs to the following band, if any.
+type ClassBand struct {
+	Class string
+	Min   float32
+	Max   float32
+}
+
+type APIClassifyResponse struct {
+	APIResponse
+	Classes []ScoreClass
+	Bands   []ClassBand
+	Chart   []string
+}
+
+type classifyCommand struct{}
+
+func (classifyCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	scores, err := parseScores(rc.Args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rc.Args) == 1 && len(scores) == 1 {
+		return filterctl.Classify(ctx, rc.Sender, scores[0])
+	}
+	table, err := currentClasses(ctx, filterctl, rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	classify := newClassifier(table)
+	var response APIClassifyResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s classify: %d scores", rc.Sender, len(scores))
+	response.Classes = []ScoreClass{}
+	for _, score := range scores {
+		response.Classes = append(response.Classes, ScoreClass{Score: score, Class: classify(score)})
+	}
+	response.Bands = classBands(table, slices.Min(scores), slices.Max(scores))
+	response.Chart = formatBands(response.Bands)
+	return &response, nil
+}
+
+// return the scores selected by the classify arguments
+func parseScores(args []string) ([]float32, error) {
+	scores := []float32{}
+	violations := []string{}
+	for _, arg := range args {
+		matches := SCORE_RANGE_PATTERN.FindStringSubmatch(arg)
+		if matches == nil {
+			score, err := strconv.ParseFloat(arg, 32)
+			if err != nil || math.IsNaN(score) || math.IsInf(score, 0) {
+				violations = append(violations, fmt.Sprintf("invalid score: '%s'", arg))
+				continue
+			}
+			scores = append(scores, float32(score))
+			continue
+		}
+		low, lowErr := strconv.ParseFloat(matches[1], 64)
+		high, highErr := strconv.ParseFloat(matches[2], 64)
+		step := 1.0
+		var stepErr error
+		if matches[3] != "" {
+			step, stepErr = strconv.ParseFloat(matches[3], 64)
+		}
+		switch {
+		case lowErr != nil || highErr != nil || stepErr != nil:
+			violations = append(violations, fmt.Sprintf("invalid score range: '%s'", arg))
+		case high < low:
+			violations = append(violations, fmt.Sprintf("score range '%s' ends below its start", arg))
+		case step <= 0:
+			violations = append(violations, fmt.Sprintf("score range '%s' step must be greater than 0", arg))
+		case (high-low)/step >= CLASSIFY_LIMIT:
+			violations = append(violations, fmt.Sprintf("score range '%s' exceeds the limit of %d scores", arg, CLASSIFY_LIMIT))
+		default:
+			// compute each score from the start to avoid accumulating
+			// rounding error, allowing for error in the last step
+			count := int(math.Floor((high-low)/step+1e-9)) + 1
+			for i := 0; i < count; i++ {
+				scores = append(scores, float32(low+float64(i)*step))
+			}
+		}
+	}
+	if len(violations) == 0 && len(scores) > CLASSIFY_LIMIT {
+		violations = append(violations, fmt.Sprintf("%d scores exceeds the limit of %d", len(scores), CLASSIFY_LIMIT))
+	}
+	if len(violations) > 0 {
+		return nil, validationResult(violations)
+	}
+	return scores, nil
+}
+
+// return a function which classifies scores using the rspamd-classes
+// library with table as the class table
+func newClassifier(table []classes.SpamClass) func(float32) string {
+	// New fails only when reading a classes file
+	spamClasses, _ := classes.New("")
+	spamClasses.SetClasses(CLASSIFIER_ADDRESS, table)
+	addresses := []string{CLASSIFIER_ADDRESS}
+	return func(score float32) string {
+		return spamClasses.GetClass(addresses, score)
+	}
+}
+
+// return the bands of scores from low to high assigned to each class
+func classBands(table []classes.SpamClass, low, high float32) []ClassBand {
+	classify := newClassifier(table)
+	bands := []ClassBand{{Class: classify(low), Min: low, Max: high}}
+	for _, class := range normalizeClasses(table) {
+		if class.Score <= low || class.Score > high {
+			continue
+		}
+		last := &bands[len(bands)-1]
+		name := classify(class.Score)
+		if name == last.Class {
+			continue
+		}
+		last.Max = class.Score
+		bands = append(bands, ClassBand{Class: name, Min: class.Score, Max: high})
+	}
+	return bands
+}
+
+// return text lines charting the width of each band
+func formatBands(bands []ClassBand) []string {
+	span := bands[len(bands)-1].Max - bands[0].Min
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	for _, band := range bands {
+		width := 1
+		if span > 0 {
+			width = max(1, int(math.Round(float64((band.Max-band.Min)/span*CHART_WIDTH))))
+		}
+		fmt.Fprintf(w, "%s to %s\t%s\t%s\n", formatThreshold(band.Min), formatThreshold(band.Max), band.Class, strings.Repeat("#", width))
+	}
+	w.Flush()
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+}
+
 func init() {
 	rootCmd.AddCommand(classifyCmd)
+	RegisterCommand(classifyCmd, classifyCommand{})
 }
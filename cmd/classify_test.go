@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClassifier(t *testing.T) {
+	classify := newClassifier(classes.DefaultClasses)
+	require.Equal(t, "ham", classify(-20))
+	require.Equal(t, "ham", classify(4.9))
+	require.Equal(t, "probable", classify(5))
+	require.Equal(t, "spam", classify(10))
+	require.Equal(t, "spam", classify(1000))
+}
+
+func TestParseScores(t *testing.T) {
+	scores, err := parseScores([]string{"3", "-1.5"})
+	require.Nil(t, err)
+	require.Equal(t, []float32{3, -1.5}, scores)
+
+	scores, err = parseScores([]string{"-1..2"})
+	require.Nil(t, err)
+	require.Equal(t, []float32{-1, 0, 1, 2}, scores)
+
+	scores, err = parseScores([]string{"0..0.3/0.1", "7"})
+	require.Nil(t, err)
+	require.Equal(t, []float32{0, 0.1, 0.2, 0.3, 7}, scores)
+
+	scores, err = parseScores([]string{"-5..15/0.5"})
+	require.Nil(t, err)
+	require.Len(t, scores, 41)
+	require.Equal(t, float32(15), scores[40])
+
+	_, err = parseScores([]string{"x", "5..1", "1..5/0", "0..1000/0.5", "1..2/x", "nan", "inf", "-Inf", "1e400"})
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid), err)
+	require.Equal(t, []string{
+		"invalid score: 'x'",
+		"score range '5..1' ends below its start",
+		"score range '1..5/0' step must be greater than 0",
+		"score range '0..1000/0.5' exceeds the limit of 1000 scores",
+		"invalid score: '1..2/x'",
+		"invalid score: 'nan'",
+		"invalid score: 'inf'",
+		"invalid score: '-Inf'",
+		"invalid score: '1e400'",
+	}, invalid.Violations)
+}
+
+func TestClassBands(t *testing.T) {
+	table := classes.DefaultClasses
+	bands := classBands(table, -5, 15)
+	require.Equal(t, []ClassBand{
+		{Class: "ham", Min: -5, Max: 5},
+		{Class: "probable", Min: 5, Max: 10},
+		{Class: "spam", Min: 10, Max: 15},
+	}, bands)
+	require.Equal(t, []string{
+		"-5 to 5   ham       ####################",
+		"5 to 10   probable  ##########",
+		"10 to 15  spam      ##########",
+	}, formatBands(bands))
+
+	require.Equal(t, []ClassBand{{Class: "probable", Min: 6, Max: 8}}, classBands(table, 6, 8))
+	require.Equal(t, []ClassBand{{Class: "ham", Min: 1, Max: 1}}, classBands(table, 1, 1))
+	require.Equal(t, []string{"1 to 1  ham  #"}, formatBands(classBands(table, 1, 1)))
+}
+
+func TestClassifyCommand(t *testing.T) {
+	configure(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	server.Filterctld.AddUser(sender, "test-password")
+
+	rc := RequestContext{Sender: sender, Command: "classify", Args: []string{"4..6", "12"}}
+	result, err := classifyCommand{}.Run(context.Background(), &rc)
+	require.Nil(t, err)
+	response := result.(*APIClassifyResponse)
+	require.Equal(t, []ScoreClass{
+		{Score: 4, Class: "ham"},
+		{Score: 5, Class: "probable"},
+		{Score: 6, Class: "probable"},
+		{Score: 12, Class: "spam"},
+	}, response.Classes)
+	require.Len(t, response.Bands, 3)
+}
@@ -1,82 +1,54 @@
 package cmd
 
 import (
-	"bytes"
-	"crypto/tls"
-	"crypto/x509"
-	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/rstms/mabctl/api"
-	"github.com/rstms/rspamd-classes/classes"
+	"github.com/rstms/filterctl/pkg/client"
 	"github.com/spf13/viper"
 )
 
 var ADDR_PATTERN = regexp.MustCompile(`^.*<([^>]*)>.*$`)
+var BREAKER_NAME_PATTERN = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
 var EMAIL_PATTERN = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 
-type APIClient struct {
-	Client *http.Client
-	URL    string
-}
+type APIClient = client.Client
 
-type APIResponse struct {
-	User    string
-	Request string
-	Message string
-	Success bool
-}
+type APIResponse = client.Response
 
-type APIClassesResponse struct {
-	APIResponse
-	Classes []classes.SpamClass
-}
+type APIClassesResponse = client.ClassesResponse
 
-type APIClassResponse struct {
-	APIResponse
-	Class string
-}
+type APIClassResponse = client.ClassResponse
 
-type APIBooksResponse struct {
-	APIResponse
-	Books []string
-}
+type APIBooksResponse = client.ScanResponse
 
-type APIAddressesResponse struct {
-	APIResponse
-	Addresses []any
-}
+type APIAddressesResponse = client.AddressesResponse
 
-type APIPasswordResponse struct {
-	APIResponse
-	Password string
-}
+type APIPasswordResponse = client.PasswordResponse
+
+type APIDumpResponse = client.DumpResponse
+
+type APIRestoreRequest = client.RestoreRequest
+
+type APIRescanRequest = client.RescanRequest
+
+type APIRescanResult = client.RescanResult
+
+type APIRescanStatus = client.RescanStatus
+
+type APIRescanResponse = client.RescanResponse
 
 type APIAccountsResponse struct {
 	APIResponse
 	Accounts map[string]string
 }
 
-type APIDumpResponse struct {
-	APIResponse
-	Classes  []classes.SpamClass
-	Books    map[string]any
-	Password string
-}
-
-type APIRestoreRequest struct {
-	Username string
-	Dump     api.ConfigDump
-}
-
 type APIUsageResponse struct {
 	APIResponse
 	Help     []string
@@ -93,36 +65,6 @@ type APIVersionResponse struct {
 	GID     int
 }
 
-type APIRescanRequest struct {
-	Username   string
-	Folder     string
-	MessageIds []string
-}
-
-type APIRescanResult struct {
-	Pathname string
-	Message  string
-	Headers  map[string]string
-}
-
-type APIRescanStatus struct {
-	Id           string
-	Running      bool
-	Total        int
-	Completed    int
-	SuccessCount int
-	FailCount    int
-	LatestFile   string
-	Request      APIRescanRequest
-	Errors       []APIRescanResult
-	Actions      []APIRescanResult
-}
-
-type APIRescanResponse struct {
-	APIResponse
-	Status map[string]APIRescanStatus
-}
-
 func GetViperPath(key string) (string, error) {
 	path := viper.GetString(key)
 	if len(path) < 2 {
@@ -139,8 +81,8 @@ func GetViperPath(key string) (string, error) {
 
 }
 
-func NewAPIClient(url string) (*APIClient, error) {
-
+// return a client config with the configured certificate file paths
+func certConfig() (*client.Config, error) {
 	certFile, err := GetViperPath("cert")
 	if err != nil {
 		return nil, err
@@ -153,152 +95,67 @@ func NewAPIClient(url string) (*APIClient, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	api := APIClient{
-		URL: url,
-	}
-
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		return nil, fmt.Errorf("error loading client certificate pair: %v", err)
-	}
-
-	caCert, err := ioutil.ReadFile(caFile)
-	if err != nil {
-		return nil, fmt.Errorf("error loading certificate authority file: %v", err)
-	}
-
-	caCertPool, err := x509.SystemCertPool()
-	if err != nil {
-		return nil, fmt.Errorf("error opening system cert pool: %v", err)
-	}
-	caCertPool.AppendCertsFromPEM(caCert)
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		RootCAs:      caCertPool,
-	}
-	api.Client = &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
-	}
-
-	return &api, nil
+	return &client.Config{Cert: certFile, Key: keyFile, CA: caFile}, nil
 }
 
-func (a *APIClient) Get(path string, response interface{}) (string, error) {
-	return a.request("GET", path, nil, response)
-}
+var certWarning sync.Once
 
-func (a *APIClient) Post(path string, request, response interface{}) (string, error) {
-	return a.request("POST", path, request, response)
-}
-
-func (a *APIClient) Put(path string, response interface{}) (string, error) {
-	return a.request("PUT", path, nil, response)
+// log a warning if a configured certificate expires within certs.warn_before
+func warnCertExpiry(config *client.Config) {
+	certWarning.Do(func() {
+		report := client.CheckCertificates(config, time.Now())
+		for _, warning := range report.Expiring(time.Now(), viper.GetDuration("certs.warn_before")) {
+			log.Printf("WARNING: %s\n", warning)
+		}
+	})
 }
 
-func (a *APIClient) Delete(path string, response interface{}) (string, error) {
-	return a.request("DELETE", path, nil, response)
-}
+func NewAPIClient(url string) (*APIClient, error) {
 
-func (a *APIClient) request(method, path string, requestData, responseData interface{}) (string, error) {
-	if viper.GetBool("verbose") {
-		log.Printf("<-- %s %s", method, a.URL+path)
-	}
-	var requestBuffer io.Reader
-	if requestData != nil {
-		requestBytes, err := json.Marshal(requestData)
-		if err != nil {
-			return "", fmt.Errorf("failed marshalling JSON body for %s request: %v", method, err)
-		}
-		if viper.GetBool("verbose") {
-			log.Printf("request: %s\n", string(requestBytes))
-		}
-		requestBuffer = bytes.NewBuffer(requestBytes)
-	}
-	request, err := http.NewRequest(method, a.URL+path, requestBuffer)
+	config, err := certConfig()
 	if err != nil {
-		return "", fmt.Errorf("failed creating %s request: %v", method, err)
+		return nil, err
 	}
-	request.Header.Add("X-Api-Key", viper.GetString("api_key"))
-	response, err := a.Client.Do(request)
-	if err != nil {
-		return "", fmt.Errorf("request failed: %v", err)
+	if !strings.HasPrefix(url, client.UNIX_SCHEME) {
+		warnCertExpiry(config)
 	}
-	defer response.Body.Close()
-	body, err := ioutil.ReadAll(response.Body)
+
+	breaker, err := newBreaker(url)
 	if err != nil {
-		return "", fmt.Errorf("failure reading response body: %v", err)
+		return nil, err
 	}
-	if response.StatusCode < 200 && response.StatusCode > 299 {
-		return "", fmt.Errorf("API returned status [%d] %s", response.StatusCode, response.Status)
+
+	config.URL = url
+	config.APIKey = viper.GetString("api_key")
+	config.Verbose = viper.GetBool("verbose")
+	config.Retry = client.RetryPolicy{
+		Attempts: viper.GetInt("retry.attempts"),
+		Delay:    viper.GetDuration("retry.delay"),
+		MaxDelay: viper.GetDuration("retry.max_delay"),
 	}
-	if viper.GetBool("verbose") {
-		log.Printf("--> %v\n", string(body))
+	config.Breaker = breaker
+	return client.New(config)
+}
+
+// return the circuit breaker for a server URL, or nil if disabled
+func newBreaker(url string) (*client.Breaker, error) {
+	threshold := viper.GetInt("breaker.threshold")
+	if threshold < 1 {
+		return nil, nil
 	}
-	err = json.Unmarshal(body, responseData)
+	dir, err := GetViperPath("breaker.dir")
 	if err != nil {
-		return "", fmt.Errorf("failed decoding JSON response: %v", err)
+		return nil, err
 	}
-
-	messageID, err := DecodedMessageID(viper.GetString("message_id"))
+	err = os.MkdirAll(dir, 0700)
 	if err != nil {
-		return "", err
-	}
-	username := viper.GetString("sender")
-	var text []byte
-
-	switch t := responseData.(type) {
-	case *APIResponse:
-		var data *APIResponse
-		data = responseData.(*APIResponse)
-		data.Request = messageID
-		data.User = username
-		text, err = json.MarshalIndent(&data, "", "  ")
-	case *APIClassesResponse:
-		var data *APIClassesResponse
-		data = responseData.(*APIClassesResponse)
-		data.Request = messageID
-		data.User = username
-		text, err = json.MarshalIndent(&data, "", "  ")
-	case *APIAddressesResponse:
-		var data *APIAddressesResponse
-		data = responseData.(*APIAddressesResponse)
-		data.Request = messageID
-		data.User = username
-		text, err = json.MarshalIndent(&data, "", "  ")
-	case *api.BooksResponse:
-		var data *api.BooksResponse
-		data = responseData.(*api.BooksResponse)
-		data.User = username
-		data.Request = messageID
-		text, err = json.MarshalIndent(&data, "", "  ")
-	case *APIDumpResponse:
-		var data *APIDumpResponse
-		data = responseData.(*APIDumpResponse)
-		data.Request = messageID
-		data.User = username
-		text, err = json.MarshalIndent(&data, "", "  ")
-	case *APIPasswordResponse:
-		var data *APIPasswordResponse
-		data = responseData.(*APIPasswordResponse)
-		data.Request = messageID
-		data.User = username
-		text, err = json.MarshalIndent(&data, "", "  ")
-	case *APIRescanResponse:
-		var data *APIRescanResponse
-		data = responseData.(*APIRescanResponse)
-		data.Request = messageID
-		data.User = username
-		text, err = json.MarshalIndent(&data, "", "  ")
-	default:
-		log.Fatalf("unknown type: %T\n", t)
+		return nil, err
 	}
-
-	if err != nil {
-		return "", fmt.Errorf("failed formatting JSON response: %v", err)
+	name := BREAKER_NAME_PATTERN.ReplaceAllString(url, "_")
+	breaker := client.Breaker{
+		Filename:  filepath.Join(dir, name+".json"),
+		Threshold: threshold,
+		Cooldown:  viper.GetDuration("breaker.cooldown"),
 	}
-
-	return string(text), nil
+	return &breaker, nil
 }
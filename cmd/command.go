@@ -0,0 +1,350 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rstms/filterctl/pkg/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+// ValidationError lists every problem found in a request before anything
+// is sent to the server.  The violations are reported to the sender.
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid request: " + strings.Join(e.Violations, "; ")
+}
+
+// return a ValidationError if any violations were found
+func validationResult(violations []string) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: violations}
+}
+
+// PartialError is returned by a command which failed after changing the
+// configuration.  Result describes the changes which were made, and is
+// included in the failure response.
+type PartialError struct {
+	Result any
+	Err    error
+}
+
+func (e *PartialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// RequestContext carries everything a command needs to execute one request
+type RequestContext struct {
+	Sender    string
+	RequestID string
+	Command   string
+	Args      []string
+	Body      []byte
+	DryRun    bool
+}
+
+// Command is implemented by each subject line command.  The returned result
+// is formatted as JSON and sent as the body of the response message.
+type Command interface {
+	Run(ctx context.Context, rc *RequestContext) (any, error)
+}
+
+type registeredCommand struct {
+	cobra   *cobra.Command
+	handler Command
+	body    bool
+	file    bool
+	nested  bool
+}
+
+// APIFileRequest is the request body of a file command: the first
+// attachment of the command message, or its text if it has no attachment
+type APIFileRequest struct {
+	Filename string `json:",omitempty"`
+	Content  string
+}
+
+var commands = map[string]registeredCommand{}
+
+// RegisterCommand makes a command available to both the cobra subcommand
+// and the mail command path
+func RegisterCommand(cmd *cobra.Command, handler Command) {
+	commands[cmd.Name()] = registeredCommand{cobra: cmd, handler: handler}
+}
+
+// RegisterBodyCommand registers a command which reads its input data from
+// the message body
+func RegisterBodyCommand(cmd *cobra.Command, handler Command) {
+	commands[cmd.Name()] = registeredCommand{cobra: cmd, handler: handler, body: true}
+}
+
+// RegisterFileCommand registers a command which reads a file from the
+// message body or an attachment.  Its arguments are validated by the command.
+func RegisterFileCommand(cmd *cobra.Command, handler Command) {
+	commands[cmd.Name()] = registeredCommand{cobra: cmd, handler: handler, body: true, file: true}
+}
+
+// RegisterNestedCommand registers a command whose arguments end with another
+// command line.  Option flags following the first argument belong to the
+// nested command.
+func RegisterNestedCommand(cmd *cobra.Command, handler Command) {
+	cmd.Flags().SetInterspersed(false)
+	commands[cmd.Name()] = registeredCommand{cobra: cmd, handler: handler, nested: true}
+}
+
+func commandHasBodyData(command string) bool {
+	c, ok := commands[command]
+	return ok && c.body
+}
+
+func commandHasFileData(command string) bool {
+	c, ok := commands[command]
+	return ok && c.file
+}
+
+func NewRequestContext(command string, args []string, body []byte) (*RequestContext, error) {
+	requestID, err := DecodedMessageID(viper.GetString("message_id"))
+	if err != nil {
+		return nil, err
+	}
+	rc := RequestContext{
+		Sender:    viper.GetString("sender"),
+		RequestID: requestID,
+		Command:   command,
+		Args:      args,
+		Body:      body,
+		DryRun:    viper.GetBool("dry_run"),
+	}
+	return &rc, nil
+}
+
+var NEGATIVE_NUMBER_PATTERN = regexp.MustCompile(`^-[0-9.]`)
+
+const negativeNumberPrefix = "\x00"
+
+// parse the option flags permitted on the subject line
+func (rc *RequestContext) parseFlags(interspersed bool) error {
+	flags := pflag.NewFlagSet(rc.Command, pflag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.SetInterspersed(interspersed)
+	// the message body is never written to a file when run in-process
+	flags.Bool("no-remove", false, "ignored")
+	flags.BoolVarP(&rc.DryRun, "dry-run", "n", false, "report changes without modifying configuration")
+	// hide arguments beginning with a negative number, such as scores,
+	// from the flag parser
+	args := make([]string, len(rc.Args))
+	for i, arg := range rc.Args {
+		args[i] = arg
+		if NEGATIVE_NUMBER_PATTERN.MatchString(arg) {
+			args[i] = negativeNumberPrefix + arg
+		}
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return fmt.Errorf("%s: %v", rc.Command, err)
+	}
+	rc.Args = []string{}
+	for _, arg := range flags.Args() {
+		rc.Args = append(rc.Args, strings.TrimPrefix(arg, negativeNumberPrefix))
+	}
+	return nil
+}
+
+// CommandTimeout returns the configured deadline for a command
+func CommandTimeout(command string) time.Duration {
+	timeout := viper.GetDuration("timeouts." + command)
+	if timeout == 0 {
+		timeout = viper.GetDuration("timeouts.default")
+	}
+	return timeout
+}
+
+// DispatchCommand validates the request arguments and runs the registered
+// command with the deadline configured for it
+func DispatchCommand(ctx context.Context, rc *RequestContext) (any, error) {
+	if rc.Command == "help" {
+		rc.Command = "usage"
+	}
+	c, ok := commands[rc.Command]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCommand, rc.Command)
+	}
+	err := rc.checkArgs(c)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout(rc.Command))
+	defer cancel()
+	return runHandler(ctx, c.handler, rc)
+}
+
+// parse the request flags and validate the remaining arguments
+func (rc *RequestContext) checkArgs(c registeredCommand) error {
+	err := rc.parseFlags(!c.nested)
+	if err != nil {
+		return err
+	}
+	if c.body {
+		if len(rc.Args) != 0 && !c.file {
+			return fmt.Errorf("%s: unexpected arguments: %v", rc.Command, rc.Args)
+		}
+		if len(rc.Body) == 0 {
+			return fmt.Errorf("%s: missing message body data", rc.Command)
+		}
+	} else if c.cobra.Args != nil {
+		err := c.cobra.Args(c.cobra, rc.Args)
+		if err != nil {
+			return fmt.Errorf("%s: %v", rc.Command, err)
+		}
+	}
+	return nil
+}
+
+// commands which modify configuration are previewed when DryRun is set;
+// a command which cannot be previewed is refused rather than run
+func runHandler(ctx context.Context, handler Command, rc *RequestContext) (any, error) {
+	if rc.DryRun {
+		dryRunner, ok := handler.(DryRunCommand)
+		if !ok {
+			return nil, validationResult([]string{fmt.Sprintf("%s does not support --dry-run", rc.Command)})
+		}
+		return dryRunner.DryRun(ctx, rc)
+	}
+	snapshotter, ok := handler.(SnapshotCommand)
+	if ok {
+		return runWithSnapshot(ctx, snapshotter, rc)
+	}
+	return handler.Run(ctx, rc)
+}
+
+// RunCommand executes a registered command from its cobra subcommand,
+// writing the JSON result to stdout
+func RunCommand(cmd *cobra.Command, args []string, body []byte) {
+	c, ok := commands[cmd.Name()]
+	if !ok {
+		cobra.CheckErr(fmt.Errorf("%w: %s", ErrUnknownCommand, cmd.Name()))
+	}
+	rc, err := NewRequestContext(cmd.Name(), args, body)
+	cobra.CheckErr(err)
+	ctx, cancel := context.WithTimeout(cmd.Context(), CommandTimeout(rc.Command))
+	defer cancel()
+	result, err := runHandler(ctx, c.handler, rc)
+	if errors.Is(err, client.ErrUnavailable) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(EX_TEMPFAIL)
+	}
+	// report server and validation errors to a parent process on stdout
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		response, _, _ := apiErrorResponse(rc.Sender, rc.RequestID, rc.Command, apiErr)
+		response, _ = addPartialResult(response, err)
+		fmt.Println(string(response))
+	}
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		response, _, _ := invalidRequestResponse(rc.Sender, rc.RequestID, rc.Command, invalid)
+		response, _ = addPartialResult(response, err)
+		fmt.Println(string(response))
+	}
+	cobra.CheckErr(err)
+	text, err := json.MarshalIndent(result, "", "  ")
+	cobra.CheckErr(err)
+	fmt.Println(string(text))
+}
+
+// RunBodyCommand reads the request data from filename (or stdin) and
+// executes a registered body command
+func RunBodyCommand(cmd *cobra.Command, filename string) {
+	body, err := readBodyFile(filename)
+	cobra.CheckErr(err)
+	RunCommand(cmd, []string{}, body)
+}
+
+// RunFileCommand reads a file named by the last argument and executes a
+// registered file command with the remaining arguments.  A file containing
+// an APIFileRequest, as written for a mail command, is used unchanged.
+func RunFileCommand(cmd *cobra.Command, args []string) {
+	filename := args[len(args)-1]
+	data, err := readBodyFile(filename)
+	cobra.CheckErr(err)
+	var request APIFileRequest
+	if json.Unmarshal(data, &request) != nil || request.Content == "" {
+		request = APIFileRequest{Filename: filepath.Base(filename), Content: string(data)}
+		data, err = json.MarshalIndent(&request, "", "  ")
+		cobra.CheckErr(err)
+	}
+	RunCommand(cmd, args[:len(args)-1], data)
+}
+
+// isRequestFile reports whether filename holds a JSON request body, as
+// written for a body command run in a child process, rather than input such
+// as a mailbox which the cobra subcommand converts to a request
+func isRequestFile(filename string) bool {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	var first [1]byte
+	_, err = io.ReadFull(file, first[:])
+	return err == nil && first[0] == '{'
+}
+
+func readBodyFile(filename string) ([]byte, error) {
+	if filename == "" || filename == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !viper.GetBool("no_remove") {
+		err = os.Remove(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/rstms/filterctl/pkg/client"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDispatchCommand(t *testing.T) {
+	rc := RequestContext{Sender: "test@mailcapsule.io", RequestID: "dispatch test", Command: "help", Args: []string{}}
+	result, err := DispatchCommand(context.Background(), &rc)
+	require.Nil(t, err)
+	response, ok := result.(*APIUsageResponse)
+	require.True(t, ok)
+	require.True(t, response.Success)
+	require.Equal(t, "dispatch test", response.Request)
+
+	rc = RequestContext{Sender: "test@mailcapsule.io", Command: "fnord"}
+	_, err = DispatchCommand(context.Background(), &rc)
+	require.True(t, errors.Is(err, ErrUnknownCommand))
+
+	rc = RequestContext{Sender: "test@mailcapsule.io", Command: "classify", Args: []string{}}
+	_, err = DispatchCommand(context.Background(), &rc)
+	require.NotNil(t, err)
+
+	rc = RequestContext{Sender: "test@mailcapsule.io", Command: "restore", Args: []string{"--no-remove"}}
+	_, err = DispatchCommand(context.Background(), &rc)
+	require.ErrorContains(t, err, "missing message body")
+}
+
+func TestAPIErrorResponse(t *testing.T) {
+	apiErr := &client.APIError{StatusCode: 404, Method: "GET", Path: "/filterctl/addresses/test@mailcapsule.io/fnord/", Message: "unknown book"}
+	response, status, err := apiErrorResponse("test@mailcapsule.io", "error test", "addrs", apiErr)
+	require.Nil(t, err)
+	require.Equal(t, "not_found", status)
+	var result struct {
+		Success bool
+		Message string
+		Error   client.APIError
+	}
+	require.Nil(t, json.Unmarshal(response, &result))
+	require.False(t, result.Success)
+	require.Equal(t, "test@mailcapsule.io addrs failed: not found: unknown book", result.Message)
+	require.Equal(t, 404, result.Error.StatusCode)
+
+	apiErr = &client.APIError{StatusCode: 503, Retryable: true}
+	_, status, err = apiErrorResponse("test@mailcapsule.io", "error test", "classes", apiErr)
+	require.Nil(t, err)
+	require.Equal(t, "server_error", status)
+}
+
+func TestParseFlagsNegativeNumbers(t *testing.T) {
+	rc := RequestContext{Command: "classify", Args: []string{"-5..15/0.5", "-n", "-1.5", "3"}}
+	require.Nil(t, rc.parseFlags(true))
+	require.True(t, rc.DryRun)
+	require.Equal(t, []string{"-5..15/0.5", "-1.5", "3"}, rc.Args)
+
+	rc = RequestContext{Command: "classify", Args: []string{"-x"}}
+	require.ErrorContains(t, rc.parseFlags(true), "unknown shorthand flag")
+}
+
+// commands which never change configuration and so have no dry run
+var readOnlyCommands = []string{
+	"accounts", "addrs", "books", "classes", "classify", "diffclasses", "dump",
+	"exportclasses", "history", "jobs", "passwd", "presets", "recommend",
+	"rescanstatus", "scan", "simulate", "usage", "version",
+}
+
+func TestMutatingCommandsDryRun(t *testing.T) {
+	readOnly := map[string]bool{}
+	for _, name := range readOnlyCommands {
+		_, ok := commands[name]
+		require.True(t, ok, name)
+		readOnly[name] = true
+	}
+	for name, c := range commands {
+		if readOnly[name] {
+			continue
+		}
+		_, ok := c.handler.(DryRunCommand)
+		require.True(t, ok, "%s changes configuration but has no DryRun", name)
+	}
+
+	rc := RequestContext{Sender: "test@mailcapsule.io", Command: "version", Args: []string{"--dry-run"}}
+	_, err := DispatchCommand(context.Background(), &rc)
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid), err)
+	require.Equal(t, []string{"version does not support --dry-run"}, invalid.Violations)
+}
+
+func TestSubprocessArgs(t *testing.T) {
+	args, err := subprocessArgs([]string{"classify", "-5..15/2.5", "-n", "-1"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"classify", "--dry-run", "--", "-5..15/2.5", "-1"}, args)
+
+	args, err = subprocessArgs([]string{"at", "-n", "1h", "set", "--dry-run", "ham=-2"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"at", "--dry-run", "--", "1h", "set", "--dry-run", "ham=-2"}, args)
+
+	_, err = subprocessArgs([]string{"classes", "--verbose"})
+	require.ErrorContains(t, err, "unknown flag")
+}
@@ -0,0 +1,234 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/mail"
+	"path/filepath"
+	"strings"
+
+	"github.com/emersion/go-vcard"
+)
+
+// Contact is an email address with its display name
+type Contact struct {
+	Address string
+	Name    string `json:",omitempty"`
+}
+
+// InvalidContact is a contact file entry which has no valid email address
+type InvalidContact struct {
+	Entry  string
+	Value  string `json:",omitempty"`
+	Reason string
+}
+
+// ParseContacts returns the email addresses in a vCard or CSV contacts file,
+// in file order, and the entries with invalid addresses.  The format is
+// selected by the filename extension, or detected from the content.
+func ParseContacts(filename string, content []byte) ([]Contact, []InvalidContact, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".vcf", ".vcard":
+		return parseVCardContacts(content)
+	case ".csv":
+		return parseCSVContacts(content)
+	}
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(string(content))), "BEGIN:VCARD") {
+		return parseVCardContacts(content)
+	}
+	return parseCSVContacts(content)
+}
+
+// return the normalized form of an email address value, which may include
+// a display name
+func parseContactAddress(value, name string) (Contact, error) {
+	parsed, err := mail.ParseAddress(strings.TrimSpace(value))
+	if err != nil {
+		return Contact{}, err
+	}
+	if name == "" {
+		name = parsed.Name
+	}
+	return Contact{Address: strings.ToLower(parsed.Address), Name: strings.TrimSpace(name)}, nil
+}
+
+// return the display name of a vCard, from the formatted name or the
+// structured name
+func vcardName(card vcard.Card) string {
+	name := card.PreferredValue(vcard.FieldFormattedName)
+	if name == "" {
+		if n := card.Name(); n != nil {
+			name = strings.Join(strings.Fields(strings.Join([]string{n.GivenName, n.FamilyName}, " ")), " ")
+		}
+	}
+	return strings.TrimSpace(name)
+}
+
+func parseVCardContacts(content []byte) ([]Contact, []InvalidContact, error) {
+	decoder := vcard.NewDecoder(bytes.NewReader(content))
+	contacts := []Contact{}
+	invalid := []InvalidContact{}
+	for index := 1; ; index++ {
+		card, err := decoder.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed parsing vCard %d: %v", index, err)
+		}
+		name := vcardName(card)
+		entry := fmt.Sprintf("vCard %d", index)
+		if name != "" {
+			entry = fmt.Sprintf("vCard %d (%s)", index, name)
+		}
+		values := card.Values(vcard.FieldEmail)
+		if len(values) == 0 {
+			invalid = append(invalid, InvalidContact{Entry: entry, Reason: "no email address"})
+		}
+		for _, value := range values {
+			contact, err := parseContactAddress(value, name)
+			if err != nil {
+				invalid = append(invalid, InvalidContact{Entry: entry, Value: value, Reason: err.Error()})
+				continue
+			}
+			contacts = append(contacts, contact)
+		}
+	}
+	return contacts, invalid, nil
+}
+
+// the columns of a CSV contacts file holding addresses and name parts
+type contactColumns struct {
+	Addresses []int
+	Name      int
+	Given     int
+	Family    int
+}
+
+// return the columns named in a CSV heading row, such as those written by
+// common mail clients, or false if row is not a heading
+func csvContactColumns(row []string) (contactColumns, bool) {
+	columns := contactColumns{Name: -1, Given: -1, Family: -1}
+	for i, heading := range row {
+		key := strings.ToLower(strings.TrimSpace(heading))
+		compact := strings.NewReplacer("-", "", "_", "", " ", "").Replace(key)
+		switch {
+		case strings.Contains(key, "@"):
+			return columns, false
+		case strings.Contains(compact, "email") && !strings.Contains(compact, "type") && !strings.Contains(compact, "display"):
+			columns.Addresses = append(columns.Addresses, i)
+		case compact == "name" || compact == "displayname" || compact == "fullname":
+			columns.Name = i
+		case compact == "firstname" || compact == "givenname":
+			columns.Given = i
+		case compact == "lastname" || compact == "familyname":
+			columns.Family = i
+		}
+	}
+	return columns, len(columns.Addresses) > 0
+}
+
+// return the display name from the named columns of a CSV row
+func (c contactColumns) name(record []string) string {
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	name := field(c.Name)
+	if name == "" {
+		name = strings.TrimSpace(field(c.Given) + " " + field(c.Family))
+	}
+	return name
+}
+
+// parse a CSV contacts file.  Without a heading row naming the email
+// columns, each field containing '@' is an address and the first other
+// non-empty field is the display name.
+func parseCSVContacts(content []byte) ([]Contact, []InvalidContact, error) {
+	r := csv.NewReader(bytes.NewReader(content))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	contacts := []Contact{}
+	invalid := []InvalidContact{}
+	var columns *contactColumns
+	for row := 1; ; row++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed parsing CSV: %v", err)
+		}
+		if row == 1 {
+			heading, ok := csvContactColumns(record)
+			if ok {
+				columns = &heading
+				continue
+			}
+		}
+		entry := fmt.Sprintf("row %d", row)
+		name := ""
+		values := []string{}
+		if columns != nil {
+			name = columns.name(record)
+			for _, i := range columns.Addresses {
+				if i >= len(record) {
+					continue
+				}
+				// some clients list several addresses in one field
+				for _, value := range strings.Split(record[i], ":::") {
+					if strings.TrimSpace(value) != "" {
+						values = append(values, value)
+					}
+				}
+			}
+		} else {
+			for _, field := range record {
+				field = strings.TrimSpace(field)
+				switch {
+				case strings.Contains(field, "@"):
+					values = append(values, field)
+				case name == "":
+					name = field
+				}
+			}
+		}
+		if len(values) == 0 {
+			invalid = append(invalid, InvalidContact{Entry: entry, Reason: "no email address"})
+		}
+		for _, value := range values {
+			contact, err := parseContactAddress(value, name)
+			if err != nil {
+				invalid = append(invalid, InvalidContact{Entry: entry, Value: value, Reason: err.Error()})
+				continue
+			}
+			contacts = append(contacts, contact)
+		}
+	}
+	return contacts, invalid, nil
+}
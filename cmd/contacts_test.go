@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testVCards = `BEGIN:VCARD
+VERSION:3.0
+FN:Alice Example
+EMAIL;TYPE=work:Alice@Example.com
+EMAIL;TYPE=home:alice@home.example.org
+END:VCARD
+BEGIN:VCARD
+VERSION:3.0
+N:Builder;Bob;;;
+EMAIL:bob@example.com
+END:VCARD
+BEGIN:VCARD
+VERSION:3.0
+FN:Phone Only
+TEL:555-0100
+END:VCARD
+BEGIN:VCARD
+VERSION:3.0
+FN:Broken
+EMAIL:not-an-address
+END:VCARD
+`
+
+func TestParseVCardContacts(t *testing.T) {
+	for _, filename := range []string{"contacts.vcf", ""} {
+		contacts, invalid, err := ParseContacts(filename, []byte(testVCards))
+		require.Nil(t, err)
+		require.Equal(t, []Contact{
+			{Address: "alice@example.com", Name: "Alice Example"},
+			{Address: "alice@home.example.org", Name: "Alice Example"},
+			{Address: "bob@example.com", Name: "Bob Builder"},
+		}, contacts)
+		require.Len(t, invalid, 2)
+		require.Equal(t, InvalidContact{Entry: "vCard 3 (Phone Only)", Reason: "no email address"}, invalid[0])
+		require.Equal(t, "vCard 4 (Broken)", invalid[1].Entry)
+		require.Equal(t, "not-an-address", invalid[1].Value)
+	}
+}
+
+func TestParseCSVContacts(t *testing.T) {
+	content := "First Name,Last Name,E-mail Address,E-mail Display Name,E-mail 2 Address\n" +
+		"Alice,Example,alice@example.com,Alice (alice@example.com),alice@home.example.org\n" +
+		"Carol,,,,\n" +
+		"Dave,Jones,dave@example,,\n"
+	contacts, invalid, err := ParseContacts("contacts.csv", []byte(content))
+	require.Nil(t, err)
+	require.Equal(t, []Contact{
+		{Address: "alice@example.com", Name: "Alice Example"},
+		{Address: "alice@home.example.org", Name: "Alice Example"},
+		{Address: "dave@example", Name: "Dave Jones"},
+	}, contacts)
+	require.Equal(t, []InvalidContact{{Entry: "row 3", Reason: "no email address"}}, invalid)
+
+	content = "Name,E-mail 1 - Type,E-mail 1 - Value\nErin,* Home,erin@example.com ::: erin@work.example.com\n"
+	contacts, _, err = ParseContacts("google.csv", []byte(content))
+	require.Nil(t, err)
+	require.Equal(t, []Contact{
+		{Address: "erin@example.com", Name: "Erin"},
+		{Address: "erin@work.example.com", Name: "Erin"},
+	}, contacts)
+
+	// without a heading row, fields containing '@' are addresses
+	content = "Frank Smith <FRANK@example.com>\nGrace,grace@example.com\n,bad@@example.com\n"
+	contacts, invalid, err = ParseContacts("", []byte(content))
+	require.Nil(t, err)
+	require.Equal(t, []Contact{
+		{Address: "frank@example.com", Name: "Frank Smith"},
+		{Address: "grace@example.com", Name: "Grace"},
+	}, contacts)
+	require.Len(t, invalid, 1)
+	require.Equal(t, "row 3", invalid[0].Entry)
+}
@@ -22,9 +22,9 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"context"
+	"github.com/rstms/rspamd-classes/classes"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var deleteCmd = &cobra.Command{
@@ -36,26 +36,60 @@ for the sender address are deleted.  Optionally, one or more CLASS names may
 be provided to delete specific classes from the configuration.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		filterctl := NewFilterctlClient()
-		var response string
-		var data APIResponse
-		if len(args) == 0 {
-			path := fmt.Sprintf("/filterctl/classes/%s/", viper.GetString("sender"))
-			r, err := filterctl.Delete(path, &data)
-			cobra.CheckErr(err)
-			response = r
-		} else {
-			for _, class := range args {
-				path := fmt.Sprintf("/filterctl/classes/%s/%s/", viper.GetString("sender"), class)
-				r, err := filterctl.Delete(path, &data)
-				cobra.CheckErr(err)
-				response = r
-			}
-		}
-		fmt.Println(response)
+		RunCommand(cmd, args, nil)
 	},
 }
 
+type deleteCommand struct{}
+
+func (deleteCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	if len(rc.Args) == 0 {
+		return filterctl.DeleteClasses(ctx, rc.Sender)
+	}
+	var response *APIResponse
+	for _, class := range rc.Args {
+		response, err = filterctl.DeleteClass(ctx, rc.Sender, class)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+func (deleteCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	before, err := currentClasses(ctx, filterctl, rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	spamClasses, err := classes.New("")
+	if err != nil {
+		return nil, err
+	}
+	spamClasses.SetClasses(rc.Sender, before)
+	if len(rc.Args) == 0 {
+		spamClasses.DeleteClasses(rc.Sender)
+	} else {
+		for _, class := range rc.Args {
+			spamClasses.DeleteClass(rc.Sender, class)
+		}
+	}
+	after := spamClasses.GetClasses(rc.Sender)
+	return newDryRunResponse(rc, diffClasses(before, after), nil), nil
+}
+
+func (deleteCommand) SnapshotScope(rc *RequestContext) (string, error) {
+	return CLASSES_SCOPE, nil
+}
+
 func init() {
 	rootCmd.AddCommand(deleteCmd)
+	RegisterCommand(deleteCmd, deleteCommand{})
 }
@@ -0,0 +1,266 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rstms/filterctl/pkg/client"
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/spf13/cobra"
+)
+
+const DEFAULT_PRESET = "default"
+
+// the default comparison uses the class table of the server's 'default'
+// address, or the rspamd-classes library defaults if the server has none
+const DEFAULT_BASELINE = "server default classes"
+const LIBRARY_BASELINE = "built-in rspamd-classes library defaults"
+
+// diffclassesCmd represents the diffclasses command
+var diffclassesCmd = &cobra.Command{
+	Use:   "diffclasses [PRESET|default]",
+	Short: "compare classes with the defaults or a preset",
+	Long: `
+Compare the sender's class table with the default classes, or with the named
+PRESET listed by the presets command.  The default classes are the filter
+server's table for the 'default' address, which applies to every sender
+without classes of their own.  If the server does not provide one, the
+built-in defaults of the rspamd-classes library are used.  The Baseline
+value names the table compared.
+The response lists the classes the sender has added, removed or changed,
+with the Old threshold from the comparison table and the New threshold from
+the sender's table.  The Moved list shows each range of scores which the
+sender's table assigns to a different class.  The Table lines show the same
+comparison as text.
+`,
+	Args: cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		RunCommand(cmd, args, nil)
+	},
+}
+
+// ScoreRange is a range of scores assigned to class From by the comparison
+// table and to class To by the sender's table.  Scores from Min up to but
+// not including Max are in the range; a missing Min or Max is unbounded.
+type ScoreRange struct {
+	Min  *float32 `json:",omitempty"`
+	Max  *float32 `json:",omitempty"`
+	From string
+	To   string
+}
+
+type APIDiffClassesResponse struct {
+	APIResponse
+	Compare  string
+	Baseline string
+	Classes  []ClassChange
+	Moved    []ScoreRange
+	Table    []string
+}
+
+type diffclassesCommand struct{}
+
+func (diffclassesCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	name := DEFAULT_PRESET
+	if len(rc.Args) > 0 {
+		name = strings.ToLower(rc.Args[0])
+	}
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	var baseline []classes.SpamClass
+	var source string
+	if name == DEFAULT_PRESET {
+		baseline, source, err = defaultClasses(ctx, filterctl)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		preset, err := FindPreset(rc.Sender, name)
+		if err != nil {
+			return nil, err
+		}
+		baseline = preset.Classes
+		source = fmt.Sprintf("preset '%s'", preset.Name)
+	}
+	current, err := currentClasses(ctx, filterctl, rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	changes := diffClasses(baseline, current)
+	moved := diffRanges(baseline, current)
+	var response APIDiffClassesResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s diffclasses %s: %d changes, %d score ranges moved", rc.Sender, name, len(changes), len(moved))
+	response.Compare = name
+	response.Baseline = source
+	response.Classes = changes
+	response.Moved = moved
+	response.Table = formatClassDiff(name, baseline, current, changes, moved)
+	return &response, nil
+}
+
+// return the server's default class table and its description, falling back
+// to the library defaults if the server reports an error or an empty table
+func defaultClasses(ctx context.Context, filterctl *APIClient) ([]classes.SpamClass, string, error) {
+	table, err := currentClasses(ctx, filterctl, DEFAULT_PRESET)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) || (err == nil && len(table) == 0) {
+		return classes.DefaultClasses, LIBRARY_BASELINE, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return table, DEFAULT_BASELINE, nil
+}
+
+// return the ranges of scores assigned to different classes by before and
+// after, merging adjacent ranges with the same change
+func diffRanges(before, after []classes.SpamClass) []ScoreRange {
+	bounds := []float32{}
+	seen := make(map[float32]bool)
+	for _, class := range slices.Concat(before, after) {
+		if !seen[class.Score] {
+			seen[class.Score] = true
+			bounds = append(bounds, class.Score)
+		}
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+	classifyBefore := newClassifier(before)
+	classifyAfter := newClassifier(after)
+	moved := []ScoreRange{}
+	for i := 0; i <= len(bounds); i++ {
+		var low, high *float32
+		score := float32(math.Inf(-1))
+		if i > 0 {
+			low = &bounds[i-1]
+			score = *low
+		}
+		if i < len(bounds) {
+			high = &bounds[i]
+		}
+		from := classifyBefore(score)
+		to := classifyAfter(score)
+		if from == to {
+			continue
+		}
+		last := len(moved) - 1
+		if last >= 0 && moved[last].From == from && moved[last].To == to && moved[last].Max != nil && low != nil && *moved[last].Max == *low {
+			moved[last].Max = high
+			continue
+		}
+		moved = append(moved, ScoreRange{Min: low, Max: high, From: from, To: to})
+	}
+	return moved
+}
+
+// describe a score range for the text table
+func (r ScoreRange) String() string {
+	switch {
+	case r.Min == nil && r.Max == nil:
+		return "all scores"
+	case r.Min == nil:
+		return fmt.Sprintf("below %s", formatThreshold(*r.Max))
+	case r.Max == nil:
+		return fmt.Sprintf("%s and above", formatThreshold(*r.Min))
+	}
+	return fmt.Sprintf("%s to below %s", formatThreshold(*r.Min), formatThreshold(*r.Max))
+}
+
+// return every class in the tables once, ordered by its threshold in
+// after or, for a class only in before, its threshold in before
+func classRows(after, before []classes.SpamClass) []classes.SpamClass {
+	rows := []classes.SpamClass{}
+	listed := make(map[string]bool)
+	for _, class := range slices.Concat(after, before) {
+		if !listed[class.Name] {
+			listed[class.Name] = true
+			rows = append(rows, class)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Score < rows[j].Score })
+	return rows
+}
+
+// return text table lines comparing the class tables
+func formatClassDiff(name string, before, after []classes.SpamClass, changes []ClassChange, moved []ScoreRange) []string {
+	actions := make(map[string]string)
+	for _, change := range changes {
+		actions[change.Class] = change.Action
+	}
+	thresholds := func(table []classes.SpamClass) map[string]string {
+		values := make(map[string]string)
+		for _, class := range table {
+			values[class.Name] = formatThreshold(class.Score)
+		}
+		return values
+	}
+	old := thresholds(before)
+	current := thresholds(after)
+
+	rows := classRows(after, before)
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "CLASS\t%s\tCURRENT\tCHANGE\n", strings.ToUpper(name))
+	for _, class := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", class.Name, dash(old[class.Name]), dash(current[class.Name]), dash(actions[class.Name]))
+	}
+	w.Flush()
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	lines = append(lines, "")
+	if len(moved) == 0 {
+		return append(lines, "no score ranges moved")
+	}
+	buf.Reset()
+	w = tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "SCORES\t%s\tCURRENT\n", strings.ToUpper(name))
+	for _, r := range moved {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r, r.From, r.To)
+	}
+	w.Flush()
+	return append(lines, strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")...)
+}
+
+func dash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func init() {
+	rootCmd.AddCommand(diffclassesCmd)
+	RegisterCommand(diffclassesCmd, diffclassesCommand{})
+}
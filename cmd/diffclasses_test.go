@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/stretchr/testify/require"
+)
+
+func score(value float32) *float32 {
+	return &value
+}
+
+func TestDiffRanges(t *testing.T) {
+	defaults := classes.DefaultClasses
+	require.Empty(t, diffRanges(defaults, defaults))
+
+	current := []classes.SpamClass{{Name: "ham", Score: 7}, {Name: "probable", Score: 10}, {Name: "spam", Score: 999}}
+	require.Equal(t, []ScoreRange{{Min: score(5), Max: score(7), From: "probable", To: "ham"}}, diffRanges(defaults, current))
+
+	current = []classes.SpamClass{{Name: "low", Score: 2}, {Name: "ham", Score: 3}, {Name: "probable", Score: 12}, {Name: "spam", Score: 999}}
+	require.Equal(t, []ScoreRange{
+		{Max: score(2), From: "ham", To: "low"},
+		{Min: score(3), Max: score(5), From: "ham", To: "probable"},
+		{Min: score(10), Max: score(12), From: "spam", To: "probable"},
+	}, diffRanges(defaults, current))
+
+	strict := []classes.SpamClass{{Name: "ham", Score: 0}, {Name: "spam", Score: 999}}
+	require.Equal(t, []ScoreRange{
+		{Min: score(0), Max: score(5), From: "ham", To: "spam"},
+		{Min: score(5), Max: score(10), From: "probable", To: "spam"},
+	}, diffRanges(defaults, strict))
+}
+
+func TestDiffClassesCommand(t *testing.T) {
+	configure(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	server.Filterctld.AddUser(sender, "test-password")
+	setPresets(t, map[string]any{"strict": []string{"ham=0", "probable=3", "spam=999"}})
+	ctx := context.Background()
+
+	rc := RequestContext{Sender: sender, Command: "diffclasses"}
+	result, err := diffclassesCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	response := result.(*APIDiffClassesResponse)
+	require.Equal(t, "default", response.Compare)
+	require.Equal(t, DEFAULT_BASELINE, response.Baseline)
+	require.Empty(t, response.Classes)
+	require.Empty(t, response.Moved)
+
+	rc = RequestContext{Sender: sender, Command: "set", Args: []string{"ham=7"}}
+	_, err = setCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+
+	rc = RequestContext{Sender: sender, Command: "diffclasses", Args: []string{"default"}}
+	result, err = diffclassesCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	response = result.(*APIDiffClassesResponse)
+	require.Equal(t, []ClassChange{{Class: "ham", Action: "change", Old: score(5), New: score(7)}}, response.Classes)
+	require.Equal(t, []string{
+		"CLASS     DEFAULT  CURRENT  CHANGE",
+		"ham       5        7        change",
+		"probable  10       10       -",
+		"spam      999      999      -",
+		"",
+		"SCORES        DEFAULT   CURRENT",
+		"5 to below 7  probable  ham",
+	}, response.Table)
+
+	rc = RequestContext{Sender: sender, Command: "diffclasses", Args: []string{"strict"}}
+	result, err = diffclassesCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	response = result.(*APIDiffClassesResponse)
+	require.Equal(t, "strict", response.Compare)
+	require.Equal(t, "preset 'strict'", response.Baseline)
+	require.Equal(t, []ClassChange{
+		{Class: "ham", Action: "change", Old: score(0), New: score(7)},
+		{Class: "probable", Action: "change", Old: score(3), New: score(10)},
+	}, response.Classes)
+	require.Equal(t, []ScoreRange{
+		{Min: score(0), Max: score(3), From: "probable", To: "ham"},
+		{Min: score(3), Max: score(7), From: "spam", To: "ham"},
+		{Min: score(7), Max: score(10), From: "spam", To: "probable"},
+	}, response.Moved)
+
+	// the comparison uses the server's table for the default address
+	rc = RequestContext{Sender: DEFAULT_PRESET, Command: "set", Args: []string{"ham=4"}}
+	_, err = setCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	rc = RequestContext{Sender: sender, Command: "diffclasses"}
+	result, err = diffclassesCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	response = result.(*APIDiffClassesResponse)
+	require.Equal(t, []ClassChange{{Class: "ham", Action: "change", Old: score(4), New: score(7)}}, response.Classes)
+	require.Equal(t, float32(5), classes.DefaultClasses[0].Score)
+}
@@ -0,0 +1,180 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/rstms/rspamd-classes/classes"
+)
+
+// DryRunCommand is implemented by commands which modify the sender's
+// configuration.  DryRun computes the changes the command would make using
+// only read requests.
+type DryRunCommand interface {
+	Command
+	DryRun(ctx context.Context, rc *RequestContext) (any, error)
+}
+
+type ClassChange struct {
+	Class  string
+	Action string
+	Old    *float32 `json:",omitempty"`
+	New    *float32 `json:",omitempty"`
+}
+
+type BookChange struct {
+	Book    string
+	Action  string
+	Added   []string `json:",omitempty"`
+	Removed []string `json:",omitempty"`
+}
+
+type APIDryRunResponse struct {
+	APIResponse
+	DryRun  bool
+	Classes []ClassChange `json:",omitempty"`
+	Books   []BookChange  `json:",omitempty"`
+}
+
+type APIRescanDryRunResponse struct {
+	APIDryRunResponse
+	Rescan APIRescanRequest
+}
+
+func newDryRunResponse(rc *RequestContext, classChanges []ClassChange, bookChanges []BookChange) *APIDryRunResponse {
+	var response APIDryRunResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.DryRun = true
+	response.Classes = classChanges
+	response.Books = bookChanges
+	count := len(classChanges) + len(bookChanges)
+	response.Message = fmt.Sprintf("%s %s dry run: %d changes", rc.Sender, rc.Command, count)
+	return &response
+}
+
+// return the sender's current class table
+func currentClasses(ctx context.Context, filterctl *APIClient, sender string) ([]classes.SpamClass, error) {
+	response, err := filterctl.Classes(ctx, sender)
+	if err != nil {
+		return nil, err
+	}
+	return response.Classes, nil
+}
+
+// return the sender's address book names
+func currentBooks(ctx context.Context, filterctl *APIClient, sender string) ([]string, error) {
+	response, err := filterctl.Books(ctx, sender)
+	if err != nil {
+		return nil, err
+	}
+	books := []string{}
+	for _, book := range response.Books {
+		books = append(books, book.BookName)
+	}
+	return books, nil
+}
+
+// return the addresses in one of the sender's address books
+func currentAddresses(ctx context.Context, filterctl *APIClient, sender, bookname string) ([]string, error) {
+	response, err := filterctl.Addresses(ctx, sender, bookname)
+	if err != nil {
+		return nil, err
+	}
+	addresses := []string{}
+	for _, address := range response.Addresses {
+		addresses = append(addresses, fmt.Sprintf("%v", address))
+	}
+	return addresses, nil
+}
+
+func hasBook(books []string, bookname string) bool {
+	for _, book := range books {
+		if book == bookname {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize a class table with the rspamd-classes library rules
+func normalizeClasses(table []classes.SpamClass) []classes.SpamClass {
+	spamClasses, err := classes.New("")
+	if err != nil {
+		return table
+	}
+	return spamClasses.SetClasses("", table)
+}
+
+// return the changes required to convert class table before into after
+func diffClasses(before, after []classes.SpamClass) []ClassChange {
+	old := make(map[string]float32)
+	for _, class := range before {
+		old[class.Name] = class.Score
+	}
+	changes := []ClassChange{}
+	for _, class := range after {
+		newScore := class.Score
+		oldScore, ok := old[class.Name]
+		switch {
+		case !ok:
+			changes = append(changes, ClassChange{Class: class.Name, Action: "add", New: &newScore})
+		case oldScore != newScore:
+			changes = append(changes, ClassChange{Class: class.Name, Action: "change", Old: &oldScore, New: &newScore})
+		}
+		delete(old, class.Name)
+	}
+	for _, class := range before {
+		oldScore, ok := old[class.Name]
+		if ok {
+			changes = append(changes, ClassChange{Class: class.Name, Action: "delete", Old: &oldScore})
+		}
+	}
+	return changes
+}
+
+// return the addresses present only in after, and only in before
+func diffAddresses(before, after []string) ([]string, []string) {
+	old := make(map[string]bool)
+	for _, address := range before {
+		old[address] = true
+	}
+	seen := make(map[string]bool)
+	added := []string{}
+	for _, address := range after {
+		if !old[address] && !seen[address] {
+			added = append(added, address)
+		}
+		seen[address] = true
+		delete(old, address)
+	}
+	removed := []string{}
+	for address := range old {
+		removed = append(removed, address)
+	}
+	sort.Strings(removed)
+	return added, removed
+}
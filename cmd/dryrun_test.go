@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDiffClasses(t *testing.T) {
+	before := []classes.SpamClass{{Name: "ham", Score: 5}, {Name: "probable", Score: 10}, {Name: "spam", Score: 999}}
+	after := normalizeClasses([]classes.SpamClass{{Name: "ham", Score: 2}, {Name: "bulk", Score: 7}})
+	changes := diffClasses(before, after)
+	require.Len(t, changes, 3)
+	require.Equal(t, "ham", changes[0].Class)
+	require.Equal(t, "change", changes[0].Action)
+	require.Equal(t, float32(5), *changes[0].Old)
+	require.Equal(t, float32(2), *changes[0].New)
+	require.Equal(t, "bulk", changes[1].Class)
+	require.Equal(t, "add", changes[1].Action)
+	require.Equal(t, "probable", changes[2].Class)
+	require.Equal(t, "delete", changes[2].Action)
+}
+
+func TestDiffAddresses(t *testing.T) {
+	added, removed := diffAddresses([]string{"a@b.com", "c@d.com"}, []string{"c@d.com", "e@f.com", "e@f.com"})
+	require.Equal(t, []string{"e@f.com"}, added)
+	require.Equal(t, []string{"a@b.com"}, removed)
+}
@@ -22,10 +22,10 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"context"
 
+	"github.com/rstms/rspamd-classes/classes"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var dumpCmd = &cobra.Command{
@@ -33,18 +33,38 @@ var dumpCmd = &cobra.Command{
 	Short: "dump classes and carddav config",
 	Long: `
 Return the sender's password, address books and the list of addresses for
-each address book.
+each address book.  The Aliases value holds the class table of each of the
+sender's plus-suffix addresses that has its own classes, keyed by suffix.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		filterctl := NewFilterctlClient()
-		var data APIDumpResponse
-		path := fmt.Sprintf("/filterctl/dump/%s/", viper.GetString("sender"))
-		text, err := filterctl.Get(path, &data)
-		cobra.CheckErr(err)
-		fmt.Println(text)
+		RunCommand(cmd, args, nil)
 	},
 }
 
+type APIUserDumpResponse struct {
+	*APIDumpResponse
+	Aliases map[string][]classes.SpamClass `json:",omitempty"`
+}
+
+type dumpCommand struct{}
+
+func (dumpCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	response, err := filterctl.Dump(ctx, rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := aliasClasses(ctx, filterctl, rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	return &APIUserDumpResponse{APIDumpResponse: response, Aliases: aliases}, nil
+}
+
 func init() {
 	rootCmd.AddCommand(dumpCmd)
+	RegisterCommand(dumpCmd, dumpCommand{})
 }
@@ -2,19 +2,40 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"mime"
+	"mime/multipart"
 	"mime/quotedprintable"
+	"net/textproto"
 	"strings"
 	"time"
 )
 
-func formatEmailMessage(messageID, subject, to, from string, body []byte) ([]byte, error) {
-	var buf bytes.Buffer
+// the maximum length of a line of base64 encoded attachment content
+const BASE64_LINE_LENGTH = 76
+
+// Attachment is a file returned with a command response.  A response with
+// an Attachment value is sent as a multipart message with the file attached.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     string
+}
+
+func writeEmailHeaders(buf *bytes.Buffer, messageID, subject, to, from string) {
 	buf.WriteString(fmt.Sprintf("From: %s\r\n", from))
 	buf.WriteString(fmt.Sprintf("To: %s\r\n", to))
 	buf.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
 	buf.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
 	buf.WriteString(fmt.Sprintf("X-Filterctl-Request-ID: <%s>\r\n", strings.Trim(messageID, "<>")))
+}
+
+func formatEmailMessage(messageID, subject, to, from string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writeEmailHeaders(&buf, messageID, subject, to, from)
 	buf.WriteString("Content-Type: text/plain; charset=\"us-ascii\"\r\n")
 	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
 	buf.WriteString("\r\n")
@@ -26,3 +47,65 @@ func formatEmailMessage(messageID, subject, to, from string, body []byte) ([]byt
 	writer.Close()
 	return buf.Bytes(), nil
 }
+
+// return the attachment in a command response, or nil if it has none
+func responseAttachment(response []byte) *Attachment {
+	var result struct {
+		Attachment *Attachment
+	}
+	err := json.Unmarshal(response, &result)
+	if err != nil || result.Attachment == nil || result.Attachment.Filename == "" {
+		return nil
+	}
+	return result.Attachment
+}
+
+// format a multipart message with body as the text part followed by the
+// attachment
+func formatEmailAttachmentMessage(messageID, subject, to, from string, body []byte, attachment *Attachment) ([]byte, error) {
+	var buf bytes.Buffer
+	writeEmailHeaders(&buf, messageID, subject, to, from)
+	writer := multipart.NewWriter(&buf)
+	// a boundary derived from the request keeps the message reproducible
+	err := writer.SetBoundary(fmt.Sprintf("filterctl-%x", sha1.Sum([]byte(messageID))))
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n", writer.Boundary()))
+	buf.WriteString("\r\n")
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", "text/plain; charset=\"us-ascii\"")
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	text := quotedprintable.NewWriter(part)
+	_, err = text.Write(body)
+	if err != nil {
+		return nil, err
+	}
+	text.Close()
+
+	header = make(textproto.MIMEHeader)
+	header.Set("Content-Type", mime.FormatMediaType(attachment.ContentType, map[string]string{"name": attachment.Filename}))
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	header.Set("Content-Transfer-Encoding", "base64")
+	part, err = writer.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(attachment.Content))
+	for len(encoded) > 0 {
+		length := min(len(encoded), BASE64_LINE_LENGTH)
+		part.Write([]byte(encoded[:length] + "\r\n"))
+		encoded = encoded[length:]
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// everyCmd represents the every command
+var everyCmd = &cobra.Command{
+	Use:   "every SCHEDULE COMMAND [ARG ...]",
+	Short: "run a command repeatedly",
+	Long: `
+Schedule COMMAND to run repeatedly until it is cancelled with canceljob.
+A response is sent each time the command runs.  SCHEDULE may be 'hourly',
+'daily', 'weekly', an interval such as '6h' or '2d', a time of day as HH:MM
+to run daily, or a day such as 'monday' optionally followed by '@HH:MM' to
+run weekly.
+For example: 'every sunday@23:00 dump'.
+`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		RunCommand(cmd, args, nil)
+	},
+}
+
+type everyCommand struct{}
+
+// return the job requested by the every command arguments
+func planEvery(rc *RequestContext) (*Job, error) {
+	schedule := rc.Args[0]
+	next, err := NextScheduled(schedule, time.Now())
+	if err != nil {
+		return nil, validationResult([]string{err.Error()})
+	}
+	return NewJob(rc, schedule, next, rc.Args[1:])
+}
+
+func (everyCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	job, err := planEvery(rc)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAddJob(job)
+	if err != nil {
+		return nil, err
+	}
+	return newJobDryRunResponse(rc, job, "dry run: would schedule job "+job.ID), nil
+}
+
+func (everyCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	job, err := planEvery(rc)
+	if err != nil {
+		return nil, err
+	}
+	err = AddJob(job)
+	if err != nil {
+		return nil, err
+	}
+	return newJobResponse(rc, job, "scheduled job "+job.ID), nil
+}
+
+func init() {
+	rootCmd.AddCommand(everyCmd)
+	RegisterNestedCommand(everyCmd, everyCommand{})
+}
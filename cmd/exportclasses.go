@@ -0,0 +1,110 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/spf13/cobra"
+)
+
+// exportclassesCmd represents the exportclasses command
+var exportclassesCmd = &cobra.Command{
+	Use:   "exportclasses [+SUFFIX] [yaml|csv|json]",
+	Short: "export class table as a file",
+	Long: `
+Return the sender's class table as a file attached to the response, for
+editing and use with the importclasses command.  The file format is yaml,
+csv or json, defaulting to yaml.  A YAML file maps each class name to its
+threshold, a CSV file lists a class and threshold on each row, and a JSON
+file is a list of objects with 'name' and 'score' values.  A leading +SUFFIX
+argument exports the classes used for the sender's plus-suffix address.
+`,
+	Args: cobra.MaximumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		RunCommand(cmd, args, nil)
+	},
+}
+
+type APIExportClassesResponse struct {
+	APIResponse
+	Format     string
+	Classes    []classes.SpamClass
+	Attachment Attachment
+}
+
+type exportclassesCommand struct{}
+
+func (exportclassesCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	scope, args, err := parseClassScope(rc.Sender, rc.Args)
+	if err != nil {
+		return nil, err
+	}
+	format := YAML_FORMAT
+	if len(args) > 1 {
+		return nil, validationResult([]string{fmt.Sprintf("unexpected argument '%s'", args[1])})
+	}
+	if len(args) == 1 {
+		format = strings.ToLower(args[0])
+		if !slices.Contains(CLASS_FILE_FORMATS, format) {
+			return nil, validationResult([]string{fmt.Sprintf("unknown format '%s'; expected one of: %s", args[0], strings.Join(CLASS_FILE_FORMATS, ", "))})
+		}
+	}
+	table, _, err := scopeClasses(ctx, filterctl, scope)
+	if err != nil {
+		return nil, err
+	}
+	content, err := formatClassFile(table, format)
+	if err != nil {
+		return nil, err
+	}
+	filename := "classes." + format
+	if scope.Suffix != "" {
+		filename = fmt.Sprintf("classes+%s.%s", scope.Suffix, format)
+	}
+	var response APIExportClassesResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s exportclasses: %d classes as %s", scope.Address(), len(table), filename)
+	response.Format = format
+	response.Classes = table
+	response.Attachment = Attachment{
+		Filename:    filename,
+		ContentType: CLASS_FILE_CONTENT_TYPES[format],
+		Content:     string(content),
+	}
+	return &response, nil
+}
+
+func init() {
+	rootCmd.AddCommand(exportclassesCmd)
+	RegisterCommand(exportclassesCmd, exportclassesCommand{})
+}
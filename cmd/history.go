@@ -0,0 +1,339 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const CLASSES_SCOPE = "classes"
+const BOOKS_SCOPE = "books"
+
+const timeFormat = time.RFC1123Z
+
+// SnapshotCommand is implemented by commands which modify the sender's
+// configuration.  The state in the returned scope is saved to the sender's
+// history before the command runs so the change may be undone.
+type SnapshotCommand interface {
+	Command
+	SnapshotScope(rc *RequestContext) (string, error)
+}
+
+// AliasTablesCommand is implemented by address book commands which also
+// replace plus-suffix class tables.  The tables of the returned scopes are
+// saved in the snapshot with the address books.
+type AliasTablesCommand interface {
+	AliasScopes(rc *RequestContext) ([]ClassScope, error)
+}
+
+type Snapshot struct {
+	Time      time.Time
+	Command   string
+	Args      []string
+	RequestID string
+	Scope     string
+	Alias     string                         `json:",omitempty"`
+	Classes   []classes.SpamClass            `json:",omitempty"`
+	Books     map[string][]string            `json:",omitempty"`
+	Aliases   map[string][]classes.SpamClass `json:",omitempty"`
+	filename  string
+}
+
+type HistoryEntry struct {
+	Index     int
+	Time      string
+	Command   string
+	Args      []string
+	RequestID string
+	Scope     string
+}
+
+type APIHistoryResponse struct {
+	APIResponse
+	History []HistoryEntry
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "list configuration changes",
+	Long: `
+List the saved configuration snapshots for the sender, most recent first.
+A snapshot is saved before each command that changes classes or address
+books.  The Index value is the N argument used with the undo command.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		RunCommand(cmd, args, nil)
+	},
+}
+
+type historyCommand struct{}
+
+func (historyCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	snapshots, err := ReadHistory(rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	var response APIHistoryResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s history: %d changes", rc.Sender, len(snapshots))
+	response.History = []HistoryEntry{}
+	for i, snapshot := range snapshots {
+		response.History = append(response.History, snapshot.Entry(i+1))
+	}
+	return &response, nil
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	RegisterCommand(historyCmd, historyCommand{})
+}
+
+// return the path for the sender's entry in a per-user directory
+func userPath(key, sender string) (string, error) {
+	if sender == "" || filepath.Base(sender) != sender || strings.HasPrefix(sender, ".") {
+		return "", fmt.Errorf("invalid username: '%s'", sender)
+	}
+	dir, err := GetViperPath(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, sender), nil
+}
+
+// return the sender's history directory
+func historyDir(sender string) (string, error) {
+	return userPath("history_dir", sender)
+}
+
+// TakeSnapshot reads the sender's current state for scope from filterctld.
+// A classes snapshot holds the table selected by classScope, and Alias is
+// set to its suffix, if any.  Classes is empty when the suffix has no table.
+func TakeSnapshot(ctx context.Context, rc *RequestContext, scope string, classScope ClassScope) (*Snapshot, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := Snapshot{
+		Time:      time.Now(),
+		Command:   rc.Command,
+		Args:      rc.Args,
+		RequestID: rc.RequestID,
+		Scope:     scope,
+	}
+	switch scope {
+	case CLASSES_SCOPE:
+		var own bool
+		snapshot.Alias = classScope.Suffix
+		snapshot.Classes, own, err = scopeClasses(ctx, filterctl, classScope)
+		if !own {
+			snapshot.Classes = nil
+		}
+	case BOOKS_SCOPE:
+		snapshot.Books, err = currentDumpBooks(ctx, filterctl, rc.Sender)
+	default:
+		err = fmt.Errorf("unknown snapshot scope: %s", scope)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// return the class tables of the alias scopes, keyed by suffix.  The table
+// is empty for a suffix which has no table of its own.
+func snapshotAliases(ctx context.Context, rc *RequestContext, scopes []ClassScope) (map[string][]classes.SpamClass, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string][]classes.SpamClass)
+	for _, scope := range scopes {
+		table, own, err := scopeClasses(ctx, filterctl, scope)
+		if err != nil {
+			return nil, err
+		}
+		if !own {
+			table = nil
+		}
+		tables[scope.Suffix] = table
+	}
+	return tables, nil
+}
+
+// return the sender's address books and addresses from the dump endpoint
+func currentDumpBooks(ctx context.Context, filterctl *APIClient, sender string) (map[string][]string, error) {
+	response, err := filterctl.Dump(ctx, sender)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(response.Books)
+	if err != nil {
+		return nil, err
+	}
+	books := make(map[string][]string)
+	err = json.Unmarshal(data, &books)
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding dump books: %v", err)
+	}
+	return books, nil
+}
+
+// Entry returns the history listing for the snapshot at index
+func (s *Snapshot) Entry(index int) HistoryEntry {
+	return HistoryEntry{
+		Index:     index,
+		Time:      s.Time.Format(timeFormat),
+		Command:   s.Command,
+		Args:      s.Args,
+		RequestID: s.RequestID,
+		Scope:     s.Scope,
+	}
+}
+
+// Save writes the snapshot to the sender's history, discarding the oldest
+// snapshots beyond the configured limit
+func (s *Snapshot) Save(sender string) error {
+	dir, err := historyDir(sender)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(dir, fmt.Sprintf("%d-%s.json", s.Time.UnixNano(), s.Command))
+	err = os.WriteFile(filename, data, 0600)
+	if err != nil {
+		return err
+	}
+	snapshots, err := ReadHistory(sender)
+	if err != nil {
+		return err
+	}
+	limit := viper.GetInt("history_limit")
+	for i := limit; limit > 0 && i < len(snapshots); i++ {
+		err := os.Remove(snapshots[i].filename)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadHistory returns the sender's snapshots, most recent first
+func ReadHistory(sender string) ([]*Snapshot, error) {
+	dir, err := historyDir(sender)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []*Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []*Snapshot{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		filename := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		var snapshot Snapshot
+		err = json.Unmarshal(data, &snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading snapshot %s: %v", filename, err)
+		}
+		snapshot.filename = filename
+		snapshots = append(snapshots, &snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.After(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// run a configuration-changing command, saving a snapshot of the state it
+// modifies when the command succeeds or fails after making changes
+func runWithSnapshot(ctx context.Context, handler SnapshotCommand, rc *RequestContext) (any, error) {
+	scope, err := handler.SnapshotScope(rc)
+	if err != nil {
+		return nil, err
+	}
+	classScope := ClassScope{Sender: rc.Sender}
+	if aliased, ok := handler.(AliasCommand); ok {
+		classScope, err = aliased.ClassScope(rc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	snapshot, err := TakeSnapshot(ctx, rc, scope, classScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed saving %s snapshot: %w", scope, err)
+	}
+	if tables, ok := handler.(AliasTablesCommand); ok {
+		scopes, err := tables.AliasScopes(rc)
+		if err != nil {
+			return nil, err
+		}
+		if len(scopes) > 0 {
+			snapshot.Aliases, err = snapshotAliases(ctx, rc, scopes)
+			if err != nil {
+				return nil, fmt.Errorf("failed saving %s snapshot: %w", scope, err)
+			}
+		}
+	}
+	result, err := handler.Run(ctx, rc)
+	var partial *PartialError
+	if err != nil && !errors.As(err, &partial) {
+		return nil, err
+	}
+	saveErr := snapshot.Save(rc.Sender)
+	if saveErr != nil {
+		log.Printf("WARNING: failed writing history: %v\n", saveErr)
+	}
+	return result, err
+}
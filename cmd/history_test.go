@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDiffBooks(t *testing.T) {
+	before := map[string][]string{"friends": {"a@b.com"}, "work": {"c@d.com"}}
+	after := map[string][]string{"friends": {"a@b.com", "e@f.com"}, "family": {"g@h.com"}}
+	changes := diffBooks(before, after)
+	require.Len(t, changes, 3)
+	require.Equal(t, BookChange{Book: "family", Action: "create", Added: []string{"g@h.com"}}, changes[0])
+	require.Equal(t, "modify", changes[1].Action)
+	require.Equal(t, []string{"e@f.com"}, changes[1].Added)
+	require.Equal(t, BookChange{Book: "work", Action: "delete", Removed: []string{"c@d.com"}}, changes[2])
+}
+
+func TestHistory(t *testing.T) {
+	viper.Set("history_dir", t.TempDir())
+	viper.Set("history_limit", 2)
+	defer viper.Set("history_dir", "")
+	sender := "user@example.com"
+	start := time.Now()
+	for i, command := range []string{"set", "delete", "reset"} {
+		snapshot := Snapshot{Time: start.Add(time.Duration(i) * time.Second), Command: command, Scope: CLASSES_SCOPE}
+		require.Nil(t, snapshot.Save(sender))
+	}
+	snapshots, err := ReadHistory(sender)
+	require.Nil(t, err)
+	require.Len(t, snapshots, 2)
+	require.Equal(t, "reset", snapshots[0].Command)
+	require.Equal(t, "delete", snapshots[1].Command)
+
+	for arg, violation := range map[string]string{
+		"abc": "invalid history index: 'abc'",
+		"0":   "invalid history index: '0'",
+		"7":   "history index 7 out of range; 2 changes saved",
+	} {
+		rc := RequestContext{Sender: sender, Command: "undo", Args: []string{arg}}
+		_, _, err := undoSnapshot(&rc)
+		var invalid *ValidationError
+		require.True(t, errors.As(err, &invalid), arg)
+		require.Equal(t, []string{violation}, invalid.Violations)
+	}
+}
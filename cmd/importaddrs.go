@@ -0,0 +1,197 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const IMPORT_ADDRESS_LIMIT = 1000
+
+// importaddrsCmd represents the importaddrs command
+var importaddrsCmd = &cobra.Command{
+	Use:   "importaddrs BOOK_NAME FILE",
+	Short: "add email addresses from a contacts file",
+	Long: `
+Add every email address in a vCard (.vcf) or CSV contacts file to the named
+address book, creating the book if necessary.  When used with the email
+subject line command, the file is read from the first attachment of the
+message.  Each address is added with its contact's display name.  Addresses
+already in the book, or listed more than once, are skipped, and entries
+without a valid email address are reported as invalid.  A CSV file may have
+a heading row naming its email and name columns, as written by common mail
+clients; otherwise each field containing '@' is used as an address.  If
+the import fails partway, the failure response lists the addresses added
+and not added, and the undo command removes those added.
+`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		RunFileCommand(cmd, args)
+	},
+}
+
+// SkippedContact is a contact which was not added to the book
+type SkippedContact struct {
+	Contact
+	Reason string
+}
+
+type APIImportAddrsResponse struct {
+	APIResponse
+	Book     string
+	Added    []Contact
+	Skipped  []SkippedContact
+	Invalid  []InvalidContact
+	NotAdded []Contact `json:",omitempty"`
+}
+
+// importAddrsPlan holds the contacts to add to the book, the contacts
+// skipped, and the invalid file entries
+type importAddrsPlan struct {
+	Book    string
+	Create  bool
+	Added   []Contact
+	Skipped []SkippedContact
+	Invalid []InvalidContact
+}
+
+type importaddrsCommand struct{}
+
+func planImportAddrs(ctx context.Context, filterctl *APIClient, rc *RequestContext) (*importAddrsPlan, error) {
+	if len(rc.Args) != 1 {
+		return nil, fmt.Errorf("%s: expected BOOK_NAME argument", rc.Command)
+	}
+	plan := importAddrsPlan{Book: rc.Args[0], Added: []Contact{}, Skipped: []SkippedContact{}}
+	var request APIFileRequest
+	err := json.Unmarshal(rc.Body, &request)
+	if err != nil {
+		return nil, err
+	}
+	contacts, invalid, err := ParseContacts(request.Filename, []byte(request.Content))
+	if err != nil {
+		return nil, validationResult([]string{err.Error()})
+	}
+	if len(contacts) > IMPORT_ADDRESS_LIMIT {
+		return nil, validationResult([]string{fmt.Sprintf("%d addresses exceeds the limit of %d", len(contacts), IMPORT_ADDRESS_LIMIT)})
+	}
+	plan.Invalid = invalid
+	books, err := currentBooks(ctx, filterctl, rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[string]bool)
+	plan.Create = !hasBook(books, plan.Book)
+	if !plan.Create {
+		addresses, err := currentAddresses(ctx, filterctl, rc.Sender, plan.Book)
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range addresses {
+			present[strings.ToLower(address)] = true
+		}
+	}
+	added := make(map[string]bool)
+	for _, contact := range contacts {
+		switch {
+		case present[contact.Address]:
+			plan.Skipped = append(plan.Skipped, SkippedContact{Contact: contact, Reason: "already in book"})
+		case added[contact.Address]:
+			plan.Skipped = append(plan.Skipped, SkippedContact{Contact: contact, Reason: "listed more than once"})
+		default:
+			added[contact.Address] = true
+			plan.Added = append(plan.Added, contact)
+		}
+	}
+	return &plan, nil
+}
+
+func (importaddrsCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planImportAddrs(ctx, filterctl, rc)
+	if err != nil {
+		return nil, err
+	}
+	var response APIImportAddrsResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Book = plan.Book
+	response.Added = []Contact{}
+	response.Skipped = plan.Skipped
+	response.Invalid = plan.Invalid
+	for i, contact := range plan.Added {
+		_, err := AddNamedAddress(ctx, filterctl, rc.Sender, plan.Book, contact.Address, contact.Name)
+		if err != nil {
+			if i == 0 && !plan.Create {
+				return nil, err
+			}
+			// the book was changed, so report the addresses added before the
+			// failure and let the snapshot be saved for undo
+			response.NotAdded = plan.Added[i:]
+			response.Message = fmt.Sprintf("%s importaddrs %s failed: %d added, %d not added", rc.Sender, plan.Book, len(response.Added), len(response.NotAdded))
+			return nil, &PartialError{Result: &response, Err: err}
+		}
+		response.Added = append(response.Added, contact)
+	}
+	response.Success = true
+	response.Message = fmt.Sprintf("%s importaddrs %s: %d added, %d skipped, %d invalid", rc.Sender, plan.Book, len(response.Added), len(response.Skipped), len(response.Invalid))
+	return &response, nil
+}
+
+func (importaddrsCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planImportAddrs(ctx, filterctl, rc)
+	if err != nil {
+		return nil, err
+	}
+	addresses := []string{}
+	for _, contact := range plan.Added {
+		addresses = append(addresses, contact.Address)
+	}
+	changes := []BookChange{}
+	switch {
+	case plan.Create:
+		changes = append(changes, BookChange{Book: plan.Book, Action: "create", Added: addresses})
+	case len(addresses) > 0:
+		changes = append(changes, BookChange{Book: plan.Book, Action: "modify", Added: addresses})
+	}
+	return newDryRunResponse(rc, nil, changes), nil
+}
+
+func (importaddrsCommand) SnapshotScope(rc *RequestContext) (string, error) {
+	return BOOKS_SCOPE, nil
+}
+
+func init() {
+	rootCmd.AddCommand(importaddrsCmd)
+	RegisterFileCommand(importaddrsCmd, importaddrsCommand{})
+}
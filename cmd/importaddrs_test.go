@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rstms/filterctl/pkg/client"
+	"github.com/rstms/mabctl/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportAddrs(t *testing.T) {
+	configure(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	server.Filterctld.AddUser(sender, "test-password")
+	ctx := context.Background()
+
+	rc := RequestContext{Sender: sender, Command: "importaddrs", Args: []string{"friends"}, Body: fileRequest(t, "contacts.vcf", testVCards)}
+	result, err := importaddrsCommand{}.DryRun(ctx, &rc)
+	require.Nil(t, err)
+	require.Equal(t, []BookChange{{Book: "friends", Action: "create", Added: []string{"alice@example.com", "alice@home.example.org", "bob@example.com"}}}, result.(*APIDryRunResponse).Books)
+
+	result, err = importaddrsCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	response := result.(*APIImportAddrsResponse)
+	require.Len(t, response.Added, 3)
+	require.Empty(t, response.Skipped)
+	require.Len(t, response.Invalid, 2)
+	filterctl, err := NewFilterctlClient(&rc)
+	require.Nil(t, err)
+	addresses, err := currentAddresses(ctx, filterctl, sender, "friends")
+	require.Nil(t, err)
+	require.Equal(t, []string{"alice@example.com", "alice@home.example.org", "bob@example.com"}, addresses)
+
+	content := "Bob Builder <Bob@Example.com>\nDave,dave@example.com\nDave Again,dave@example.com\n"
+	rc = RequestContext{Sender: sender, Command: "importaddrs", Args: []string{"friends"}, Body: fileRequest(t, "more.csv", content)}
+	result, err = importaddrsCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	response = result.(*APIImportAddrsResponse)
+	require.Equal(t, []Contact{{Address: "dave@example.com", Name: "Dave"}}, response.Added)
+	require.Equal(t, []SkippedContact{
+		{Contact: Contact{Address: "bob@example.com", Name: "Bob Builder"}, Reason: "already in book"},
+		{Contact: Contact{Address: "dave@example.com", Name: "Dave Again"}, Reason: "listed more than once"},
+	}, response.Skipped)
+	require.Equal(t, "test@mailcapsule.io importaddrs friends: 1 added, 2 skipped, 0 invalid", response.Message)
+
+	content = strings.Repeat("someone@example.com\n", IMPORT_ADDRESS_LIMIT+1)
+	rc = RequestContext{Sender: sender, Command: "importaddrs", Args: []string{"friends"}, Body: fileRequest(t, "", content)}
+	_, err = importaddrsCommand{}.Run(ctx, &rc)
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid))
+}
+
+func TestImportAddrsPartialFailure(t *testing.T) {
+	configure(t)
+	setAliasesDir(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	server.Filterctld.Seed(sender, api.UserDump{Books: map[string][]string{"friends": {"carol@example.com"}}})
+	server.Filterctld.RejectAddress("bob@example.com")
+	ctx := context.Background()
+
+	rc := RequestContext{Sender: sender, Command: "importaddrs", Args: []string{"friends"}, Body: fileRequest(t, "contacts.vcf", testVCards)}
+	_, err := runWithSnapshot(ctx, importaddrsCommand{}, &rc)
+	var partial *PartialError
+	require.True(t, errors.As(err, &partial))
+	var apiErr *client.APIError
+	require.True(t, errors.As(err, &apiErr))
+	response := partial.Result.(*APIImportAddrsResponse)
+	require.False(t, response.Success)
+	require.Equal(t, []Contact{{Address: "alice@example.com", Name: "Alice Example"}, {Address: "alice@home.example.org", Name: "Alice Example"}}, response.Added)
+	require.Equal(t, []Contact{{Address: "bob@example.com", Name: "Bob Builder"}}, response.NotAdded)
+	require.Equal(t, []string{"carol@example.com", "alice@example.com", "alice@home.example.org"}, server.Filterctld.Books(sender)["friends"])
+
+	// the failure response reports the addresses which were added
+	data, status, err := commandFailureResponse(sender, rc.RequestID, rc.Command, partial)
+	require.Nil(t, err)
+	require.Equal(t, "rejected", status)
+	var failure struct {
+		Success bool
+		Partial APIImportAddrsResponse
+	}
+	require.Nil(t, json.Unmarshal(data, &failure))
+	require.False(t, failure.Success)
+	require.Len(t, failure.Partial.Added, 2)
+
+	// the snapshot was saved, so undo removes the added addresses
+	rc = RequestContext{Sender: sender, Command: "undo"}
+	_, err = runWithSnapshot(ctx, undoCommand{}, &rc)
+	require.Nil(t, err)
+	require.Equal(t, []string{"carol@example.com"}, server.Filterctld.Books(sender)["friends"])
+}
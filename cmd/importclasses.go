@@ -0,0 +1,188 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/spf13/cobra"
+)
+
+const IMPORT_REPLACE = "replace"
+const IMPORT_MERGE = "merge"
+
+// importclassesCmd represents the importclasses command
+var importclassesCmd = &cobra.Command{
+	Use:   "importclasses [+SUFFIX] [replace|merge] FILE",
+	Short: "import class table from a file",
+	Long: `
+Read a class table file in the yaml, csv or json format written by the
+exportclasses command.  A json file may also hold the response of the
+classes command, whose Classes list is imported.  When used with the email
+subject line command, the file is read from the first attachment, or from
+the message body if there is no attachment.  The format is selected by the
+attachment filename, or detected from the content.  In replace mode, the
+default, the file replaces the class table.  In merge mode, each class in
+the file is added or updated as with the set command, and other classes are
+kept.  The resulting class table must be valid, or nothing is changed.  A
+leading +SUFFIX argument imports the classes used for the sender's
+plus-suffix address.
+`,
+	Args: cobra.RangeArgs(1, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		RunFileCommand(cmd, args)
+	},
+}
+
+type APIImportClassesResponse struct {
+	APIResponse
+	Mode    string
+	Format  string
+	Changes []ClassChange
+	Classes []classes.SpamClass
+}
+
+// importPlan holds the class table imported from a file, the current class
+// table of the selected scope, whether the scope has its own table, and the
+// resulting table, which must be valid
+type importPlan struct {
+	Scope  ClassScope
+	Mode   string
+	Format string
+	Own    bool
+	Before []classes.SpamClass
+	After  []classes.SpamClass
+}
+
+type importclassesCommand struct{}
+
+func planImport(ctx context.Context, filterctl *APIClient, rc *RequestContext) (*importPlan, error) {
+	scope, args, err := parseClassScope(rc.Sender, rc.Args)
+	if err != nil {
+		return nil, err
+	}
+	plan := importPlan{Scope: scope, Mode: IMPORT_REPLACE}
+	if len(args) > 1 {
+		return nil, validationResult([]string{fmt.Sprintf("unexpected argument '%s'", args[1])})
+	}
+	if len(args) == 1 {
+		if args[0] != IMPORT_REPLACE && args[0] != IMPORT_MERGE {
+			return nil, validationResult([]string{fmt.Sprintf("unknown mode '%s'; expected %s or %s", args[0], IMPORT_REPLACE, IMPORT_MERGE)})
+		}
+		plan.Mode = args[0]
+	}
+	var request APIFileRequest
+	err = json.Unmarshal(rc.Body, &request)
+	if err != nil {
+		return nil, err
+	}
+	plan.Format = classFileFormat(request.Filename, []byte(request.Content))
+	table, err := parseClassFile(request.Filename, []byte(request.Content))
+	if err != nil {
+		return nil, err
+	}
+	plan.Before, plan.Own, err = scopeClasses(ctx, filterctl, scope)
+	if err != nil {
+		return nil, err
+	}
+	plan.After = table
+	if plan.Mode == IMPORT_MERGE {
+		violations := []string{}
+		names := make(map[string]bool)
+		plan.After = plan.Before
+		for _, class := range table {
+			if names[class.Name] {
+				violations = append(violations, fmt.Sprintf("class '%s' is listed more than once", class.Name))
+			}
+			names[class.Name] = true
+			plan.After = mergeClass(plan.After, class)
+		}
+		if len(violations) > 0 {
+			return nil, validationResult(violations)
+		}
+	}
+	err = validateClasses(plan.After)
+	if err != nil {
+		return nil, err
+	}
+	plan.After = normalizeClasses(plan.After)
+	return &plan, nil
+}
+
+func (importclassesCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planImport(ctx, filterctl, rc)
+	if err != nil {
+		return nil, err
+	}
+	changes := diffClasses(plan.Before, plan.After)
+	// a suffix without a table gets its own, even when it matches the
+	// sender's table, so later changes to the sender's table do not apply
+	if len(changes) > 0 || !plan.Own {
+		_, err = resetScopeClasses(ctx, filterctl, plan.Scope, plan.After)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var response APIImportClassesResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s importclasses %s: %d changes", plan.Scope.Address(), plan.Mode, len(changes))
+	response.Mode = plan.Mode
+	response.Format = plan.Format
+	response.Changes = changes
+	response.Classes = plan.After
+	return &response, nil
+}
+
+func (importclassesCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planImport(ctx, filterctl, rc)
+	if err != nil {
+		return nil, err
+	}
+	return newDryRunResponse(rc, diffClasses(plan.Before, plan.After), nil), nil
+}
+
+func (importclassesCommand) SnapshotScope(rc *RequestContext) (string, error) {
+	return CLASSES_SCOPE, nil
+}
+
+func (importclassesCommand) ClassScope(rc *RequestContext) (ClassScope, error) {
+	scope, _, err := parseClassScope(rc.Sender, rc.Args)
+	return scope, err
+}
+
+func init() {
+	rootCmd.AddCommand(importclassesCmd)
+	RegisterFileCommand(importclassesCmd, importclassesCommand{})
+}
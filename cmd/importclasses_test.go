@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/stretchr/testify/require"
+)
+
+func fileRequest(t *testing.T, filename, content string) []byte {
+	body, err := json.Marshal(&APIFileRequest{Filename: filename, Content: content})
+	require.Nil(t, err)
+	return body
+}
+
+func TestImportClasses(t *testing.T) {
+	configure(t)
+	setAliasesDir(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	server.Filterctld.AddUser(sender, "test-password")
+	ctx := context.Background()
+
+	rc := RequestContext{Sender: sender, Command: "importclasses", Args: []string{"merge"}, Body: fileRequest(t, "", "bulk,7\n")}
+	result, err := importclassesCommand{}.DryRun(ctx, &rc)
+	require.Nil(t, err)
+	require.Equal(t, []ClassChange{{Class: "bulk", Action: "add", New: score(7)}}, result.(*APIDryRunResponse).Classes)
+	require.Equal(t, classes.DefaultClasses, server.Filterctld.Classes(sender))
+
+	_, err = importclassesCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	merged := []classes.SpamClass{{Name: "ham", Score: 5}, {Name: "bulk", Score: 7}, {Name: "probable", Score: 10}, {Name: "spam", Score: 999}}
+	require.Equal(t, merged, server.Filterctld.Classes(sender))
+
+	rc = RequestContext{Sender: sender, Command: "importclasses", Body: fileRequest(t, "classes.yaml", "ham: 2\nspam: 999\n")}
+	result, err = importclassesCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	require.Equal(t, IMPORT_REPLACE, result.(*APIImportClassesResponse).Mode)
+	require.Equal(t, []classes.SpamClass{{Name: "ham", Score: 2}, {Name: "spam", Score: 999}}, server.Filterctld.Classes(sender))
+
+	rc = RequestContext{Sender: sender, Command: "importclasses", Args: []string{"+lists"}, Body: fileRequest(t, "", `[{"name": "ham", "score": 1}, {"name": "spam", "score": 999}]`)}
+	_, err = importclassesCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	require.Equal(t, []classes.SpamClass{{Name: "ham", Score: 1}, {Name: "spam", Score: 999}}, server.Filterctld.Classes("test+lists@mailcapsule.io"))
+
+	// a suffix importing the sender's table still gets a table of its own
+	rc = RequestContext{Sender: sender, Command: "importclasses", Args: []string{"+shop"}, Body: fileRequest(t, "", "ham: 2\nspam: 999\n")}
+	result, err = importclassesCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	require.Empty(t, result.(*APIImportClassesResponse).Changes)
+	suffixes, err := ReadAliases(sender)
+	require.Nil(t, err)
+	require.Equal(t, []string{"lists", "shop"}, suffixes)
+	require.Equal(t, []classes.SpamClass{{Name: "ham", Score: 2}, {Name: "spam", Score: 999}}, server.Filterctld.Classes("test+shop@mailcapsule.io"))
+
+	cases := []struct {
+		Args       []string
+		Content    string
+		Violations []string
+	}{
+		{[]string{"append"}, "ham,3\n", []string{"unknown mode 'append'; expected replace or merge"}},
+		{[]string{"merge"}, "ham,3\nham,4\n", []string{"class 'ham' is listed more than once"}},
+		{nil, "ham,3\n", []string{"the table must end with the 'spam' class: spam=999"}},
+		{[]string{"merge", "extra"}, "ham,3\n", []string{"unexpected argument 'extra'"}},
+	}
+	for _, c := range cases {
+		rc := RequestContext{Sender: sender, Command: "importclasses", Args: c.Args, Body: fileRequest(t, "", c.Content)}
+		_, err := importclassesCommand{}.Run(ctx, &rc)
+		var invalid *ValidationError
+		require.True(t, errors.As(err, &invalid), c.Content)
+		require.Equal(t, c.Violations, invalid.Violations, c.Content)
+	}
+	require.Equal(t, []classes.SpamClass{{Name: "ham", Score: 2}, {Name: "spam", Score: 999}}, server.Filterctld.Classes(sender))
+}
+
+func TestExportClasses(t *testing.T) {
+	configure(t)
+	setAliasesDir(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	server.Filterctld.AddUser(sender, "test-password")
+	ctx := context.Background()
+
+	rc := RequestContext{Sender: sender, Command: "exportclasses", Args: []string{"+lists", "JSON"}}
+	result, err := exportclassesCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	response := result.(*APIExportClassesResponse)
+	require.Equal(t, "classes+lists.json", response.Attachment.Filename)
+	require.Equal(t, "application/json", response.Attachment.ContentType)
+	table, err := parseClassFile(response.Attachment.Filename, []byte(response.Attachment.Content))
+	require.Nil(t, err)
+	require.Equal(t, classes.DefaultClasses, table)
+
+	rc = RequestContext{Sender: sender, Command: "exportclasses", Args: []string{"xml"}}
+	_, err = exportclassesCommand{}.Run(ctx, &rc)
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid))
+
+	rc = RequestContext{Sender: sender, Command: "exportclasses", Args: []string{"csv", "extra"}}
+	_, err = exportclassesCommand{}.Run(ctx, &rc)
+	require.True(t, errors.As(err, &invalid), err)
+	require.Equal(t, []string{"unexpected argument 'extra'"}, invalid.Violations)
+}
@@ -0,0 +1,324 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Job is a command scheduled to run later with the sender's identity.  A
+// job with a Schedule runs repeatedly; otherwise it is removed after it runs.
+type Job struct {
+	ID        string
+	Sender    string
+	Command   string
+	Args      []string
+	Schedule  string `json:",omitempty"`
+	Next      time.Time
+	Created   time.Time
+	RequestID string
+}
+
+type JobEntry struct {
+	ID       string
+	Command  string
+	Args     []string
+	Schedule string `json:",omitempty"`
+	Next     string
+}
+
+type APIJobsResponse struct {
+	APIResponse
+	Jobs []JobEntry
+}
+
+type APIJobResponse struct {
+	APIResponse
+	DryRun bool `json:",omitempty"`
+	Job    JobEntry
+}
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "list scheduled commands",
+	Long: `
+List the commands scheduled for the sender with the 'at' and 'every'
+commands, in the order they will next run.  The ID value is the argument
+used with the canceljob command.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		RunCommand(cmd, args, nil)
+	},
+}
+
+type jobsCommand struct{}
+
+func (jobsCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	jobs, err := ReadJobs(rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	var response APIJobsResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s jobs: %d scheduled", rc.Sender, len(jobs))
+	response.Jobs = []JobEntry{}
+	for _, job := range jobs {
+		response.Jobs = append(response.Jobs, job.Entry())
+	}
+	return &response, nil
+}
+
+func init() {
+	rootCmd.AddCommand(jobsCmd)
+	RegisterCommand(jobsCmd, jobsCommand{})
+}
+
+func (j *Job) Entry() JobEntry {
+	return JobEntry{
+		ID:       j.ID,
+		Command:  j.Command,
+		Args:     j.Args,
+		Schedule: j.Schedule,
+		Next:     j.Next.Format(timeFormat),
+	}
+}
+
+func newJobResponse(rc *RequestContext, job *Job, message string) *APIJobResponse {
+	var response APIJobResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s %s: %s", rc.Sender, rc.Command, message)
+	response.Job = job.Entry()
+	return &response
+}
+
+// return a dry run response describing a job which is not saved
+func newJobDryRunResponse(rc *RequestContext, job *Job, message string) *APIJobResponse {
+	response := newJobResponse(rc, job, message)
+	response.DryRun = true
+	return response
+}
+
+// NewJob validates a scheduled command line from the arguments of the at
+// or every command.  Problems with the command line are returned as a
+// ValidationError.
+func NewJob(rc *RequestContext, schedule string, next time.Time, args []string) (*Job, error) {
+	command := args[0]
+	c, ok := commands[command]
+	if !ok {
+		return nil, validationResult([]string{fmt.Sprintf("unknown command: %s", command)})
+	}
+	if c.body || c.nested || command == rc.Command {
+		return nil, validationResult([]string{fmt.Sprintf("command '%s' cannot be scheduled", command)})
+	}
+	switch command {
+	case "jobs", "canceljob":
+		return nil, validationResult([]string{fmt.Sprintf("command '%s' cannot be scheduled", command)})
+	}
+	jobArgs := append([]string{}, args[1:]...)
+	check := RequestContext{Sender: rc.Sender, RequestID: rc.RequestID, Command: command, Args: append([]string{}, jobArgs...)}
+	err := check.checkArgs(c)
+	if err != nil {
+		return nil, validationResult([]string{err.Error()})
+	}
+	id := make([]byte, 4)
+	_, err = rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	job := Job{
+		ID:        hex.EncodeToString(id),
+		Sender:    rc.Sender,
+		Command:   command,
+		Args:      jobArgs,
+		Schedule:  schedule,
+		Next:      next,
+		Created:   time.Now(),
+		RequestID: rc.RequestID,
+	}
+	return &job, nil
+}
+
+// AddJob writes a job to the sender's schedule
+func AddJob(job *Job) error {
+	return UpdateJobs(job.Sender, func(jobs []*Job) ([]*Job, error) {
+		err := checkJobLimit(jobs)
+		if err != nil {
+			return nil, err
+		}
+		return append(jobs, job), nil
+	})
+}
+
+// return a ValidationError if no more jobs may be added to the schedule
+func checkJobLimit(jobs []*Job) error {
+	limit := viper.GetInt("jobs_limit")
+	if limit > 0 && len(jobs) >= limit {
+		return validationResult([]string{fmt.Sprintf("scheduled job limit %d reached", limit)})
+	}
+	return nil
+}
+
+// return a ValidationError if the job could not be added to the sender's
+// schedule
+func checkAddJob(job *Job) error {
+	jobs, err := ReadJobs(job.Sender)
+	if err != nil {
+		return err
+	}
+	return checkJobLimit(jobs)
+}
+
+// return the sender's schedule filename
+func jobsFile(sender string) (string, error) {
+	path, err := userPath("jobs_dir", sender)
+	if err != nil {
+		return "", err
+	}
+	return path + ".json", nil
+}
+
+// UpdateJobs replaces the sender's scheduled jobs with the result of update.
+// An exclusive lock serializes updates from concurrent filterctl processes.
+func UpdateJobs(sender string, update func([]*Job) ([]*Job, error)) error {
+	filename, err := jobsFile(sender)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("failed opening job schedule: %v", err)
+	}
+	defer file.Close()
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		return fmt.Errorf("failed locking job schedule: %v", err)
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	jobs, err := decodeJobs(file, filename)
+	if err != nil {
+		return err
+	}
+	jobs, err = update(jobs)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Next.Before(jobs[j].Next)
+	})
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteAt(data, 0)
+	if err != nil {
+		return fmt.Errorf("failed writing job schedule: %v", err)
+	}
+	return file.Sync()
+}
+
+// ReadJobs returns the sender's scheduled jobs, next to run first
+func ReadJobs(sender string) ([]*Job, error) {
+	filename, err := jobsFile(sender)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return []*Job{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed opening job schedule: %v", err)
+	}
+	defer file.Close()
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_SH)
+	if err != nil {
+		return nil, fmt.Errorf("failed locking job schedule: %v", err)
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	return decodeJobs(file, filename)
+}
+
+func decodeJobs(file io.Reader, filename string) ([]*Job, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	jobs := []*Job{}
+	if len(data) == 0 {
+		return jobs, nil
+	}
+	err = json.Unmarshal(data, &jobs)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading job schedule %s: %v", filename, err)
+	}
+	return jobs, nil
+}
+
+// JobSenders returns the usernames having a job schedule
+func JobSenders() ([]string, error) {
+	dir, err := GetViperPath("jobs_dir")
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	senders := []string{}
+	for _, entry := range entries {
+		sender, ok := strings.CutSuffix(entry.Name(), ".json")
+		if ok && !entry.IsDir() {
+			senders = append(senders, sender)
+		}
+	}
+	return senders, nil
+}
@@ -0,0 +1,211 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+)
+
+// SpamHeaders holds the spam filter headers of a stored message
+type SpamHeaders struct {
+	MessageID string `json:",omitempty"`
+	Subject   string `json:",omitempty"`
+	Score     float32
+	Class     string `json:",omitempty"`
+}
+
+// ReadMailbox returns the spam headers of each message in a Maildir
+// directory or mbox file, and the number of messages skipped because they
+// have no valid X-Spam-Score header
+func ReadMailbox(path string) ([]SpamHeaders, int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.IsDir() {
+		return readMaildir(path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	return readMbox(file)
+}
+
+// read the messages in the cur and new subdirectories of a Maildir
+func readMaildir(dir string) ([]SpamHeaders, int, error) {
+	messages := []SpamHeaders{}
+	skipped := 0
+	found := false
+	for _, subdir := range []string{"cur", "new"} {
+		entries, err := os.ReadDir(filepath.Join(dir, subdir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		found = true
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			filename := filepath.Join(dir, subdir, entry.Name())
+			headers, ok, err := readMaildirMessage(filename)
+			if err != nil {
+				return nil, 0, err
+			}
+			if ok {
+				messages = append(messages, headers)
+			} else {
+				skipped++
+			}
+		}
+	}
+	if !found {
+		return nil, 0, fmt.Errorf("not a Maildir: %s", dir)
+	}
+	return messages, skipped, nil
+}
+
+func readMaildirMessage(filename string) (SpamHeaders, bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return SpamHeaders{}, false, err
+	}
+	defer file.Close()
+	header, err := textproto.ReadHeader(bufio.NewReader(file))
+	if err != nil {
+		return SpamHeaders{}, false, fmt.Errorf("failed reading message %s: %v", filename, err)
+	}
+	headers, ok := spamHeaders(header)
+	return headers, ok, nil
+}
+
+// read the messages of an mbox file, each beginning with a 'From ' line
+// at the start of the file or following an empty line
+func readMbox(r io.Reader) ([]SpamHeaders, int, error) {
+	messages := []SpamHeaders{}
+	skipped := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MAX_BODY_SIZE)
+	var header bytes.Buffer
+	inHeader := false
+	blank := true
+	started := false
+	finish := func() error {
+		if !inHeader {
+			return nil
+		}
+		header.WriteString("\r\n")
+		parsed, err := textproto.ReadHeader(bufio.NewReader(&header))
+		if err != nil {
+			return fmt.Errorf("failed reading mbox message %d: %v", len(messages)+skipped+1, err)
+		}
+		headers, ok := spamHeaders(parsed)
+		if ok {
+			messages = append(messages, headers)
+		} else {
+			skipped++
+		}
+		header.Reset()
+		inHeader = false
+		return nil
+	}
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if blank && strings.HasPrefix(line, "From ") {
+			// the previous message ends at the separator if its header
+			// was not terminated
+			err := finish()
+			if err != nil {
+				return nil, 0, err
+			}
+			inHeader = true
+			started = true
+			blank = false
+			continue
+		}
+		if !started {
+			return nil, 0, fmt.Errorf("not an mbox file: missing 'From ' line")
+		}
+		blank = line == ""
+		if inHeader {
+			if blank {
+				err := finish()
+				if err != nil {
+					return nil, 0, err
+				}
+				continue
+			}
+			header.WriteString(line)
+			header.WriteString("\r\n")
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, 0, err
+	}
+	err = finish()
+	if err != nil {
+		return nil, 0, err
+	}
+	return messages, skipped, nil
+}
+
+// return the spam headers from a message header, and false if the header
+// has no valid X-Spam-Score value.  Only the first field of the score is
+// used, so a value such as '3.2 / 15.0' is accepted.
+func spamHeaders(h textproto.Header) (SpamHeaders, bool) {
+	header := mail.Header{Header: message.Header{Header: h}}
+	fields := strings.Fields(header.Get("X-Spam-Score"))
+	if len(fields) == 0 {
+		return SpamHeaders{}, false
+	}
+	score, err := strconv.ParseFloat(fields[0], 32)
+	if err != nil || math.IsNaN(score) || math.IsInf(score, 0) {
+		return SpamHeaders{}, false
+	}
+	headers := SpamHeaders{
+		Score: float32(score),
+		Class: strings.TrimSpace(header.Get("X-Spam-Class")),
+	}
+	headers.MessageID, _ = header.MessageID()
+	headers.Subject, err = header.Subject()
+	if err != nil {
+		headers.Subject = header.Get("Subject")
+	}
+	return headers, true
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-message/textproto"
+	"github.com/stretchr/testify/require"
+)
+
+func testMessage(id, subject, score, class string) string {
+	message := "From: sender@example.org\r\nTo: test@mailcapsule.io\r\n"
+	message += "Message-ID: <" + id + ">\r\nSubject: " + subject + "\r\n"
+	if score != "" {
+		message += "X-Spam-Score: " + score + "\r\n"
+	}
+	if class != "" {
+		message += "X-Spam-Class: " + class + "\r\n"
+	}
+	return message + "\r\nFrom the body of " + id + "\r\n\r\nFrom here on\r\n"
+}
+
+var testSpamHeaders = []SpamHeaders{
+	{MessageID: "one@example.org", Subject: "first", Score: -2.5, Class: "ham"},
+	{MessageID: "two@example.org", Subject: "café", Score: 7, Class: "probable"},
+	{MessageID: "four@example.org", Subject: "fourth", Score: 12.5},
+}
+
+func writeTestMessages() []string {
+	return []string{
+		testMessage("one@example.org", "first", "-2.5", "ham"),
+		testMessage("two@example.org", "=?utf-8?q?caf=C3=A9?=", "7 / 15", "probable"),
+		testMessage("three@example.org", "unscored", "", ""),
+		testMessage("four@example.org", "fourth", "12.5", ""),
+	}
+}
+
+func TestReadMaildir(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, os.Mkdir(filepath.Join(dir, "cur"), 0700))
+	require.Nil(t, os.Mkdir(filepath.Join(dir, "new"), 0700))
+	for i, message := range writeTestMessages() {
+		subdir := "cur"
+		if i == 3 {
+			subdir = "new"
+		}
+		filename := filepath.Join(dir, subdir, string(rune('a'+i))+".mail:2,S")
+		require.Nil(t, os.WriteFile(filename, []byte(message), 0600))
+	}
+	messages, skipped, err := ReadMailbox(dir)
+	require.Nil(t, err)
+	require.Equal(t, 1, skipped)
+	require.Equal(t, testSpamHeaders, messages)
+
+	_, _, err = ReadMailbox(t.TempDir())
+	require.ErrorContains(t, err, "not a Maildir")
+}
+
+func TestReadMbox(t *testing.T) {
+	mbox := ""
+	for _, message := range writeTestMessages() {
+		mbox += "From sender@example.org Sat Oct 17 12:00:00 2026\n"
+		// mbox writers quote body lines beginning with 'From '
+		message = strings.ReplaceAll(message, "\r\n", "\n")
+		mbox += strings.ReplaceAll(message, "\nFrom ", "\n>From ") + "\n"
+	}
+	filename := filepath.Join(t.TempDir(), "mbox")
+	require.Nil(t, os.WriteFile(filename, []byte(mbox), 0600))
+	messages, skipped, err := ReadMailbox(filename)
+	require.Nil(t, err)
+	require.Equal(t, 1, skipped)
+	require.Equal(t, testSpamHeaders, messages)
+
+	messages, skipped, err = readMbox(strings.NewReader(""))
+	require.Nil(t, err)
+	require.Empty(t, messages)
+	require.Zero(t, skipped)
+
+	_, _, err = readMbox(strings.NewReader(testMessage("x@example.org", "x", "1", "")))
+	require.ErrorContains(t, err, "not an mbox file")
+}
+
+func TestSpamHeadersScore(t *testing.T) {
+	for score, valid := range map[string]bool{"3.2 / 15.0": true, "-1": true, "NaN": false, "+Inf": false, "-inf": false, "1e40": false, "high": false} {
+		header, err := textproto.ReadHeader(bufio.NewReader(strings.NewReader(testMessage("x@example.org", "x", score, ""))))
+		require.Nil(t, err)
+		_, ok := spamHeaders(header)
+		require.Equal(t, valid, ok, score)
+	}
+}
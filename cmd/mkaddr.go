@@ -22,12 +22,13 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
 	"strings"
 
+	"github.com/rstms/filterctl/pkg/client"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var mkaddrCmd = &cobra.Command{
@@ -38,57 +39,101 @@ Add an email address to the named address book
 `,
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		filterctl := NewFilterctlClient()
-		type Request struct {
-			Username string
-			Bookname string
-			Address  string
-			Name     string
-		}
-		request := Request{
-			Username: viper.GetString("sender"),
-			Bookname: args[0],
-			Address:  args[1],
+		RunCommand(cmd, args, nil)
+	},
+}
+
+type mkaddrCommand struct{}
+
+func (mkaddrCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	return AddAddress(ctx, filterctl, rc.Sender, rc.Args[0], rc.Args[1])
+}
+
+func (mkaddrCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	bookname := rc.Args[0]
+	address := rc.Args[1]
+	books, err := currentBooks(ctx, filterctl, rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	changes := []BookChange{}
+	if !hasBook(books, bookname) {
+		changes = append(changes, BookChange{Book: bookname, Action: "create", Added: []string{address}})
+	} else {
+		before, err := currentAddresses(ctx, filterctl, rc.Sender, bookname)
+		if err != nil {
+			return nil, err
 		}
-		var response APIResponse
-		for {
-			text, err := filterctl.Post("/filterctl/address/", &request, &response)
-			cobra.CheckErr(err)
-			switch {
-			case strings.Contains(response.Message, "AddAddress failed: Unknown user:"):
-				_, err := AddUser(filterctl, request.Username, "", "")
-				cobra.CheckErr(err)
-			case strings.Contains(response.Message, "QueryAddressBook failed: 404 Not Found"):
-				_, err := AddAddressBook(filterctl, request.Username, request.Bookname, "")
-				cobra.CheckErr(err)
-			default:
-				fmt.Println(text)
-				return
-			}
+		added, _ := diffAddresses(before, append(before, address))
+		if len(added) > 0 {
+			changes = append(changes, BookChange{Book: bookname, Action: "modify", Added: added})
 		}
-	},
+	}
+	return newDryRunResponse(rc, nil, changes), nil
+}
+
+func (mkaddrCommand) SnapshotScope(rc *RequestContext) (string, error) {
+	return BOOKS_SCOPE, nil
 }
 
 func init() {
 	rootCmd.AddCommand(mkaddrCmd)
+	RegisterCommand(mkaddrCmd, mkaddrCommand{})
 }
 
-func AddUser(filterctl *APIClient, username, email, password string) (string, error) {
-	type Request struct {
-		Username string
-		Email    string
-		Password string
-	}
-	request := Request{
-		Username: username,
-		Email:    email,
-		Password: password,
+// AddAddress adds an address to a book, creating the user and book if necessary
+func AddAddress(ctx context.Context, filterctl *APIClient, username, bookname, address string) (*APIResponse, error) {
+	return AddNamedAddress(ctx, filterctl, username, bookname, address, "")
+}
+
+// AddNamedAddress adds an address with a display name to a book, creating the
+// user and book if necessary
+func AddNamedAddress(ctx context.Context, filterctl *APIClient, username, bookname, address, name string) (*APIResponse, error) {
+	for {
+		response, err := filterctl.AddAddress(ctx, username, bookname, address, name)
+		// the server may report an unknown user or book as an error status
+		var message string
+		var apiErr *client.APIError
+		switch {
+		case errors.As(err, &apiErr):
+			message = apiErr.Message
+		case err != nil:
+			return nil, err
+		default:
+			message = response.Message
+		}
+		switch {
+		case strings.Contains(message, "AddAddress failed: Unknown user:"):
+			_, err := AddUser(ctx, filterctl, username, "", "")
+			if err != nil {
+				return nil, err
+			}
+		case strings.Contains(message, "QueryAddressBook failed: 404 Not Found"):
+			_, err := AddAddressBook(ctx, filterctl, username, bookname, "")
+			if err != nil {
+				return nil, err
+			}
+		case err != nil:
+			return nil, err
+		default:
+			return response, nil
+		}
 	}
-	var response APIResponse
-	result, err := filterctl.Post("/filterctl/user/", &request, &response)
+}
+
+func AddUser(ctx context.Context, filterctl *APIClient, username, email, password string) (*APIResponse, error) {
+	response, err := filterctl.AddUser(ctx, username, email, password)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	log.Printf("AddUser: %s\n", result)
-	return result, nil
+	log.Printf("AddUser: %s\n", response.Message)
+	return response, nil
 }
@@ -22,11 +22,10 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"context"
 	"log"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var mkbookCmd = &cobra.Command{
@@ -38,39 +37,56 @@ DESCRIPTION.  Returns a data structure including the new book token and URI
 `,
 	Args: cobra.RangeArgs(1, 2),
 	Run: func(cmd *cobra.Command, args []string) {
-		bookName := args[0]
-		description := bookName
-		if len(args) > 1 {
-			description = args[1]
-		}
-		filterctl := NewFilterctlClient()
-		text, err := AddAddressBook(filterctl, viper.GetString("sender"), bookName, description)
-		cobra.CheckErr(err)
-		fmt.Println(text)
+		RunCommand(cmd, args, nil)
 	},
 }
 
-func init() {
-	rootCmd.AddCommand(mkbookCmd)
-}
+type mkbookCommand struct{}
 
-func AddAddressBook(filterctl *APIClient, username, bookname, description string) (string, error) {
-	type Request struct {
-		Username    string
-		Bookname    string
-		Description string
+func (mkbookCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	bookName := rc.Args[0]
+	description := bookName
+	if len(rc.Args) > 1 {
+		description = rc.Args[1]
 	}
-	request := Request{
-		Username:    username,
-		Bookname:    bookname,
-		Description: description,
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
 	}
-	var response APIResponse
-	result, err := filterctl.Post("/filterctl/book/", &request, &response)
+	return AddAddressBook(ctx, filterctl, rc.Sender, bookName, description)
+}
+
+func (mkbookCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	bookname := rc.Args[0]
+	books, err := currentBooks(ctx, filterctl, rc.Sender)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	changes := []BookChange{}
+	if !hasBook(books, bookname) {
+		changes = append(changes, BookChange{Book: bookname, Action: "create"})
 	}
-	log.Printf("AddAddressBook: %s\n", result)
-	return result, nil
+	return newDryRunResponse(rc, nil, changes), nil
+}
+
+func (mkbookCommand) SnapshotScope(rc *RequestContext) (string, error) {
+	return BOOKS_SCOPE, nil
+}
 
+func init() {
+	rootCmd.AddCommand(mkbookCmd)
+	RegisterCommand(mkbookCmd, mkbookCommand{})
+}
+
+func AddAddressBook(ctx context.Context, filterctl *APIClient, username, bookname, description string) (*APIResponse, error) {
+	response, err := filterctl.AddBook(ctx, username, bookname, description)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("AddAddressBook: %s\n", response.Message)
+	return response, nil
 }
@@ -25,13 +25,13 @@ import (
 	//"bufio"
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/emersion/go-message/mail"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
 	"os/user"
@@ -50,6 +50,9 @@ var MOZ_HEADERS_TABLE_HEADER_PATTERN = regexp.MustCompile(`<th [^>]*>([a-zA-Z]+)
 var MOZ_HEADERS_TABLE_ADDRESS_PATTERN = regexp.MustCompile(`.*<a class="moz-txt-link.*" href="mailto:([^"]*)">[^<]*</a>.*`)
 var MOZ_HEADERS_TABLE_END_PATTERN = regexp.MustCompile(`</table>`)
 
+// the maximum size of the JSON data in a command message body
+const MAX_BODY_SIZE = 1024 * 1024
+
 var Headers map[string]string
 var ReceivedCount int
 
@@ -68,7 +71,7 @@ If the program is called with no arguments, this subcommand is run by default,
 suitable for inclusion in a .forward file.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		cobra.CheckErr(ParseFile(os.Stdin))
+		cobra.CheckErr(ParseFile(cmd.Context(), os.Stdin))
 	},
 }
 
@@ -76,23 +79,27 @@ func init() {
 	rootCmd.AddCommand(parseCmd)
 }
 
-func ParseFile(input io.Reader) error {
+func ParseFile(ctx context.Context, input io.Reader) error {
 
 	if viper.GetBool("verbose") {
 		log.Println("BEGIN-INPUT")
-		content, err := ioutil.ReadAll(input)
-		cobra.CheckErr(err)
+		content, err := io.ReadAll(input)
+		if err != nil {
+			return fmt.Errorf("failed reading message: %v", err)
+		}
 		log.Print(string(content))
 		log.Println("END-INPUT")
 		input = bytes.NewBuffer(content)
 	}
 
 	m, err := mail.CreateReader(input)
-	cobra.CheckErr(err)
+	if err != nil {
+		return fmt.Errorf("failed parsing message: %v", err)
+	}
 	printHeaders("message", &m.Header)
 	messageID := m.Header.Get("Message-ID")
 	if messageID == "" {
-		return fmt.Errorf("missing Message-ID header")
+		return rejectMessage(m.Header, "", "", fmt.Errorf("missing Message-ID header"))
 	}
 	// use the custom request ID header as the messageID if present
 	requestID := m.Header.Get("X-Filterctl-Request-Id")
@@ -100,10 +107,22 @@ func ParseFile(input io.Reader) error {
 		requestID = messageID
 	}
 	requestID = strings.Trim(requestID, "<>")
-	sender, username := checkSender(m.Header)
-	checkDKIM(m.Header)
-	recipient, suffix := checkRecipient(m.Header)
-	checkReceived(m.Header, username, suffix)
+	sender, username, err := checkSender(m.Header)
+	if err != nil {
+		return rejectMessage(m.Header, requestID, "", err)
+	}
+	err = checkDKIM(m.Header)
+	if err != nil {
+		return rejectMessage(m.Header, requestID, sender, err)
+	}
+	recipient, suffix, err := checkRecipient(m.Header)
+	if err != nil {
+		return rejectMessage(m.Header, requestID, sender, err)
+	}
+	err = checkReceived(m.Header, username, suffix)
+	if err != nil {
+		return rejectMessage(m.Header, requestID, sender, err)
+	}
 
 	if viper.GetBool("verbose") {
 		log.Println("BEGIN-ID")
@@ -119,51 +138,67 @@ func ParseFile(input io.Reader) error {
 	}
 
 	if suffix != "" {
-		return handleForwardedMessage(m, sender, suffix, requestID)
+		return handleForwardedMessage(ctx, m, sender, suffix, requestID)
 	}
-	return handleCommandMessage(m, sender, requestID)
+	return handleCommandMessage(ctx, m, sender, requestID)
 }
 
-func handleForwardedMessage(m *mail.Reader, sender, suffix, messageID string) error {
+// record the authorization failure and return it
+func rejectMessage(header mail.Header, requestID, sender string, err error) error {
+	log.Printf("rejected: %v\n", err)
+	record := AuditRecord{
+		Sender:     sender,
+		RequestID:  requestID,
+		Authorized: false,
+		Reason:     err.Error(),
+		Status:     "rejected",
+	}
+	subject, subjectErr := header.Subject()
+	if subjectErr == nil {
+		fields := strings.Fields(subject)
+		if len(fields) > 0 {
+			record.Command = fields[0]
+			record.Args = fields[1:]
+		}
+	}
+	audit(record)
+	return fmt.Errorf("rejected: %v", err)
+}
 
-	address := parseForwardedBody(m, suffix)
+func handleForwardedMessage(ctx context.Context, m *mail.Reader, sender, suffix, messageID string) error {
 
-	if address == "" {
-		return fmt.Errorf("plus-suffix forwarded from address not found")
+	address, err := parseForwardedBody(m, suffix)
+	if err != nil {
+		return err
 	}
 	args := []string{"mkaddr", suffix, address}
 	log.Printf("handleForwardedMessage: %v", args)
-	return ExecuteCommand(sender, messageID, args)
-}
-
-func commandHasBodyData(command string) bool {
-	switch command {
-	case "accounts":
-		return true
-	case "rescan":
-		return true
-	case "restore":
-		return true
-	}
-	return false
+	return ExecuteCommand(ctx, sender, messageID, args, nil)
 }
 
-func handleCommandMessage(m *mail.Reader, sender, messageID string) error {
+func handleCommandMessage(ctx context.Context, m *mail.Reader, sender, messageID string) error {
 	subject, err := m.Header.Subject()
-	cobra.CheckErr(err)
-	fields := strings.Split(subject, " ")
+	if err != nil {
+		return fmt.Errorf("failed decoding Subject: %v", err)
+	}
+	fields := strings.Fields(subject)
 	if len(fields) == 0 {
 		fields = []string{"help"}
 	}
 
-	if len(fields) > 0 {
-		command := fields[0]
-		if commandHasBodyData(command) {
-			filename := parseJSONBody(m, command)
-			fields = append(fields, filename)
+	var body []byte
+	if commandHasFileData(fields[0]) {
+		body, err = parseFileBody(m, fields[0])
+		if err != nil {
+			return err
+		}
+	} else if commandHasBodyData(fields[0]) {
+		body, err = parseJSONBody(m, fields[0])
+		if err != nil {
+			return err
 		}
 	}
-	return ExecuteCommand(sender, messageID, fields)
+	return ExecuteCommand(ctx, sender, messageID, fields, body)
 }
 
 func printHeaders(name string, header *mail.Header) {
@@ -177,18 +212,18 @@ func printHeaders(name string, header *mail.Header) {
 	}
 }
 
-func checkDKIM(header mail.Header) {
+func checkDKIM(header mail.Header) error {
 
 	fields := header.FieldsByKey("Dkim-Signature")
 	signature := ""
 	for fields.Next() {
 		if signature != "" {
-			log.Fatal("multiple DKIM signatures detected")
+			return fmt.Errorf("multiple DKIM signatures detected")
 		}
 		signature = fields.Value()
 	}
 	if signature == "" {
-		log.Fatal("missing DKIM signature")
+		return fmt.Errorf("missing DKIM signature")
 	}
 
 	for _, field := range strings.Split(signature, ";") {
@@ -197,27 +232,27 @@ func checkDKIM(header mail.Header) {
 		if len(matches) == 2 {
 			for _, domain := range Domains {
 				if matches[1] == domain {
-					return
+					return nil
 				}
 			}
 		}
 	}
-	log.Fatal("domain not found in DKIM Signature")
+	return fmt.Errorf("domain not found in DKIM Signature")
 }
 
 // verify single received line, matching username and plus-suffix
-func checkReceived(header mail.Header, username, suffix string) {
+func checkReceived(header mail.Header, username, suffix string) error {
 
 	fields := header.FieldsByKey("Received")
 	received := ""
 	for fields.Next() {
 		if received != "" {
-			log.Fatal("multiple Received headers detected")
+			return fmt.Errorf("multiple Received headers detected")
 		}
 		received = fields.Value()
 	}
 	if received == "" {
-		log.Fatal("missing Received header")
+		return fmt.Errorf("missing Received header")
 	}
 
 	//log.Printf("Received: %s\n", received)
@@ -231,7 +266,7 @@ func checkReceived(header mail.Header, username, suffix string) {
 	*/
 
 	if len(matches) != 5 {
-		log.Fatalf("Received: parse failed: %s", received)
+		return fmt.Errorf("Received: parse failed: %s", received)
 	}
 	rxHostname := matches[1]
 	rxUsername := matches[2]
@@ -241,39 +276,41 @@ func checkReceived(header mail.Header, username, suffix string) {
 	rxSuffix = strings.TrimPrefix(rxSuffix, "+")
 
 	if rxHostname != Hostname {
-		log.Fatalf("Received: hostname mismatch; expected %s, got %s", Hostname, rxHostname)
+		return fmt.Errorf("Received: hostname mismatch; expected %s, got %s", Hostname, rxHostname)
 	}
 
 	if rxUsername != username {
-		log.Fatalf("Received: user mismatch; expected %s, got %s", username, rxUsername)
+		return fmt.Errorf("Received: user mismatch; expected %s, got %s", username, rxUsername)
 	}
 
 	if rxSuffix != suffix {
-		log.Fatalf("Received: suffix mismatch; expected %s, got %s", suffix, rxSuffix)
+		return fmt.Errorf("Received: suffix mismatch; expected %s, got %s", suffix, rxSuffix)
 	}
 
 	for _, domain := range Domains {
 		if rxDomain == domain {
-			return
+			return nil
 		}
 	}
-	log.Fatalf("Received: invalid domain: %s", rxDomain)
+	return fmt.Errorf("Received: invalid domain: %s", rxDomain)
 }
 
 // return fromAddress, username
-func checkSender(header mail.Header) (string, string) {
+func checkSender(header mail.Header) (string, string, error) {
 	addrs, err := header.AddressList("From")
-	cobra.CheckErr(err)
+	if err != nil {
+		return "", "", fmt.Errorf("From: %v", err)
+	}
 	if len(addrs) == 0 {
-		log.Fatal("missing From: address header")
+		return "", "", fmt.Errorf("missing From: address header")
 	}
 	if len(addrs) != 1 {
-		log.Fatal("From: multiple addresses not allowed")
+		return "", "", fmt.Errorf("From: multiple addresses not allowed")
 	}
 	address := addrs[0].Address
 	parts := strings.Split(address, "@")
 	if len(parts) != 2 {
-		log.Fatalf("From: unexpected format: %v", addrs)
+		return "", "", fmt.Errorf("From: unexpected format: %v", addrs)
 	}
 	username := parts[0]
 	domain := parts[1]
@@ -283,45 +320,47 @@ func checkSender(header mail.Header) (string, string) {
 		if viper.GetBool("insecure_disable_username_check") {
 			log.Printf("WARNING: insecure_disable_username_check: %s\n", username)
 		} else {
-			log.Fatalf("From: invalid user: %s", username)
+			return "", "", fmt.Errorf("From: invalid user: %s", username)
 		}
 	}
 
 	for _, d := range Domains {
 		if domain == d {
-			return address, username
+			return address, username, nil
 		}
 	}
-	log.Fatalf("From: invalid domain: %s", domain)
-	return "", ""
+	return "", "", fmt.Errorf("From: invalid domain: %s", domain)
 }
 
 // return toAddress, plus-suffix
-func checkRecipient(header mail.Header) (string, string) {
+func checkRecipient(header mail.Header) (string, string, error) {
 	addrs, err := header.AddressList("To")
-	cobra.CheckErr(err)
+	if err != nil {
+		return "", "", fmt.Errorf("To: %v", err)
+	}
 	if len(addrs) == 0 {
-		log.Fatal("missing To: address header")
+		return "", "", fmt.Errorf("missing To: address header")
 	}
 	if len(addrs) != 1 {
-		log.Fatal("To: multiple addresses not allowed")
+		return "", "", fmt.Errorf("To: multiple addresses not allowed")
 	}
 	address := addrs[0].Address
 	user, _, found := strings.Cut(address, "@")
 	if !found {
-		log.Fatalf("To: unexpected format: %v", addrs)
+		return "", "", fmt.Errorf("To: unexpected format: %v", addrs)
 	}
 	_, suffix, _ := strings.Cut(user, "+")
-	return address, suffix
+	return address, suffix, nil
 }
 
-func parseForwardedBody(m *mail.Reader, suffix string) string {
+// return the From address of the message forwarded in the body of m
+func parseForwardedBody(m *mail.Reader, suffix string) (string, error) {
 	for {
 		p, err := m.NextPart()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			log.Fatalf("failure parsing forwarded body: %v", err)
+			return "", fmt.Errorf("failure parsing forwarded body: %v", err)
 		}
 		switch h := p.Header.(type) {
 		case *mail.InlineHeader:
@@ -329,12 +368,12 @@ func parseForwardedBody(m *mail.Reader, suffix string) string {
 			if fromValue != "" {
 				addr, err := mail.ParseAddress(fromValue)
 				if err != nil {
-					log.Fatalf("failed parsing forwarded body part From header: %s", fromValue)
+					return "", fmt.Errorf("failed parsing forwarded body part From header: %s", fromValue)
 				}
 				if viper.GetBool("verbose") {
 					log.Printf("Found From address in forwarded body part InlineHeader: %s\n", addr.Address)
 				}
-				return addr.Address
+				return addr.Address, nil
 			}
 			value := h.Get("Content-Type")
 			contentType, _, _ := strings.Cut(value, ";")
@@ -342,12 +381,12 @@ func parseForwardedBody(m *mail.Reader, suffix string) string {
 			case "text/plain":
 				from := scanForwardedTextBody(p.Body)
 				if from != "" {
-					return from
+					return from, nil
 				}
 			case "text/html":
 				from := scanForwardedHTMLBody(p.Body)
 				if from != "" {
-					return from
+					return from, nil
 				}
 			default:
 				log.Printf("Warning: unexpected Content-Type: %s\n", contentType)
@@ -357,11 +396,11 @@ func parseForwardedBody(m *mail.Reader, suffix string) string {
 
 		}
 	}
-	log.Fatal("failed to locate From address in forwarded body")
-	return ""
+	return "", fmt.Errorf("plus-suffix forwarded from address not found")
 }
 
-func parseJSONBody(m *mail.Reader, command string) string {
+// return the JSON data in the body of m, reformatted
+func parseJSONBody(m *mail.Reader, command string) ([]byte, error) {
 	if viper.GetBool("verbose") {
 		log.Printf("parsing JSON body")
 	}
@@ -370,7 +409,7 @@ func parseJSONBody(m *mail.Reader, command string) string {
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			log.Fatalf("failure reading mesage body: %v", err)
+			return nil, fmt.Errorf("failure reading message body: %v", err)
 		}
 		switch h := p.Header.(type) {
 		case *mail.InlineHeader:
@@ -381,20 +420,72 @@ func parseJSONBody(m *mail.Reader, command string) string {
 					log.Printf("Warning: unexpected Content-Type: %s\n", contentType)
 				}
 			}
-			return scanJSONBodyToTempFile(p.Body)
+			return scanJSONBody(p.Body)
 		default:
 			log.Printf("Warning: unexpected body part header: %v\n", h)
 
 		}
 	}
-	log.Fatalf("failed parsing JSON body")
-	return ""
+	return nil, fmt.Errorf("%s: message body not found", command)
 }
 
-func scanJSONBodyToTempFile(body io.Reader) string {
-	data, err := io.ReadAll(body)
+// return a file command request containing the first attachment of m, or
+// the first text part if m has no attachment
+func parseFileBody(m *mail.Reader, command string) ([]byte, error) {
+	var request *APIFileRequest
+	for {
+		p, err := m.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failure reading message body: %v", err)
+		}
+		switch h := p.Header.(type) {
+		case *mail.AttachmentHeader:
+			filename, _ := h.Filename()
+			content, err := readBodyPart(p.Body)
+			if err != nil {
+				return nil, err
+			}
+			return json.MarshalIndent(&APIFileRequest{Filename: filename, Content: content}, "", "  ")
+		case *mail.InlineHeader:
+			contentType, _, _ := h.ContentType()
+			if request != nil || (contentType != "" && contentType != "text/plain") {
+				continue
+			}
+			content, err := readBodyPart(p.Body)
+			if err != nil {
+				return nil, err
+			}
+			request = &APIFileRequest{Content: content}
+		}
+	}
+	if request == nil || strings.TrimSpace(request.Content) == "" {
+		return nil, fmt.Errorf("%s: message body not found", command)
+	}
+	return json.MarshalIndent(request, "", "  ")
+}
+
+// read a message part, failing if it exceeds MAX_BODY_SIZE
+func readBodyPart(body io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(body, MAX_BODY_SIZE+1))
+	if err != nil {
+		return "", fmt.Errorf("failed reading message body: %v", err)
+	}
+	if len(data) > MAX_BODY_SIZE {
+		return "", fmt.Errorf("message body exceeds %d bytes", MAX_BODY_SIZE)
+	}
+	return string(data), nil
+}
+
+// read and reformat JSON data, failing if it exceeds MAX_BODY_SIZE
+func scanJSONBody(body io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, MAX_BODY_SIZE+1))
 	if err != nil {
-		log.Fatalf("failed reading message body: %v", err)
+		return nil, fmt.Errorf("failed reading message body: %v", err)
+	}
+	if len(data) > MAX_BODY_SIZE {
+		return nil, fmt.Errorf("message body exceeds %d bytes", MAX_BODY_SIZE)
 	}
 	if viper.GetBool("verbose") {
 		for i, line := range strings.Split(string(data), "\n") {
@@ -404,26 +495,39 @@ func scanJSONBodyToTempFile(body io.Reader) string {
 	var decoded interface{}
 	err = json.Unmarshal(data, &decoded)
 	if err != nil {
-		log.Fatalf("failed decoding message body as JSON: %v", err)
+		return nil, fmt.Errorf("failed decoding message body as JSON: %v", err)
 	}
 	formatted, err := json.MarshalIndent(decoded, "", "  ")
 	if err != nil {
-		log.Fatalf("failed reformatting JSON body data: %v", err)
+		return nil, fmt.Errorf("failed reformatting JSON body data: %v", err)
 	}
-	tmpFile, err := ioutil.TempFile(os.TempDir(), "filterctl-body-*")
-	defer tmpFile.Close()
+	return formatted, nil
+}
+
+// write the reformatted JSON data to a temp file, returning its absolute
+// pathname.  The caller must remove the file.
+func scanJSONBodyToTempFile(body io.Reader) (string, error) {
+	formatted, err := scanJSONBody(body)
 	if err != nil {
-		log.Fatalf("failed creating temp file for JSON body data: %v", err)
+		return "", err
 	}
-	_, err = tmpFile.Write(formatted)
+	tmpFile, err := os.CreateTemp(os.TempDir(), "filterctl-body-*")
 	if err != nil {
-		log.Fatalf("failed writing JSON body data to temp file: %v", err)
+		return "", fmt.Errorf("failed creating temp file for JSON body data: %v", err)
 	}
 	filename, err := filepath.Abs(tmpFile.Name())
+	if err == nil {
+		_, err = tmpFile.Write(formatted)
+	}
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
 	if err != nil {
-		log.Fatalf("failed converting temp file to absolute pathname: %v", err)
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("failed writing JSON body data to temp file: %v", err)
 	}
-	return filename
+	return filename, nil
 }
 
 func scanForwardedTextBody(body io.Reader) string {
@@ -445,10 +549,7 @@ func scanForwardedTextBody(body io.Reader) string {
 			if strings.TrimSpace(line) == "" {
 				break
 			}
-			_, err := buf.WriteString(line + "\n")
-			if err != nil {
-				log.Fatalf("failed writing to buffer: %v", err)
-			}
+			buf.WriteString(line + "\n")
 		}
 	}
 	if marker {
@@ -460,7 +561,8 @@ func scanForwardedTextBody(body io.Reader) string {
 		//log.Printf("part_message: %+v", m)
 		addrs, err := m.Header.AddressList("From")
 		if err != nil {
-			log.Fatalf("failed reading forwarded text body From: %v", err)
+			log.Printf("Warning: failed reading forwarded text body From: %v", err)
+			return ""
 		}
 		for _, addr := range addrs {
 			if viper.GetBool("verbose") {
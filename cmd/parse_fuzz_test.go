@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+const fuzzTimeout = 5 * time.Second
+
+// allocation allowance per call: a fixed overhead plus a multiple of the
+// input size
+const fuzzAllocBase = 16 * 1024 * 1024
+const fuzzAllocFactor = 64
+
+// add each message in the testdata corpus to the fuzz seed corpus
+func addMessageCorpus(f *testing.F) {
+	files, err := filepath.Glob("../testdata/*")
+	require.Nil(f, err)
+	files = append(files, "testdata/message")
+	for _, file := range files {
+		switch filepath.Ext(file) {
+		case ".golden", ".yaml", ".json", ".backup":
+			continue
+		}
+		data, err := os.ReadFile(file)
+		require.Nil(f, err)
+		f.Add(data)
+	}
+}
+
+// configure the parser for fuzzing: no command execution, no log output,
+// and a private temp directory
+func setupFuzz(f *testing.F) string {
+	tempDir := f.TempDir()
+	f.Setenv("TMPDIR", tempDir)
+	settings := map[string]any{
+		"verbose":                         false,
+		"disable_exec":                    true,
+		"audit_file":                      filepath.Join(f.TempDir(), "audit"),
+		"hostname":                        "testhost.mailcapsule.io",
+		"domains":                         []string{"mailcapsule.io"},
+		"insecure_disable_username_check": true,
+	}
+	for key, value := range settings {
+		previous := viper.Get(key)
+		viper.Set(key, value)
+		f.Cleanup(func() { viper.Set(key, previous) })
+	}
+	require.Nil(f, InitIdentity())
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return tempDir
+}
+
+// call fn, failing if it does not return within fuzzTimeout or allocates
+// more than the allowance for an input of size bytes
+func checkBounded(t *testing.T, size int, fn func()) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(fuzzTimeout):
+		t.Fatalf("no result after %v", fuzzTimeout)
+	}
+	runtime.ReadMemStats(&after)
+	allocated := after.TotalAlloc - before.TotalAlloc
+	limit := uint64(fuzzAllocBase + fuzzAllocFactor*size)
+	if allocated > limit {
+		t.Fatalf("allocated %d bytes for %d byte input; limit %d", allocated, size, limit)
+	}
+}
+
+// fail if any files remain in dir
+func checkNoTempFiles(t *testing.T, dir string) {
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	for _, entry := range entries {
+		os.RemoveAll(filepath.Join(dir, entry.Name()))
+		t.Errorf("temp file leaked: %s", entry.Name())
+	}
+}
+
+func FuzzParseFile(f *testing.F) {
+	addMessageCorpus(f)
+	tempDir := setupFuzz(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkBounded(t, len(data), func() {
+			ParseFile(context.Background(), bytes.NewReader(data))
+		})
+		checkNoTempFiles(t, tempDir)
+	})
+}
+
+func FuzzScanForwardedTextBody(f *testing.F) {
+	addMessageCorpus(f)
+	f.Add([]byte("----- Forwarded Message -----\nFrom: Someone <someone@example.org>\nSubject: test\n\nbody\n"))
+	setupFuzz(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var address string
+		checkBounded(t, len(data), func() {
+			address = scanForwardedTextBody(bytes.NewReader(data))
+		})
+		require.False(t, strings.ContainsAny(address, "\r\n"))
+	})
+}
+
+func FuzzScanForwardedHTMLBody(f *testing.F) {
+	addMessageCorpus(f)
+	f.Add([]byte("-------- Forwarded Message --------\n<table class=\"moz-email-headers-table\">\n<th valign=\"BASELINE\" nowrap=\"nowrap\">From: </th>\n<td><a class=\"moz-txt-link-abbreviated\" href=\"mailto:someone@example.org\">someone@example.org</a></td>\n</table>\n"))
+	setupFuzz(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var address string
+		checkBounded(t, len(data), func() {
+			address = scanForwardedHTMLBody(bytes.NewReader(data))
+		})
+		require.False(t, strings.ContainsAny(address, "\r\n"))
+	})
+}
+
+func FuzzScanJSONBodyToTempFile(f *testing.F) {
+	for _, file := range []string{"../testdata/rescan.json", "../testdata/accounts", "../testdata/restore"} {
+		data, err := os.ReadFile(file)
+		require.Nil(f, err)
+		_, body, found := bytes.Cut(data, []byte("\n\n"))
+		if !found {
+			body = data
+		}
+		f.Add(body)
+	}
+	f.Add([]byte(`{"Dump": {"Users": {}}}`))
+	f.Add([]byte(`[1, 2.5e300, "x", null, true, {"a": [[]]}]`))
+	tempDir := setupFuzz(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var filename string
+		var err error
+		checkBounded(t, len(data), func() {
+			filename, err = scanJSONBodyToTempFile(bytes.NewReader(data))
+		})
+		if err == nil {
+			require.Equal(t, tempDir, filepath.Dir(filename))
+			formatted, readErr := os.ReadFile(filename)
+			require.Nil(t, readErr)
+			require.Nil(t, os.Remove(filename))
+			require.LessOrEqual(t, len(formatted), MAX_BODY_SIZE*fuzzAllocFactor)
+		}
+		checkNoTempFiles(t, tempDir)
+	})
+}
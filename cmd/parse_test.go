@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
 	"os"
@@ -30,6 +31,6 @@ func TestParseFile(t *testing.T) {
 	input, err := os.Open("testdata/message")
 	require.Nil(t, err)
 
-	err = ParseFile(input)
+	err = ParseFile(context.Background(), input)
 	require.Nil(t, err)
 }
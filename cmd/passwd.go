@@ -22,10 +22,9 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // passwdCmd represents the passwd command
@@ -36,15 +35,21 @@ var passwdCmd = &cobra.Command{
 Return address book password for sender
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		filterctl := NewFilterctlClient()
-		var response APIPasswordResponse
-		path := fmt.Sprintf("/filterctl/passwd/%s/", viper.GetString("sender"))
-		text, err := filterctl.Get(path, &response)
-		cobra.CheckErr(err)
-		fmt.Println(text)
+		RunCommand(cmd, args, nil)
 	},
 }
 
+type passwdCommand struct{}
+
+func (passwdCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	return filterctl.Password(ctx, rc.Sender)
+}
+
 func init() {
 	rootCmd.AddCommand(passwdCmd)
+	RegisterCommand(passwdCmd, passwdCommand{})
 }
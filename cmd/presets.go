@@ -0,0 +1,275 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var PRESET_PATTERN = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+type Preset struct {
+	Name     string
+	Personal bool
+	Classes  []classes.SpamClass
+}
+
+type APIPresetsResponse struct {
+	APIResponse
+	Presets []Preset
+}
+
+type APIPresetResponse struct {
+	APIResponse
+	Preset Preset
+	DryRun bool `json:",omitempty"`
+}
+
+var presetsCmd = &cobra.Command{
+	Use:   "presets",
+	Short: "list named class presets",
+	Long: `
+List the named class tables which may be applied with 'reset PRESET'.  The
+presets defined by the mail system operator are listed first, followed by
+the sender's personal presets saved with the savepreset command.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		RunCommand(cmd, args, nil)
+	},
+}
+
+type presetsCommand struct{}
+
+func (presetsCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	presets, err := SystemPresets()
+	if err != nil {
+		return nil, err
+	}
+	personal, err := PersonalPresets(rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	presets = append(presets, personal...)
+	var response APIPresetsResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s presets: %d", rc.Sender, len(presets))
+	response.Presets = presets
+	return &response, nil
+}
+
+func newPresetResponse(rc *RequestContext, preset Preset, message string) *APIPresetResponse {
+	var response APIPresetResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s %s: %s", rc.Sender, rc.Command, message)
+	response.Preset = preset
+	return &response
+}
+
+// return a dry run response describing a preset which is not changed
+func newPresetDryRunResponse(rc *RequestContext, preset Preset, message string) *APIPresetResponse {
+	response := newPresetResponse(rc, preset, message)
+	response.DryRun = true
+	return response
+}
+
+// return the canonical form of a preset name; names are not case sensitive
+// because the config file keys are not
+func presetName(arg string) (string, error) {
+	name := strings.ToLower(arg)
+	if !PRESET_PATTERN.MatchString(name) {
+		return "", validationResult([]string{fmt.Sprintf("invalid preset name '%s'", arg)})
+	}
+	return name, nil
+}
+
+// SystemPresets returns the presets defined in the 'presets' section of the
+// config file, sorted by name.  Each preset is a list of class specifiers
+// in the form used by the reset command.
+func SystemPresets() ([]Preset, error) {
+	config := viper.GetStringMapStringSlice("presets")
+	presets := []Preset{}
+	for name, specs := range config {
+		if !PRESET_PATTERN.MatchString(name) {
+			return nil, fmt.Errorf("invalid preset name in config: '%s'", name)
+		}
+		table, err := parseClassSpecs(specs)
+		if err == nil && len(table) == 0 {
+			err = fmt.Errorf("no classes defined")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid preset '%s' in config: %v", name, err)
+		}
+		presets = append(presets, Preset{Name: name, Classes: table})
+	}
+	sort.Slice(presets, func(i, j int) bool {
+		return presets[i].Name < presets[j].Name
+	})
+	return presets, nil
+}
+
+// return the sender's personal presets filename
+func presetsFile(sender string) (string, error) {
+	path, err := userPath("presets_dir", sender)
+	if err != nil {
+		return "", err
+	}
+	return path + ".json", nil
+}
+
+func readPersonalPresets(sender string) (map[string][]classes.SpamClass, error) {
+	filename, err := presetsFile(sender)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return make(map[string][]classes.SpamClass), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decodePresets(file, filename)
+}
+
+func decodePresets(file io.Reader, filename string) (map[string][]classes.SpamClass, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	presets := make(map[string][]classes.SpamClass)
+	if len(data) == 0 {
+		return presets, nil
+	}
+	err = json.Unmarshal(data, &presets)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading presets %s: %v", filename, err)
+	}
+	return presets, nil
+}
+
+// PersonalPresets returns the sender's saved presets, sorted by name
+func PersonalPresets(sender string) ([]Preset, error) {
+	saved, err := readPersonalPresets(sender)
+	if err != nil {
+		return nil, err
+	}
+	presets := []Preset{}
+	for name, table := range saved {
+		presets = append(presets, Preset{Name: name, Personal: true, Classes: table})
+	}
+	sort.Slice(presets, func(i, j int) bool {
+		return presets[i].Name < presets[j].Name
+	})
+	return presets, nil
+}
+
+// apply update to the sender's personal presets and write the result.  The
+// presets file is locked so concurrent requests from the same sender are
+// applied in turn.
+func updatePersonalPresets(sender string, update func(map[string][]classes.SpamClass) error) error {
+	filename, err := presetsFile(sender)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("failed opening presets: %v", err)
+	}
+	defer file.Close()
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		return fmt.Errorf("failed locking presets: %v", err)
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	presets, err := decodePresets(file, filename)
+	if err != nil {
+		return err
+	}
+	err = update(presets)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(presets, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteAt(data, 0)
+	if err != nil {
+		return fmt.Errorf("failed writing presets: %v", err)
+	}
+	return file.Sync()
+}
+
+// FindPreset returns the sender's personal preset or the system preset
+// matching name, preferring the personal preset
+func FindPreset(sender, name string) (*Preset, error) {
+	name, err := presetName(name)
+	if err != nil {
+		return nil, err
+	}
+	personal, err := PersonalPresets(sender)
+	if err != nil {
+		return nil, err
+	}
+	system, err := SystemPresets()
+	if err != nil {
+		return nil, err
+	}
+	for _, preset := range append(personal, system...) {
+		if preset.Name == name {
+			return &preset, nil
+		}
+	}
+	return nil, validationResult([]string{fmt.Sprintf("unknown preset '%s'; send 'presets' for the list of preset names", name)})
+}
+
+func init() {
+	rootCmd.AddCommand(presetsCmd)
+	RegisterCommand(presetsCmd, presetsCommand{})
+}
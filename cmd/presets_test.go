@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func setPresets(t *testing.T, presets map[string]any) {
+	previous := viper.Get("presets")
+	viper.Set("presets", presets)
+	t.Cleanup(func() { viper.Set("presets", previous) })
+	viper.Set("presets_dir", t.TempDir())
+	t.Cleanup(func() { viper.Set("presets_dir", "") })
+}
+
+func TestSystemPresets(t *testing.T) {
+	setPresets(t, map[string]any{
+		"strict":  []string{"ham=0", "probable=3", "spam=999"},
+		"lenient": []any{"ham=10", "spam=999"},
+	})
+	presets, err := SystemPresets()
+	require.Nil(t, err)
+	require.Equal(t, []Preset{
+		{Name: "lenient", Classes: []classes.SpamClass{{Name: "ham", Score: 10}, {Name: "spam", Score: 999}}},
+		{Name: "strict", Classes: []classes.SpamClass{{Name: "ham", Score: 0}, {Name: "probable", Score: 3}, {Name: "spam", Score: 999}}},
+	}, presets)
+
+	viper.Set("presets", map[string]any{"broken": []string{"ham=10", "spam=10"}})
+	_, err = SystemPresets()
+	require.ErrorContains(t, err, "invalid preset 'broken' in config")
+	var invalid *ValidationError
+	require.False(t, errors.As(err, &invalid))
+}
+
+func TestPersonalPresets(t *testing.T) {
+	configure(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	server.Filterctld.AddUser(sender, "test-password")
+	setPresets(t, map[string]any{"strict": []string{"ham=0", "probable=3", "spam=999"}})
+	ctx := context.Background()
+
+	rc := RequestContext{Sender: sender, Command: "savepreset", Args: []string{"strict"}}
+	_, err := savepresetCommand{}.Run(ctx, &rc)
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid), err)
+
+	rc = RequestContext{Sender: sender, Command: "savepreset", Args: []string{"Mine"}}
+	result, err := savepresetCommand{}.DryRun(ctx, &rc)
+	require.Nil(t, err)
+	require.True(t, result.(*APIPresetResponse).DryRun)
+	personal, err := PersonalPresets(sender)
+	require.Nil(t, err)
+	require.Empty(t, personal)
+	_, err = savepresetCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+
+	viper.Set("presets_limit", 1)
+	defer viper.Set("presets_limit", 20)
+	rc = RequestContext{Sender: sender, Command: "savepreset", Args: []string{"other"}}
+	_, err = savepresetCommand{}.Run(ctx, &rc)
+	require.True(t, errors.As(err, &invalid), err)
+	require.Equal(t, []string{"personal preset limit 1 reached"}, invalid.Violations)
+
+	rc = RequestContext{Sender: sender, Command: "reset", Args: []string{"strict"}}
+	_, err = resetCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	require.Equal(t, []classes.SpamClass{{Name: "ham", Score: 0}, {Name: "probable", Score: 3}, {Name: "spam", Score: 999}}, server.Filterctld.Classes(sender))
+
+	rc = RequestContext{Sender: sender, Command: "presets"}
+	result, err = presetsCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	response := result.(*APIPresetsResponse)
+	require.Len(t, response.Presets, 2)
+	require.Equal(t, Preset{Name: "mine", Personal: true, Classes: classes.DefaultClasses}, response.Presets[1])
+
+	rc = RequestContext{Sender: sender, Command: "reset", Args: []string{"mine"}}
+	_, err = resetCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	require.Equal(t, classes.DefaultClasses, server.Filterctld.Classes(sender))
+
+	rc = RequestContext{Sender: sender, Command: "rmpreset", Args: []string{"mine"}}
+	result, err = rmpresetCommand{}.DryRun(ctx, &rc)
+	require.Nil(t, err)
+	require.True(t, result.(*APIPresetResponse).DryRun)
+	personal, err = PersonalPresets(sender)
+	require.Nil(t, err)
+	require.Len(t, personal, 1)
+	_, err = rmpresetCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	_, err = rmpresetCommand{}.Run(ctx, &rc)
+	require.True(t, errors.As(err, &invalid), err)
+	require.Equal(t, []string{"personal preset not found: mine"}, invalid.Violations)
+
+	rc = RequestContext{Sender: sender, Command: "reset", Args: []string{"mine"}}
+	_, err = resetCommand{}.Run(ctx, &rc)
+	require.True(t, errors.As(err, &invalid), err)
+	require.Equal(t, []string{"unknown preset 'mine'; send 'presets' for the list of preset names"}, invalid.Violations)
+}
@@ -0,0 +1,320 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// recommended thresholds are multiples of RECOMMEND_STEP
+const RECOMMEND_STEP = 0.1
+
+var RECOMMEND_PERCENTILES = []int{5, 25, 50, 75, 95}
+
+// recommendCmd represents the recommend command
+var recommendCmd = &cobra.Command{
+	Use:   "recommend INBOX_MAILBOX JUNK_MAILBOX",
+	Short: "recommend class thresholds from stored messages",
+	Long: `
+Propose a class table separating the messages kept in the Inbox from the
+messages filed as Junk, using the X-Spam-Score header of each message.  The
+'probable' threshold is the lowest score at or above which no more than the
+tolerance percentage of Inbox messages fall, and the 'ham' threshold is the
+highest score below which no more than the tolerance percentage of Junk
+messages fall.  The response lists score percentiles for each folder, and
+the false positives (Inbox messages at or above) and false negatives (Junk
+messages below) for each threshold of the proposed and current tables.
+INBOX_MAILBOX and JUNK_MAILBOX are Maildir directories or mbox files.
+When used with the email subject line command the message body must contain
+the scores as JSON text: 'Inbox' and 'Junk' lists of numbers, and an
+optional 'Tolerance' percentage.
+`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 && isRequestFile(args[0]) {
+			return nil
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 1 {
+			RunBodyCommand(cmd, args[0])
+			return
+		}
+		var request APIRecommendRequest
+		for i, scores := range []*[]float32{&request.Inbox, &request.Junk} {
+			messages, _, err := ReadMailbox(args[i])
+			cobra.CheckErr(err)
+			*scores = []float32{}
+			for _, message := range messages {
+				*scores = append(*scores, message.Score)
+			}
+		}
+		body, err := json.Marshal(&request)
+		cobra.CheckErr(err)
+		RunCommand(cmd, []string{}, body)
+	},
+}
+
+type APIRecommendRequest struct {
+	Tolerance *float64 `json:",omitempty"`
+	Inbox     []float32
+	Junk      []float32
+}
+
+type ScoreStats struct {
+	Count       int
+	Min         float32
+	Max         float32
+	Percentiles map[string]float32
+}
+
+// CutPoint reports the messages misclassified by a class threshold taken
+// as the boundary between mail kept and mail treated as spam
+type CutPoint struct {
+	Class          string
+	Threshold      float32
+	FalsePositives int
+	FalseNegatives int
+}
+
+type APIRecommendResponse struct {
+	APIResponse
+	Tolerance float64
+	Inbox     ScoreStats
+	Junk      ScoreStats
+	Proposed  []classes.SpamClass
+	Cuts      []CutPoint
+	Current   []CutPoint
+	Reset     string
+	Table     []string
+}
+
+type recommendCommand struct{}
+
+func (recommendCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	var request APIRecommendRequest
+	err := json.Unmarshal(rc.Body, &request)
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding recommendation data: %v", err)
+	}
+	tolerance := viper.GetFloat64("recommend.tolerance")
+	if request.Tolerance != nil {
+		tolerance = *request.Tolerance
+	}
+	violations := []string{}
+	if len(request.Inbox) == 0 {
+		violations = append(violations, "no Inbox scores provided")
+	}
+	if len(request.Junk) == 0 {
+		violations = append(violations, "no Junk scores provided")
+	}
+	if tolerance < 0 || tolerance >= 50 {
+		violations = append(violations, fmt.Sprintf("tolerance %v must be at least 0 and less than 50 percent", tolerance))
+	}
+	if len(violations) > 0 {
+		return nil, validationResult(violations)
+	}
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	current, err := currentClasses(ctx, filterctl, rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+
+	inbox := slices.Sorted(slices.Values(request.Inbox))
+	junk := slices.Sorted(slices.Values(request.Junk))
+	proposed, err := recommendClasses(inbox, junk, tolerance)
+	if err != nil {
+		return nil, err
+	}
+	specs := []string{}
+	for _, class := range proposed {
+		specs = append(specs, class.Name+"="+formatThreshold(class.Score))
+	}
+
+	var response APIRecommendResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s recommend: %d Inbox and %d Junk messages", rc.Sender, len(inbox), len(junk))
+	response.Tolerance = tolerance
+	response.Inbox = scoreStats(inbox)
+	response.Junk = scoreStats(junk)
+	response.Proposed = proposed
+	response.Cuts = cutPoints(proposed, inbox, junk)
+	response.Current = cutPoints(current, inbox, junk)
+	response.Reset = "reset " + strings.Join(specs, " ")
+	response.Table = formatRecommendation(response.Inbox, response.Junk, response.Cuts, response.Current)
+	return &response, nil
+}
+
+// return the value at percentile p of the sorted scores, using the nearest
+// rank method
+func percentile(sorted []float32, p int) float32 {
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func scoreStats(sorted []float32) ScoreStats {
+	stats := ScoreStats{
+		Count:       len(sorted),
+		Min:         sorted[0],
+		Max:         sorted[len(sorted)-1],
+		Percentiles: make(map[string]float32),
+	}
+	for _, p := range RECOMMEND_PERCENTILES {
+		stats.Percentiles[fmt.Sprintf("p%d", p)] = percentile(sorted, p)
+	}
+	return stats
+}
+
+// round a score down to a multiple of RECOMMEND_STEP
+func roundDown(score float64) float32 {
+	// allow for rounding error in scores which are already multiples
+	steps := math.Floor(score/RECOMMEND_STEP + 1e-6)
+	return float32(steps * RECOMMEND_STEP)
+}
+
+// return a score as the float64 value of its decimal form, so that a
+// float32 score of 6.2 is not treated as 6.1999998
+func decimalScore(score float32) float64 {
+	value, _ := strconv.ParseFloat(formatThreshold(score), 64)
+	return value
+}
+
+// return a ham, probable and spam class table for the sorted Inbox and Junk
+// scores, allowing tolerance percent of each folder on the wrong side of
+// its threshold.  The table is checked with validateClasses.
+func recommendClasses(inbox, junk []float32, tolerance float64) ([]classes.SpamClass, error) {
+	// the lowest threshold with at most the allowed Inbox messages at or
+	// above it
+	allowed := int(tolerance / 100 * float64(len(inbox)))
+	probable := roundDown(decimalScore(inbox[len(inbox)-1-allowed]) + RECOMMEND_STEP)
+
+	// the highest threshold with at most the allowed Junk messages below it
+	allowed = int(tolerance / 100 * float64(len(junk)))
+	ham := roundDown(decimalScore(junk[allowed]))
+
+	// when the folders are separated, the probable class holds the scores
+	// between the highest Inbox score and the lowest Junk score
+	if ham > probable {
+		ham, probable = probable, ham
+	}
+	if ham == probable {
+		probable = roundDown(decimalScore(ham) + RECOMMEND_STEP)
+	}
+
+	// scores at or above the spam maximum would give thresholds which
+	// reset rejects, so both are kept below it
+	probable = min(probable, roundDown(decimalScore(classes.MAX_THRESHOLD)-RECOMMEND_STEP))
+	if ham >= probable {
+		ham = roundDown(decimalScore(probable) - RECOMMEND_STEP)
+	}
+	table := []classes.SpamClass{
+		{Name: "ham", Score: ham},
+		{Name: "probable", Score: probable},
+		{Name: classes.MAX_NAME, Score: classes.MAX_THRESHOLD},
+	}
+	err := validateClasses(table)
+	if err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// return the misclassified message counts for each threshold of table
+// below the spam class
+func cutPoints(table []classes.SpamClass, inbox, junk []float32) []CutPoint {
+	cuts := []CutPoint{}
+	for _, class := range normalizeClasses(table) {
+		if class.Name == classes.MAX_NAME {
+			continue
+		}
+		cut := CutPoint{Class: class.Name, Threshold: class.Score}
+		for _, score := range inbox {
+			if score >= class.Score {
+				cut.FalsePositives++
+			}
+		}
+		for _, score := range junk {
+			if score < class.Score {
+				cut.FalseNegatives++
+			}
+		}
+		cuts = append(cuts, cut)
+	}
+	return cuts
+}
+
+// return text table lines showing the score distributions and cut points
+func formatRecommendation(inbox, junk ScoreStats, cuts, current []CutPoint) []string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "FOLDER\tCOUNT\tMIN")
+	for _, p := range RECOMMEND_PERCENTILES {
+		fmt.Fprintf(w, "\tP%d", p)
+	}
+	fmt.Fprintf(w, "\tMAX\n")
+	for _, folder := range []struct {
+		Name  string
+		Stats ScoreStats
+	}{{"Inbox", inbox}, {"Junk", junk}} {
+		fmt.Fprintf(w, "%s\t%d\t%s", folder.Name, folder.Stats.Count, formatThreshold(folder.Stats.Min))
+		for _, p := range RECOMMEND_PERCENTILES {
+			fmt.Fprintf(w, "\t%s", formatThreshold(folder.Stats.Percentiles[fmt.Sprintf("p%d", p)]))
+		}
+		fmt.Fprintf(w, "\t%s\n", formatThreshold(folder.Stats.Max))
+	}
+	fmt.Fprintf(w, "\n")
+	fmt.Fprintf(w, "TABLE\tCLASS\tTHRESHOLD\tFALSE_POSITIVES\tFALSE_NEGATIVES\n")
+	for _, table := range []struct {
+		Name string
+		Cuts []CutPoint
+	}{{"proposed", cuts}, {"current", current}} {
+		for _, cut := range table.Cuts {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\n", table.Name, cut.Class, formatThreshold(cut.Threshold), cut.FalsePositives, cut.FalseNegatives)
+		}
+	}
+	w.Flush()
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+}
+
+func init() {
+	rootCmd.AddCommand(recommendCmd)
+	RegisterBodyCommand(recommendCmd, recommendCommand{})
+	recommendCmd.Flags().Float64("tolerance", 1, "percentage of each folder allowed on the wrong side of its threshold")
+	viper.BindPFlag("recommend.tolerance", recommendCmd.Flags().Lookup("tolerance"))
+}
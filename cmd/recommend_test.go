@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []float32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	require.Equal(t, float32(1), percentile(sorted, 5))
+	require.Equal(t, float32(5), percentile(sorted, 50))
+	require.Equal(t, float32(10), percentile(sorted, 95))
+	require.Equal(t, float32(4), percentile([]float32{4}, 25))
+}
+
+func TestRecommendClasses(t *testing.T) {
+	recommendClasses := func(inbox, junk []float32, tolerance float64) []classes.SpamClass {
+		table, err := recommendClasses(inbox, junk, tolerance)
+		require.Nil(t, err)
+		return table
+	}
+
+	// overlapping folders: the probable class holds the overlap
+	inbox := []float32{-3, -1, 0.5, 2, 4.25}
+	junk := []float32{3.5, 6, 9, 12, 15}
+	require.Equal(t, []classes.SpamClass{
+		{Name: "ham", Score: 3.5},
+		{Name: "probable", Score: 4.3},
+		{Name: "spam", Score: 999},
+	}, recommendClasses(inbox, junk, 0))
+
+	// float32 scores are rounded in their decimal form
+	inbox = []float32{-3, 6.2}
+	junk = []float32{3.9, 15}
+	require.Equal(t, []classes.SpamClass{
+		{Name: "ham", Score: 3.9},
+		{Name: "probable", Score: 6.3},
+		{Name: "spam", Score: 999},
+	}, recommendClasses(inbox, junk, 0))
+
+	// separated folders: the probable class holds the gap between them
+	inbox = []float32{-3, -1, 0.5, 2}
+	junk = []float32{6, 9, 12}
+	require.Equal(t, []classes.SpamClass{
+		{Name: "ham", Score: 2.1},
+		{Name: "probable", Score: 6},
+		{Name: "spam", Score: 999},
+	}, recommendClasses(inbox, junk, 0))
+
+	// the tolerance allows outliers on the wrong side of each threshold
+	inbox = []float32{-3, -2, -1, 0, 1, 2, 3, 4, 5, 14}
+	junk = []float32{-4, 6, 7, 8, 9, 10, 11, 12, 13, 14}
+	require.Equal(t, []classes.SpamClass{
+		{Name: "ham", Score: -4},
+		{Name: "probable", Score: 14.1},
+		{Name: "spam", Score: 999},
+	}, recommendClasses(inbox, junk, 0))
+	table := recommendClasses(inbox, junk, 10)
+	require.Equal(t, []classes.SpamClass{
+		{Name: "ham", Score: 5.1},
+		{Name: "probable", Score: 6},
+		{Name: "spam", Score: 999},
+	}, table)
+	require.Equal(t, []CutPoint{
+		{Class: "ham", Threshold: 5.1, FalsePositives: 1, FalseNegatives: 1},
+		{Class: "probable", Threshold: 6, FalsePositives: 1, FalseNegatives: 1},
+	}, cutPoints(table, inbox, junk))
+
+	// thresholds are kept below the spam maximum
+	inbox = []float32{1000, 1200}
+	junk = []float32{1500}
+	require.Equal(t, []classes.SpamClass{
+		{Name: "ham", Score: 998.8},
+		{Name: "probable", Score: 998.9},
+		{Name: "spam", Score: 999},
+	}, recommendClasses(inbox, junk, 0))
+}
+
+func TestRecommendCommand(t *testing.T) {
+	configure(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	server.Filterctld.AddUser(sender, "test-password")
+
+	tolerance := 0.0
+	request := APIRecommendRequest{Tolerance: &tolerance, Inbox: []float32{2, -1, 0.5, -3}, Junk: []float32{12, 6, 9}}
+	body, err := json.Marshal(&request)
+	require.Nil(t, err)
+	rc := RequestContext{Sender: sender, Command: "recommend", Body: body}
+	result, err := recommendCommand{}.Run(context.Background(), &rc)
+	require.Nil(t, err)
+	response := result.(*APIRecommendResponse)
+	require.Equal(t, "reset ham=2.1 probable=6 spam=999", response.Reset)
+	require.Equal(t, ScoreStats{Count: 3, Min: 6, Max: 12, Percentiles: map[string]float32{"p5": 6, "p25": 6, "p50": 9, "p75": 12, "p95": 12}}, response.Junk)
+	require.Equal(t, []CutPoint{
+		{Class: "ham", Threshold: 5, FalsePositives: 0, FalseNegatives: 0},
+		{Class: "probable", Threshold: 10, FalsePositives: 0, FalseNegatives: 2},
+	}, response.Current)
+	require.Equal(t, []string{
+		"FOLDER  COUNT  MIN  P5  P25  P50  P75  P95  MAX",
+		"Inbox   4      -3   -3  -3   -1   0.5  2    2",
+		"Junk    3      6    6   6    9    12   12   12",
+		"",
+		"TABLE     CLASS     THRESHOLD  FALSE_POSITIVES  FALSE_NEGATIVES",
+		"proposed  ham       2.1        0                0",
+		"proposed  probable  6          0                0",
+		"current   ham       5          0                0",
+		"current   probable  10         0                2",
+	}, response.Table)
+
+	rc = RequestContext{Sender: sender, Command: "recommend", Body: []byte(`{"Tolerance": 50, "Inbox": [1]}`)}
+	_, err = recommendCommand{}.Run(context.Background(), &rc)
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid), err)
+	require.Equal(t, []string{"no Junk scores provided", "tolerance 50 must be at least 0 and less than 50 percent"}, invalid.Violations)
+}
@@ -0,0 +1,129 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/spf13/cobra"
+)
+
+// renameCmd represents the rename command
+var renameCmd = &cobra.Command{
+	Use:   "rename OLD_CLASS NEW_CLASS",
+	Short: "rename a class",
+	Long: `
+Rename the class OLD_CLASS to NEW_CLASS, keeping its threshold.  The complete
+class table is replaced in a single change, so no message is classified with
+a missing class while the rename takes place.  The 'spam' class may not be
+renamed.
+`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		RunCommand(cmd, args, nil)
+	},
+}
+
+type renameCommand struct{}
+
+// return the sender's current class table and the table with the class
+// renamed
+func planRename(ctx context.Context, filterctl *APIClient, rc *RequestContext) ([]classes.SpamClass, []classes.SpamClass, error) {
+	oldName, newName := rc.Args[0], rc.Args[1]
+	violations := []string{}
+	if !CLASS_NAME_PATTERN.MatchString(newName) {
+		violations = append(violations, fmt.Sprintf("invalid class name '%s'", newName))
+	}
+	if oldName == classes.MAX_NAME || newName == classes.MAX_NAME {
+		violations = append(violations, fmt.Sprintf("the '%s' class may not be renamed", classes.MAX_NAME))
+	}
+	if len(violations) > 0 {
+		return nil, nil, validationResult(violations)
+	}
+	before, err := currentClasses(ctx, filterctl, rc.Sender)
+	if err != nil {
+		return nil, nil, err
+	}
+	after := slices.Clone(before)
+	index := -1
+	for i, class := range after {
+		switch class.Name {
+		case oldName:
+			index = i
+		case newName:
+			violations = append(violations, fmt.Sprintf("class '%s' already exists", newName))
+		}
+	}
+	if index < 0 {
+		violations = append(violations, fmt.Sprintf("class '%s' not found", oldName))
+	}
+	if len(violations) > 0 {
+		return nil, nil, validationResult(violations)
+	}
+	after[index].Name = newName
+	err = validateClasses(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
+}
+
+func (renameCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	_, after, err := planRename(ctx, filterctl, rc)
+	if err != nil {
+		return nil, err
+	}
+	response, err := filterctl.ResetClasses(ctx, rc.Sender, after)
+	if err != nil {
+		return nil, err
+	}
+	response.Message = fmt.Sprintf("%s renamed class %s to %s", rc.Sender, rc.Args[0], rc.Args[1])
+	return response, nil
+}
+
+func (renameCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	before, after, err := planRename(ctx, filterctl, rc)
+	if err != nil {
+		return nil, err
+	}
+	return newDryRunResponse(rc, diffClasses(before, normalizeClasses(after)), nil), nil
+}
+
+func (renameCommand) SnapshotScope(rc *RequestContext) (string, error) {
+	return CLASSES_SCOPE, nil
+}
+
+func init() {
+	rootCmd.AddCommand(renameCmd)
+	RegisterCommand(renameCmd, renameCommand{})
+}
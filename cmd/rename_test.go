@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenameCommand(t *testing.T) {
+	configure(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	server.Filterctld.AddUser(sender, "test-password")
+	ctx := context.Background()
+
+	rc := RequestContext{Sender: sender, Command: "rename", Args: []string{"probable", "suspicious"}}
+	result, err := renameCommand{}.DryRun(ctx, &rc)
+	require.Nil(t, err)
+	require.Len(t, result.(*APIDryRunResponse).Classes, 2)
+	require.Equal(t, classes.DefaultClasses, server.Filterctld.Classes(sender))
+
+	_, err = renameCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	require.Equal(t, []classes.SpamClass{{Name: "ham", Score: 5}, {Name: "suspicious", Score: 10}, {Name: "spam", Score: 999}}, server.Filterctld.Classes(sender))
+
+	cases := []struct {
+		Args       []string
+		Violations []string
+	}{
+		{[]string{"probable", "likely"}, []string{"class 'probable' not found"}},
+		{[]string{"ham", "suspicious"}, []string{"class 'suspicious' already exists"}},
+		{[]string{"spam", "junk"}, []string{"the 'spam' class may not be renamed"}},
+		{[]string{"ham", "spam"}, []string{"the 'spam' class may not be renamed"}},
+		{[]string{"ham", "1ham"}, []string{"invalid class name '1ham'"}},
+	}
+	for _, c := range cases {
+		rc := RequestContext{Sender: sender, Command: "rename", Args: c.Args}
+		_, err := renameCommand{}.Run(ctx, &rc)
+		var invalid *ValidationError
+		require.True(t, errors.As(err, &invalid), c.Args)
+		require.Equal(t, c.Violations, invalid.Violations, c.Args)
+	}
+}
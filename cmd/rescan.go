@@ -22,13 +22,10 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"io"
-	"os"
 )
 
 // rescanCmd represents the scan command
@@ -41,43 +38,44 @@ messages with rspamd, address-books, spam-classes, rewriting message headers.
 `,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		viper.SetDefault("rescand_url", "https://127.0.0.1:2017")
-		url := viper.GetString("rescand_url")
-		rescan, err := NewAPIClient(url)
-		cobra.CheckErr(err)
+		RunBodyCommand(cmd, args[0])
+	},
+}
 
-		var data []byte
-		filename := args[0]
-		if filename == "" || filename == "-" {
-			var buf bytes.Buffer
-			_, err := io.Copy(&buf, os.Stdin)
-			cobra.CheckErr(err)
-			data = buf.Bytes()
-		} else {
-			data, err = os.ReadFile(filename)
-			if err != nil {
-				cobra.CheckErr(fmt.Errorf("failed reading message selection file: %v", err))
-			}
-			if !viper.GetBool("no_remove") {
-				err = os.Remove(filename)
-				cobra.CheckErr(err)
-			}
-		}
+type rescanCommand struct{}
 
-		var request APIRescanRequest
-		err = json.Unmarshal(data, &request)
-		if err != nil {
-			cobra.CheckErr(fmt.Errorf("failed decoding message selection file: %v", err))
-		}
-		request.Username = viper.GetString("sender")
+func (rescanCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	rescan, err := NewRescanClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	var request APIRescanRequest
+	err = json.Unmarshal(rc.Body, &request)
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding message selection file: %v", err)
+	}
+	request.Username = rc.Sender
 
-		var response APIRescanResponse
-		text, err := rescan.Post("/rescan/", &request, &response)
-		cobra.CheckErr(err)
-		fmt.Println(text)
-	},
+	return rescan.Rescan(ctx, request)
+}
+
+// rescan has no stored state to compare; report the selection without submitting it
+func (rescanCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	var request APIRescanRequest
+	err := json.Unmarshal(rc.Body, &request)
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding message selection file: %v", err)
+	}
+	request.Username = rc.Sender
+	response := APIRescanDryRunResponse{
+		APIDryRunResponse: *newDryRunResponse(rc, nil, nil),
+		Rescan:            request,
+	}
+	response.Message = fmt.Sprintf("%s rescan dry run: %d messages", rc.Sender, len(request.MessageIds))
+	return &response, nil
 }
 
 func init() {
 	rootCmd.AddCommand(rescanCmd)
+	RegisterBodyCommand(rescanCmd, rescanCommand{})
 }
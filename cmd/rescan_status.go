@@ -22,9 +22,8 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"context"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var rescanStatusCmd = &cobra.Command{
@@ -36,23 +35,25 @@ a single rescan job, otherwise request status of all active jobs.
 `,
 	Args: cobra.RangeArgs(0, 1),
 	Run: func(cmd *cobra.Command, args []string) {
-		viper.SetDefault("rescand_url", "https://127.0.0.1:2017")
-		url := viper.GetString("rescand_url")
-		rescan, err := NewAPIClient(url)
-		cobra.CheckErr(err)
-
-		var text string
-		var response APIRescanResponse
-		if len(args) == 0 {
-			text, err = rescan.Get("/rescan/", &response)
-		} else {
-			text, err = rescan.Get(fmt.Sprintf("/rescan/%s/", args[0]), &response)
-		}
-		cobra.CheckErr(err)
-		fmt.Println(text)
+		RunCommand(cmd, args, nil)
 	},
 }
 
+type rescanStatusCommand struct{}
+
+func (rescanStatusCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	rescan, err := NewRescanClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	id := ""
+	if len(rc.Args) > 0 {
+		id = rc.Args[0]
+	}
+	return rescan.RescanStatus(ctx, id)
+}
+
 func init() {
 	rootCmd.AddCommand(rescanStatusCmd)
+	RegisterCommand(rescanStatusCmd, rescanStatusCommand{})
 }
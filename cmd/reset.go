@@ -22,61 +22,153 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/rstms/rspamd-classes/classes"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var CLASS_PATTERN = regexp.MustCompile(`^\s*([a-zA-Z][a-zA-Z0-9_-]*)=([-0-9\.][0-9\.]*)\s*$`)
+var CLASS_NAME_PATTERN = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
 
 // resetCmd represents the reset command
 var resetCmd = &cobra.Command{
-	Use:   "reset [NAME=THRESHOLD,...]",
+	Use:   "reset [+SUFFIX] [NAME=THRESHOLD,... | PRESET]",
 	Short: "replace rspamd class thresholds",
 	Long: `
 Replace the set of rspamd class thresholds with a new set provided as
 arguments.  Each class name has a threshold value.  The threshold values set
 the upper limit for each class.  Any number of classes may be defined.
 If no class specifications are provided, default values will be used.
+Classes are listed in order of increasing threshold, each name and threshold
+may be used only once, and the table ends with the 'spam' class, whose
+threshold is fixed at 999.  For example: 'reset ham=5 probable=10 spam=999'
+A single PRESET argument applies the class table of a named preset listed by
+the presets command.  For example: 'reset strict'
+A leading +SUFFIX argument replaces the classes used for mail addressed to
+the sender's plus-suffix address.  For example: 'reset +shop lenient'
+With no other arguments, the suffix's class table is removed and mail for
+the address uses the sender's classes again.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		filterctl := NewFilterctlClient()
+		RunCommand(cmd, args, nil)
+	},
+}
 
-		// if no args provided, generate from default config
-		type Request struct {
-			Address string
-			Classes []classes.SpamClass
+type resetCommand struct{}
+
+func (resetCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	scope, args, err := parseClassScope(rc.Sender, rc.Args)
+	if err != nil {
+		return nil, err
+	}
+	if scope.Suffix != "" && len(args) == 0 {
+		response, err := deleteScopeClasses(ctx, filterctl, scope)
+		if err != nil {
+			return nil, err
 		}
-		request := Request{
-			Address: viper.GetString("sender"),
-			Classes: make([]classes.SpamClass, len(args)),
+		response.Message = fmt.Sprintf("%s reset: using the classes of %s", scope.Address(), rc.Sender)
+		return response, nil
+	}
+	// if no args provided, the server restores the default classes
+	table, err := requestedClasses(rc.Sender, args)
+	if err != nil {
+		return nil, err
+	}
+	return resetScopeClasses(ctx, filterctl, scope, table)
+}
+
+func (resetCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	scope, args, err := parseClassScope(rc.Sender, rc.Args)
+	if err != nil {
+		return nil, err
+	}
+	var table []classes.SpamClass
+	if scope.Suffix != "" && len(args) == 0 {
+		table, err = currentClasses(ctx, filterctl, rc.Sender)
+	} else {
+		table, err = requestedClasses(rc.Sender, args)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(table) == 0 {
+		table = classes.DefaultClasses
+	}
+	before, _, err := scopeClasses(ctx, filterctl, scope)
+	if err != nil {
+		return nil, err
+	}
+	return newDryRunResponse(rc, diffClasses(before, normalizeClasses(table)), nil), nil
+}
+
+// return the class table selected by reset arguments: a preset name or a
+// list of class specifiers
+func requestedClasses(sender string, args []string) ([]classes.SpamClass, error) {
+	if len(args) == 1 && !strings.Contains(args[0], "=") {
+		preset, err := FindPreset(sender, args[0])
+		if err != nil {
+			return nil, err
 		}
+		return preset.Classes, nil
+	}
+	return parseClassSpecs(args)
+}
 
-		for i, arg := range args {
-			matches := CLASS_PATTERN.FindStringSubmatch(arg)
-			if len(matches) != 3 {
-				cobra.CheckErr(fmt.Errorf("failed to parse class specifier '%s'", arg))
-			}
-			name := matches[1]
-			threshold := matches[2]
-			score, err := strconv.ParseFloat(threshold, 32)
-			if err != nil {
-				cobra.CheckErr(fmt.Errorf("invalid threshold value in class specifier '%s' ", arg))
-			}
-			request.Classes[i].Name = name
-			request.Classes[i].Score = float32(score)
+func parseClassSpec(arg string) (classes.SpamClass, error) {
+	matches := CLASS_PATTERN.FindStringSubmatch(arg)
+	if len(matches) != 3 {
+		return classes.SpamClass{}, fmt.Errorf("failed to parse class specifier '%s'", arg)
+	}
+	name := matches[1]
+	threshold := matches[2]
+	score, err := strconv.ParseFloat(threshold, 32)
+	if err != nil {
+		return classes.SpamClass{}, fmt.Errorf("invalid threshold value in class specifier '%s'", arg)
+	}
+	return classes.SpamClass{Name: name, Score: float32(score)}, nil
+}
+
+// parse a class table from the arguments, reporting every invalid
+// specifier and every violation of the class table rules
+func parseClassSpecs(args []string) ([]classes.SpamClass, error) {
+	table := make([]classes.SpamClass, len(args))
+	violations := []string{}
+	for i, arg := range args {
+		class, err := parseClassSpec(arg)
+		if err != nil {
+			violations = append(violations, err.Error())
 		}
-		var response APIClassesResponse
-		text, err := filterctl.Post("/filterctl/classes/", &request, &response)
-		cobra.CheckErr(err)
-		fmt.Println(text)
-	},
+		table[i] = class
+	}
+	if len(violations) > 0 || len(table) == 0 {
+		return table, validationResult(violations)
+	}
+	return table, validateClasses(table)
+}
+
+func (resetCommand) SnapshotScope(rc *RequestContext) (string, error) {
+	return CLASSES_SCOPE, nil
+}
+
+func (resetCommand) ClassScope(rc *RequestContext) (ClassScope, error) {
+	scope, _, err := parseClassScope(rc.Sender, rc.Args)
+	return scope, err
 }
 
 func init() {
 	rootCmd.AddCommand(resetCmd)
+	RegisterCommand(resetCmd, resetCommand{})
 }
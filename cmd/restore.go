@@ -22,12 +22,14 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/rstms/mabctl/api"
+	"github.com/rstms/rspamd-classes/classes"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"os"
+	"sort"
 )
 
 var restoreCmd = &cobra.Command{
@@ -36,41 +38,176 @@ var restoreCmd = &cobra.Command{
 	Long: `
 Restore the cardDAV config for the sender from the JSON data in RESTORE_FILE.
 When used with the email subject line command the message body must contain
-the restore data as JSON text.
+the restore data as JSON text.  An Aliases value in the form returned by the
+dump command restores the class tables of the sender's plus-suffix addresses.
 `,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		filename := args[0]
-		var err error
-		var file *os.File
+		RunBodyCommand(cmd, args[0])
+	},
+}
+
+// restoreAliases holds the plus-suffix class tables of a restore request
+type restoreAliases struct {
+	Aliases map[string][]classes.SpamClass
+}
+
+type APIRestoreDryRunResponse struct {
+	APIDryRunResponse
+	Aliases map[string][]ClassChange `json:",omitempty"`
+}
+
+type restoreCommand struct{}
 
-		if filename == "" || filename == "-" {
-			file = os.Stdin
-		} else {
-			file, err = os.Open(filename)
-			cobra.CheckErr(err)
-			if !viper.GetBool("no_remove") {
-				defer func() {
-					err := os.Remove(filename)
-					cobra.CheckErr(err)
-				}()
+// return the scopes of the alias class tables in the restore data, sorted by
+// suffix, reporting every invalid suffix and table
+func parseRestoreAliases(sender string, body []byte) ([]ClassScope, map[string][]classes.SpamClass, error) {
+	var request restoreAliases
+	err := json.Unmarshal(body, &request)
+	if err != nil {
+		return nil, nil, err
+	}
+	suffixes := []string{}
+	for suffix := range request.Aliases {
+		suffixes = append(suffixes, suffix)
+	}
+	sort.Strings(suffixes)
+	scopes := []ClassScope{}
+	violations := []string{}
+	for _, suffix := range suffixes {
+		scope, _, err := parseClassScope(sender, []string{"+" + suffix})
+		if err == nil {
+			err = validateClasses(request.Aliases[suffix])
+		}
+		var invalid *ValidationError
+		switch {
+		case errors.As(err, &invalid):
+			for _, violation := range invalid.Violations {
+				violations = append(violations, fmt.Sprintf("alias '+%s': %s", suffix, violation))
 			}
-			defer file.Close()
+		case err != nil:
+			return nil, nil, err
+		default:
+			scopes = append(scopes, scope)
 		}
-		filterctl := NewFilterctlClient()
-		var request APIRestoreRequest
-		var response APIResponse
-		request.Username = viper.GetString("sender")
-		request.Dump = api.ConfigDump{}
-		decoder := json.NewDecoder(file)
-		err = decoder.Decode(&request)
-		cobra.CheckErr(err)
-		text, err := filterctl.Post("/filterctl/restore/", &request, &response)
-		cobra.CheckErr(err)
-		fmt.Println(text)
-	},
+	}
+	if len(violations) > 0 {
+		return nil, nil, validationResult(violations)
+	}
+	return scopes, request.Aliases, nil
+}
+
+func (restoreCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	var request APIRestoreRequest
+	request.Username = rc.Sender
+	request.Dump = api.ConfigDump{}
+	err = json.Unmarshal(rc.Body, &request)
+	if err != nil {
+		return nil, err
+	}
+	scopes, aliases, err := parseRestoreAliases(rc.Sender, rc.Body)
+	if err != nil {
+		return nil, err
+	}
+	var response *APIResponse
+	if _, ok := request.Dump.Users[request.Username]; ok || len(scopes) == 0 {
+		response, err = filterctl.Restore(ctx, request.Username, request.Dump)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// the request restores only alias class tables
+		response = &APIResponse{User: rc.Sender, Request: rc.RequestID, Success: true}
+		response.Message = fmt.Sprintf("%s restore", rc.Sender)
+	}
+	for _, scope := range scopes {
+		_, err := resetScopeClasses(ctx, filterctl, scope, aliases[scope.Suffix])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(scopes) > 0 {
+		response.Message = fmt.Sprintf("%s; restored %d alias class tables", response.Message, len(scopes))
+	}
+	return response, nil
+}
+
+func (restoreCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	var request APIRestoreRequest
+	err = json.Unmarshal(rc.Body, &request)
+	if err != nil {
+		return nil, err
+	}
+	scopes, aliases, err := parseRestoreAliases(rc.Sender, rc.Body)
+	if err != nil {
+		return nil, err
+	}
+	books, err := currentBooks(ctx, filterctl, rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	changes := []BookChange{}
+	userDump, ok := request.Dump.Users[rc.Sender]
+	if ok {
+		booknames := []string{}
+		for bookname := range userDump.Books {
+			booknames = append(booknames, bookname)
+		}
+		sort.Strings(booknames)
+		for _, bookname := range booknames {
+			addresses := userDump.Books[bookname]
+			if !hasBook(books, bookname) {
+				changes = append(changes, BookChange{Book: bookname, Action: "create", Added: addresses})
+				continue
+			}
+			before, err := currentAddresses(ctx, filterctl, rc.Sender, bookname)
+			if err != nil {
+				return nil, err
+			}
+			added, _ := diffAddresses(before, addresses)
+			if len(added) > 0 {
+				changes = append(changes, BookChange{Book: bookname, Action: "modify", Added: added})
+			}
+		}
+	}
+	response := APIRestoreDryRunResponse{APIDryRunResponse: *newDryRunResponse(rc, nil, changes)}
+	count := len(changes)
+	for _, scope := range scopes {
+		before, _, err := scopeClasses(ctx, filterctl, scope)
+		if err != nil {
+			return nil, err
+		}
+		classChanges := diffClasses(before, normalizeClasses(aliases[scope.Suffix]))
+		if len(classChanges) > 0 {
+			if response.Aliases == nil {
+				response.Aliases = make(map[string][]ClassChange)
+			}
+			response.Aliases[scope.Suffix] = classChanges
+			count += len(classChanges)
+		}
+	}
+	response.Message = fmt.Sprintf("%s %s dry run: %d changes", rc.Sender, rc.Command, count)
+	return &response, nil
+}
+
+func (restoreCommand) SnapshotScope(rc *RequestContext) (string, error) {
+	return BOOKS_SCOPE, nil
+}
+
+func (restoreCommand) AliasScopes(rc *RequestContext) ([]ClassScope, error) {
+	scopes, _, err := parseRestoreAliases(rc.Sender, rc.Body)
+	return scopes, err
 }
 
 func init() {
 	rootCmd.AddCommand(restoreCmd)
+	RegisterBodyCommand(restoreCmd, restoreCommand{})
 }
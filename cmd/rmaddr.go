@@ -22,10 +22,9 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var rmaddrCmd = &cobra.Command{
@@ -36,18 +35,54 @@ Delete an email address from the named address book.
 `,
 	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		username := viper.GetString("sender")
-		bookname := args[0]
-		address := args[1]
-		filterctl := NewFilterctlClient()
-		var response APIResponse
-		path := fmt.Sprintf("/filterctl/address/%s/%s/%s/", username, bookname, address)
-		text, err := filterctl.Delete(path, &response)
-		cobra.CheckErr(err)
-		fmt.Println(text)
+		RunCommand(cmd, args, nil)
 	},
 }
 
+type rmaddrCommand struct{}
+
+func (rmaddrCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	bookname := rc.Args[0]
+	address := rc.Args[1]
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	return filterctl.DeleteAddress(ctx, rc.Sender, bookname, address)
+}
+
+func (rmaddrCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	bookname := rc.Args[0]
+	address := rc.Args[1]
+	books, err := currentBooks(ctx, filterctl, rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	changes := []BookChange{}
+	if hasBook(books, bookname) {
+		before, err := currentAddresses(ctx, filterctl, rc.Sender, bookname)
+		if err != nil {
+			return nil, err
+		}
+		for _, existing := range before {
+			if existing == address {
+				changes = append(changes, BookChange{Book: bookname, Action: "modify", Removed: []string{address}})
+				break
+			}
+		}
+	}
+	return newDryRunResponse(rc, nil, changes), nil
+}
+
+func (rmaddrCommand) SnapshotScope(rc *RequestContext) (string, error) {
+	return BOOKS_SCOPE, nil
+}
+
 func init() {
 	rootCmd.AddCommand(rmaddrCmd)
+	RegisterCommand(rmaddrCmd, rmaddrCommand{})
 }
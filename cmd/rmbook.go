@@ -22,10 +22,9 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // rmbookCmd represents the rmbook command
@@ -38,17 +37,46 @@ All addresses in the named address book are DELETED.
 `,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		filterctl := NewFilterctlClient()
-		user := viper.GetString("sender")
-		token := args[0]
-		path := fmt.Sprintf("/filterctl/book/%s/%s/", user, token)
-		var response APIResponse
-		text, err := filterctl.Delete(path, &response)
-		cobra.CheckErr(err)
-		fmt.Println(text)
+		RunCommand(cmd, args, nil)
 	},
 }
 
+type rmbookCommand struct{}
+
+func (rmbookCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	return filterctl.DeleteBook(ctx, rc.Sender, rc.Args[0])
+}
+
+func (rmbookCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	bookname := rc.Args[0]
+	books, err := currentBooks(ctx, filterctl, rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	changes := []BookChange{}
+	if hasBook(books, bookname) {
+		addresses, err := currentAddresses(ctx, filterctl, rc.Sender, bookname)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, BookChange{Book: bookname, Action: "delete", Removed: addresses})
+	}
+	return newDryRunResponse(rc, nil, changes), nil
+}
+
+func (rmbookCommand) SnapshotScope(rc *RequestContext) (string, error) {
+	return BOOKS_SCOPE, nil
+}
+
 func init() {
 	rootCmd.AddCommand(rmbookCmd)
+	RegisterCommand(rmbookCmd, rmbookCommand{})
 }
@@ -0,0 +1,92 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/spf13/cobra"
+)
+
+// rmpresetCmd represents the rmpreset command
+var rmpresetCmd = &cobra.Command{
+	Use:   "rmpreset NAME",
+	Short: "delete a personal preset",
+	Long: `
+Delete the sender's personal preset named NAME.
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		RunCommand(cmd, args, nil)
+	},
+}
+
+type rmpresetCommand struct{}
+
+func presetNotFound(name string) error {
+	return validationResult([]string{fmt.Sprintf("personal preset not found: %s", name)})
+}
+
+func (rmpresetCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	name, err := presetName(rc.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	preset := Preset{Name: name, Personal: true}
+	err = updatePersonalPresets(rc.Sender, func(presets map[string][]classes.SpamClass) error {
+		table, ok := presets[name]
+		if !ok {
+			return presetNotFound(name)
+		}
+		preset.Classes = table
+		delete(presets, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newPresetResponse(rc, preset, "deleted "+name), nil
+}
+
+func (rmpresetCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	name, err := presetName(rc.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	presets, err := readPersonalPresets(rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	table, ok := presets[name]
+	if !ok {
+		return nil, presetNotFound(name)
+	}
+	preset := Preset{Name: name, Personal: true, Classes: table}
+	return newPresetDryRunResponse(rc, preset, "dry run: would delete "+name), nil
+}
+
+func init() {
+	rootCmd.AddCommand(rmpresetCmd)
+	RegisterCommand(rmpresetCmd, rmpresetCommand{})
+}
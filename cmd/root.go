@@ -23,6 +23,7 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -33,8 +34,10 @@ import (
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"slices"
 	"strings"
 
+	"github.com/rstms/filterctl/pkg/client"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -44,6 +47,9 @@ var logFile *os.File
 
 const Version = "1.3.16"
 
+// sysexits.h status requesting the MTA retry delivery later
+const EX_TEMPFAIL = 75
+
 var Hostname string
 var Username string
 var Domains []string
@@ -77,7 +83,11 @@ Command actions issue API requests to filterctld running at http://localhost:201
 		cobra.CheckErr(err)
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		err := ParseFile(os.Stdin)
+		err := ParseFile(cmd.Context(), os.Stdin)
+		if errors.Is(err, client.ErrUnavailable) {
+			log.Printf("deferring delivery: %v\n", err)
+			os.Exit(EX_TEMPFAIL)
+		}
 		cobra.CheckErr(err)
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
@@ -133,15 +143,48 @@ func init() {
 	rootCmd.PersistentFlags().String("ca", "/etc/ssl/keymaster.pem", "certificate authority file")
 	viper.BindPFlag("ca", rootCmd.PersistentFlags().Lookup("ca"))
 
-	rootCmd.PersistentFlags().String("server-url", "http://localhost:2016", "server url")
+	rootCmd.PersistentFlags().String("server-url", "http://localhost:2016", "server url (https://HOST:PORT or unix:///path/to.sock)")
 	viper.BindPFlag("server_url", rootCmd.PersistentFlags().Lookup("server-url"))
 
+	rootCmd.PersistentFlags().String("rescand-url", "https://127.0.0.1:2017", "rescan server url (https://HOST:PORT or unix:///path/to.sock)")
+	viper.BindPFlag("rescand_url", rootCmd.PersistentFlags().Lookup("rescand-url"))
+
+	rootCmd.PersistentFlags().Bool("isolate-commands", false, "execute mail commands in a subprocess")
+	viper.BindPFlag("isolate_commands", rootCmd.PersistentFlags().Lookup("isolate-commands"))
+
+	rootCmd.PersistentFlags().BoolP("dry-run", "n", false, "report changes without modifying configuration")
+	viper.BindPFlag("dry_run", rootCmd.PersistentFlags().Lookup("dry-run"))
+
 	rootCmd.PersistentFlags().String("sender", "", "from address")
 	viper.BindPFlag("sender", rootCmd.PersistentFlags().Lookup("sender"))
 
 	rootCmd.PersistentFlags().String("message-id", "", "base64-encoded message ID")
 	viper.BindPFlag("message_id", rootCmd.PersistentFlags().Lookup("message-id"))
 
+	rootCmd.PersistentFlags().String("audit-file", "/var/log/filterctl.audit", "audit log filename")
+	viper.BindPFlag("audit_file", rootCmd.PersistentFlags().Lookup("audit-file"))
+
+	rootCmd.PersistentFlags().String("history-dir", filepath.Join(home, "history"), "configuration snapshot directory")
+	viper.BindPFlag("history_dir", rootCmd.PersistentFlags().Lookup("history-dir"))
+
+	rootCmd.PersistentFlags().Int("history-limit", 20, "maximum snapshots saved per user")
+	viper.BindPFlag("history_limit", rootCmd.PersistentFlags().Lookup("history-limit"))
+
+	rootCmd.PersistentFlags().String("jobs-dir", filepath.Join(home, "jobs"), "scheduled job directory")
+	viper.BindPFlag("jobs_dir", rootCmd.PersistentFlags().Lookup("jobs-dir"))
+
+	rootCmd.PersistentFlags().Int("jobs-limit", 20, "maximum scheduled jobs per user")
+	viper.BindPFlag("jobs_limit", rootCmd.PersistentFlags().Lookup("jobs-limit"))
+
+	rootCmd.PersistentFlags().String("presets-dir", filepath.Join(home, "presets"), "personal class preset directory")
+	viper.BindPFlag("presets_dir", rootCmd.PersistentFlags().Lookup("presets-dir"))
+
+	rootCmd.PersistentFlags().Int("presets-limit", 20, "maximum personal class presets per user")
+	viper.BindPFlag("presets_limit", rootCmd.PersistentFlags().Lookup("presets-limit"))
+
+	rootCmd.PersistentFlags().String("aliases-dir", filepath.Join(home, "aliases"), "plus-suffix class table registry directory")
+	viper.BindPFlag("aliases_dir", rootCmd.PersistentFlags().Lookup("aliases-dir"))
+
 	rootCmd.PersistentFlags().Bool("no-remove", false, "disable deletion of input file")
 	viper.BindPFlag("no_remove", rootCmd.PersistentFlags().Lookup("no-remove"))
 }
@@ -179,6 +222,16 @@ func initConfig() {
 	viper.AutomaticEnv() // read in environment variables that match
 
 	viper.SetDefault("message_id", EncodedMessageID("filter_control_message"))
+	viper.SetDefault("timeouts.default", "30s")
+	viper.SetDefault("timeouts.rescan", "5m")
+	viper.SetDefault("timeouts.restore", "5m")
+	viper.SetDefault("sendmail_timeout", "1m")
+	viper.SetDefault("retry.attempts", 3)
+	viper.SetDefault("retry.delay", "250ms")
+	viper.SetDefault("retry.max_delay", "5s")
+	viper.SetDefault("breaker.threshold", 5)
+	viper.SetDefault("breaker.cooldown", "30s")
+	viper.SetDefault("breaker.dir", "~/breaker")
 
 	// If a config file is found, read it in.
 	err = viper.ReadInConfig()
@@ -295,29 +348,332 @@ func DecodedMessageID(encoded string) (string, error) {
 	return string(decoded), nil
 }
 
-func ExecuteCommand(sender, messageID string, args []string) error {
+func ExecuteCommand(ctx context.Context, sender, messageID string, args []string, body []byte) (err error) {
 	verbose := viper.GetBool("verbose")
 	if verbose {
 		log.Printf("ExecuteCommand: sender=%s messageID=%s command=%s args=%v\n", sender, messageID, os.Args[0], args)
 	}
+
+	if len(args) == 0 {
+		args = []string{"help"}
+	}
+	if args[0] == "help" {
+		args[0] = "usage"
+	}
+
+	record := AuditRecord{
+		Sender:     sender,
+		RequestID:  messageID,
+		Command:    args[0],
+		Args:       args[1:],
+		Authorized: true,
+	}
+	defer func() {
+		if err != nil {
+			record.Error = err.Error()
+		}
+		audit(record)
+	}()
+
 	if viper.GetBool("disable_exec") {
+		record.Status = "disabled"
 		return nil
 	}
 
-	if args[0] == "help" {
-		args[0] = "usage"
+	var stdout []byte
+	if viper.GetBool("isolate_commands") {
+		stdout, record.Status, err = executeSubprocess(ctx, sender, messageID, args, body)
+	} else {
+		stdout, record.Status, err = executeInProcess(ctx, sender, messageID, args, body)
+	}
+	if err != nil {
+		return err
+	}
+	record.ResponseSize = len(stdout)
+	record.HTTPStatus = responseHTTPStatus(stdout)
+
+	// generate RFC2822 email message
+	responseSubject := fmt.Sprintf("filterctl response %s", viper.GetString("message-id"))
+	var message []byte
+	attachment := responseAttachment(stdout)
+	if attachment != nil {
+		message, err = formatEmailAttachmentMessage(messageID, responseSubject, sender, "filterctl@"+Domains[0], stdout, attachment)
+	} else {
+		message, err = formatEmailMessage(messageID, responseSubject, sender, "filterctl@"+Domains[0], stdout)
+	}
+	if err != nil {
+		return err
+	}
+
+	if verbose {
+		LogLines("RESPONSE", message)
+	}
+
+	if viper.GetBool("disable_response") {
+		fmt.Println(string(message))
+		return nil
+	}
+
+	return sendMail(ctx, sender, message)
+}
+
+// deliver an RFC2822 message to the recipient with sendmail
+func sendMail(ctx context.Context, recipient string, message []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, viper.GetDuration("sendmail_timeout"))
+	defer cancel()
+	sendmail := exec.CommandContext(ctx, "sendmail", recipient)
+	sendmail.Stdin = bytes.NewBuffer(message)
+	exitCode, stdout, stderr, err := run(sendmail)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("sendmail failed: %w", ctx.Err())
+	}
+	if exitCode != 0 {
+		log.Printf("sendmail exited %d\n", exitCode)
+		LogLines("SENDMAIL_STDOUT", stdout)
+		LogLines("SENDMAIL_STDERR", stderr)
+	}
+	return nil
+}
+
+// return the audit status of a command response document
+func responseStatus(response []byte) string {
+	var result struct {
+		Success bool
+	}
+	err := json.Unmarshal(response, &result)
+	if err != nil {
+		return "invalid"
+	}
+	if result.Success {
+		return "success"
+	}
+	return "failure"
+}
+
+// return the HTTP status of the filter server error reported in a command
+// response, or zero if the response reports no server error
+func responseHTTPStatus(response []byte) int {
+	var result struct {
+		Error *client.APIError
+	}
+	err := json.Unmarshal(response, &result)
+	if err != nil || result.Error == nil {
+		return 0
+	}
+	return result.Error.StatusCode
+}
+
+func failureResponse(sender, messageID, message string) ([]byte, error) {
+	return failureResponseWithError(sender, messageID, message, nil)
+}
+
+func failureResponseWithError(sender, messageID, message string, apiErr *client.APIError) ([]byte, error) {
+	if apiErr == nil {
+		return failureResponseWithDetail(sender, messageID, message, "", nil)
+	}
+	return failureResponseWithDetail(sender, messageID, message, "Error", apiErr)
+}
+
+// return a failure response including detail under key, if key is set
+func failureResponseWithDetail(sender, messageID, message, key string, detail any) ([]byte, error) {
+	fail := map[string]any{
+		"Success": false,
+		"Request": messageID,
+		"Message": message,
+		"Help":    "Send 'help' in Subject line for valid commands",
+	}
+	if key != "" {
+		fail[key] = detail
+	}
+	result, err := json.MarshalIndent(&fail, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func timeoutResponse(sender, messageID, command string) ([]byte, string, error) {
+	message := fmt.Sprintf("%s %s timed out after %v", sender, command, CommandTimeout(command))
+	response, err := failureResponse(sender, messageID, message)
+	return response, "timeout", err
+}
+
+func unknownCommandResponse(sender, messageID, command string) ([]byte, string, error) {
+	response, err := failureResponse(sender, messageID, fmt.Sprintf("%s unknown command: %s", sender, command))
+	return response, "unknown", err
+}
+
+// describe a server error response to the sender
+func apiErrorResponse(sender, messageID, command string, apiErr *client.APIError) ([]byte, string, error) {
+	var message, status string
+	switch {
+	case errors.Is(apiErr, client.ErrUnauthorized):
+		message = fmt.Sprintf("%s %s failed: the filter server rejected the filterctl credentials; please report this to the administrator", sender, command)
+		status = "unauthorized"
+	case errors.Is(apiErr, client.ErrNotFound):
+		message = fmt.Sprintf("%s %s failed: not found: %s", sender, command, apiErr.Message)
+		status = "not_found"
+	case apiErr.Retryable:
+		message = fmt.Sprintf("%s %s failed: the filter server is temporarily unavailable; please try again later", sender, command)
+		status = "server_error"
+	case errors.Is(apiErr, client.ErrServer):
+		message = fmt.Sprintf("%s %s failed: server error: %s", sender, command, apiErr.Message)
+		status = "server_error"
+	default:
+		message = fmt.Sprintf("%s %s failed: request rejected: %s", sender, command, apiErr.Message)
+		status = "rejected"
+	}
+	response, err := failureResponseWithError(sender, messageID, message, apiErr)
+	return response, status, err
+}
+
+// describe the problems found in an invalid request to the sender
+func invalidRequestResponse(sender, messageID, command string, invalid *ValidationError) ([]byte, string, error) {
+	problems := "problems"
+	if len(invalid.Violations) == 1 {
+		problems = "problem"
+	}
+	message := fmt.Sprintf("%s %s failed: %d %s found; nothing was changed", sender, command, len(invalid.Violations), problems)
+	response, err := failureResponseWithDetail(sender, messageID, message, "Violations", invalid.Violations)
+	return response, "invalid", err
+}
+
+func internalFailureResponse(sender, messageID string) ([]byte, string, error) {
+	response, err := failureResponse(sender, messageID, fmt.Sprintf("%s internal failure", sender))
+	return response, "error", err
+}
+
+// describe a failed command to the sender, including the changes made
+// before the failure, if any
+func commandFailureResponse(sender, messageID, command string, cause error) ([]byte, string, error) {
+	var response []byte
+	var status string
+	var err error
+	var apiErr *client.APIError
+	var invalid *ValidationError
+	switch {
+	case errors.As(cause, &apiErr):
+		response, status, err = apiErrorResponse(sender, messageID, command, apiErr)
+	case errors.As(cause, &invalid):
+		response, status, err = invalidRequestResponse(sender, messageID, command, invalid)
+	default:
+		response, status, err = internalFailureResponse(sender, messageID)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	response, err = addPartialResult(response, cause)
+	return response, status, err
+}
+
+// add the Result of a PartialError to a failure response as Partial
+func addPartialResult(response []byte, err error) ([]byte, error) {
+	var partial *PartialError
+	if !errors.As(err, &partial) {
+		return response, nil
+	}
+	var fail map[string]any
+	decodeErr := json.Unmarshal(response, &fail)
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	fail["Partial"] = partial.Result
+	return json.MarshalIndent(&fail, "", "  ")
+}
+
+// run the registered command in this process, returning the response body
+func executeInProcess(ctx context.Context, sender, messageID string, args []string, body []byte) ([]byte, string, error) {
+	rc := RequestContext{
+		Sender:    sender,
+		RequestID: messageID,
+		Command:   args[0],
+		Args:      args[1:],
+		Body:      body,
+	}
+	result, err := DispatchCommand(ctx, &rc)
+	if err != nil {
+		log.Printf("%s failed: %v\n", rc.Command, err)
+		if errors.Is(err, ErrUnknownCommand) {
+			return unknownCommandResponse(sender, messageID, rc.Command)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return timeoutResponse(sender, messageID, rc.Command)
+		}
+		if errors.Is(err, client.ErrUnavailable) {
+			return nil, "tempfail", err
+		}
+		return commandFailureResponse(sender, messageID, rc.Command, err)
+	}
+	response, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	return response, responseStatus(response), nil
+}
+
+// return the child process arguments for a subject line command.  The
+// subject line flags are placed before "--" so that the remaining
+// arguments, such as negative scores, are not parsed as flags by the child.
+func subprocessArgs(args []string) ([]string, error) {
+	rc := RequestContext{Command: args[0], Args: args[1:]}
+	err := rc.parseFlags(!commands[rc.Command].nested)
+	if err != nil {
+		return args, err
+	}
+	childArgs := []string{rc.Command}
+	if rc.DryRun {
+		childArgs = append(childArgs, "--dry-run")
+	}
+	childArgs = append(childArgs, "--")
+	return append(childArgs, rc.Args...), nil
+}
+
+// run the command in a child process, returning the response body
+func executeSubprocess(ctx context.Context, sender, messageID string, args []string, body []byte) ([]byte, string, error) {
+	verbose := viper.GetBool("verbose")
+
+	if _, ok := commands[args[0]]; !ok {
+		return unknownCommandResponse(sender, messageID, args[0])
+	}
+
+	args, err := subprocessArgs(args)
+	if err != nil {
+		log.Printf("%s failed: %v\n", args[0], err)
+		return commandFailureResponse(sender, messageID, args[0], err)
+	}
+	if cfgFile != "" {
+		// the child reads the config file named on the parent's command line
+		args = slices.Insert(args, 1, "--config", cfgFile)
+	}
+
+	if len(body) > 0 {
+		filename, err := scanJSONBodyToTempFile(bytes.NewReader(body))
+		if err != nil {
+			return nil, "", err
+		}
+		// the child removes the file after reading it
+		defer os.Remove(filename)
+		args = append(args, filename)
 	}
+
 	viper.Set("sender", sender)
 	viper.Set("message_id", EncodedMessageID(messageID))
-	cmd := exec.Command(os.Args[0], args...)
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout(args[0]))
+	defer cancel()
+	cmd := exec.CommandContext(ctx, os.Args[0], args...)
 
 	cmd.Env = []string{}
 	for _, key := range []string{"HOME", "PATH", "TERM"} {
 		value := fmt.Sprintf("%s=%s", key, os.Getenv(key))
 		cmd.Env = append(cmd.Env, value)
 	}
-	for key, value := range viper.AllSettings() {
-		value := fmt.Sprintf("FILTERCTL_%s=%v", strings.ToUpper(key), value)
+	// nested keys such as timeouts.default are exported individually; a
+	// variable for the parent key would hide them from the child's viper
+	for _, key := range viper.AllKeys() {
+		value := fmt.Sprintf("FILTERCTL_%s=%v", strings.ToUpper(key), viper.Get(key))
 		cmd.Env = append(cmd.Env, value)
 	}
 
@@ -337,63 +693,40 @@ func ExecuteCommand(sender, messageID string, args []string) error {
 		LogLines("SUBPROCESS_STDERR", stderr)
 	}
 
-	if err != nil || exitCode != 0 {
-		fail := map[string]any{
-			"Success": false,
-			"Request": messageID,
-			"Message": fmt.Sprintf("%s internal failure", sender),
-			"Help":    "Send 'help' in Subject line for valid commands",
-		}
-		if verbose {
-			detail := map[string]any{}
-			if err != nil {
-				detail["err"] = fmt.Sprintf("%v", err)
-			}
-			detail["exit"] = exitCode
-			ostr := strings.TrimSpace(string(stdout))
-			if len(ostr) > 0 {
-				detail["stdout"] = strings.Split(ostr, "\n")
-			}
-			estr := strings.TrimSpace(string(stderr))
-			if len(estr) > 0 {
-				detail["stderr"] = strings.Split(estr, "\n")
-			}
-		}
-		result, err := json.MarshalIndent(&fail, "", "  ")
-		if err != nil {
-			return err
-		}
-		stdout = result
+	if ctx.Err() == context.DeadlineExceeded {
+		return timeoutResponse(sender, messageID, args[0])
 	}
-
-	// generate RFC2822 email message
-	responseSubject := fmt.Sprintf("filterctl response %s", viper.GetString("message-id"))
-	message, err := formatEmailMessage(messageID, responseSubject, sender, "filterctl@"+Domains[0], stdout)
 	if err != nil {
-		return err
+		return internalFailureResponse(sender, messageID)
 	}
-
-	if verbose {
-		LogLines("RESPONSE", message)
-	}
-
-	if viper.GetBool("disable_response") {
-		fmt.Println(string(message))
-		return nil
-	}
-
-	sendmail := exec.Command("sendmail", sender)
-	sendmail.Stdin = bytes.NewBuffer(message)
-	exitCode, stdout, stderr, err = run(sendmail)
-	if err != nil {
-		return err
+	if exitCode == EX_TEMPFAIL {
+		return nil, "tempfail", fmt.Errorf("%w: %s exited %d", client.ErrUnavailable, args[0], exitCode)
 	}
 	if exitCode != 0 {
-		log.Printf("sendmail exited %d\n", exitCode)
-		LogLines("SENDMAIL_STDOUT", stdout)
-		LogLines("SENDMAIL_STDERR", stderr)
+		// the command writes a failure response for server and validation
+		// errors
+		var response struct {
+			Error      *client.APIError
+			Violations []string
+			Partial    json.RawMessage
+		}
+		var cause error
+		switch {
+		case json.Unmarshal(stdout, &response) != nil:
+			return internalFailureResponse(sender, messageID)
+		case response.Error != nil:
+			cause = response.Error
+		case len(response.Violations) > 0:
+			cause = &ValidationError{Violations: response.Violations}
+		default:
+			return internalFailureResponse(sender, messageID)
+		}
+		if response.Partial != nil {
+			cause = &PartialError{Result: response.Partial, Err: cause}
+		}
+		return commandFailureResponse(sender, messageID, args[0], cause)
 	}
-	return nil
+	return stdout, responseStatus(stdout), nil
 }
 
 func run(cmd *exec.Cmd) (int, []byte, []byte, error) {
@@ -416,14 +749,27 @@ func run(cmd *exec.Cmd) (int, []byte, []byte, error) {
 	return exitCode, oBuf.Bytes(), eBuf.Bytes(), nil
 }
 
-func NewFilterctlClient() *APIClient {
-	url := viper.GetString("server_url")
-	api, err := NewAPIClient(url)
-	cobra.CheckErr(err)
-	if viper.GetString("sender") == "" {
-		cobra.CheckErr(errors.New("missing sender"))
+func NewFilterctlClient(rc *RequestContext) (*APIClient, error) {
+	if rc.Sender == "" {
+		return nil, errors.New("missing sender")
+	}
+	api, err := NewAPIClient(viper.GetString("server_url"))
+	if err != nil {
+		return nil, err
+	}
+	api.User = rc.Sender
+	api.Request = rc.RequestID
+	return api, nil
+}
+
+func NewRescanClient(rc *RequestContext) (*APIClient, error) {
+	api, err := NewAPIClient(viper.GetString("rescand_url"))
+	if err != nil {
+		return nil, err
 	}
-	return api
+	api.User = rc.Sender
+	api.Request = rc.RequestID
+	return api, nil
 }
 
 func PrintVersion() {
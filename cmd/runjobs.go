@@ -0,0 +1,136 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rstms/filterctl/pkg/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// runjobsCmd represents the runjobs command
+var runjobsCmd = &cobra.Command{
+	Use:   "runjobs",
+	Short: "run due scheduled commands",
+	Long: `
+Execute the scheduled commands which are due, mailing each response to the
+user who scheduled it.  This command is intended to be run periodically by
+cron or a systemd timer, for example every minute:
+
+    * * * * * /usr/local/bin/filterctl runjobs
+
+If --sender is set, only that user's jobs are run.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		senders := []string{viper.GetString("sender")}
+		if senders[0] == "" {
+			var err error
+			senders, err = JobSenders()
+			cobra.CheckErr(err)
+		}
+		failed := []error{}
+		for _, sender := range senders {
+			err := RunJobs(cmd.Context(), sender, time.Now())
+			if err != nil {
+				log.Printf("runjobs: %s: %v\n", sender, err)
+				failed = append(failed, err)
+			}
+		}
+		cobra.CheckErr(errors.Join(failed...))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runjobsCmd)
+}
+
+// take the sender's jobs which are due at now from the schedule, advancing
+// recurring jobs to their next run time
+func dueJobs(sender string, now time.Time) ([]*Job, error) {
+	due := []*Job{}
+	err := UpdateJobs(sender, func(jobs []*Job) ([]*Job, error) {
+		remaining := []*Job{}
+		for _, job := range jobs {
+			if job.Next.After(now) {
+				remaining = append(remaining, job)
+				continue
+			}
+			run := *job
+			due = append(due, &run)
+			if job.Schedule == "" {
+				continue
+			}
+			next := job.Next
+			for !next.After(now) {
+				var err error
+				next, err = NextScheduled(job.Schedule, next)
+				if err != nil {
+					log.Printf("runjobs: %s: cancelled job %s: %v\n", sender, job.ID, err)
+					break
+				}
+			}
+			if next.After(now) {
+				job.Next = next
+				remaining = append(remaining, job)
+			}
+		}
+		return remaining, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return due, nil
+}
+
+// RunJobs executes the sender's due jobs through the mail command path.
+// Jobs are removed or rescheduled before they run, so a job that fails is
+// not retried unless the server was unavailable.
+func RunJobs(ctx context.Context, sender string, now time.Time) error {
+	jobs, err := dueJobs(sender, now)
+	if err != nil {
+		return err
+	}
+	failed := []error{}
+	for _, job := range jobs {
+		if viper.GetBool("verbose") {
+			log.Printf("runjobs: %s: job %s: %s %v\n", sender, job.ID, job.Command, job.Args)
+		}
+		args := append([]string{job.Command}, job.Args...)
+		err := ExecuteCommand(ctx, sender, job.RequestID, args, nil)
+		if errors.Is(err, client.ErrUnavailable) && job.Schedule == "" {
+			// run the job again when the server returns
+			log.Printf("runjobs: %s: deferring job %s: %v\n", sender, job.ID, err)
+			err = AddJob(job)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Errorf("job %s: %v", job.ID, err))
+		}
+	}
+	return errors.Join(failed...)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// savepresetCmd represents the savepreset command
+var savepresetCmd = &cobra.Command{
+	Use:   "savepreset NAME",
+	Short: "save the current classes as a personal preset",
+	Long: `
+Save the sender's current class names and thresholds as a personal preset
+named NAME, replacing any personal preset with the same name.  NAME may not
+be the name of a preset defined by the mail system operator.
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		RunCommand(cmd, args, nil)
+	},
+}
+
+type savepresetCommand struct{}
+
+// return the preset to be saved from the sender's current classes
+func planSavePreset(ctx context.Context, rc *RequestContext) (*Preset, error) {
+	name, err := presetName(rc.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	system, err := SystemPresets()
+	if err != nil {
+		return nil, err
+	}
+	for _, preset := range system {
+		if preset.Name == name {
+			return nil, validationResult([]string{fmt.Sprintf("'%s' is the name of a system preset", name)})
+		}
+	}
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	table, err := currentClasses(ctx, filterctl, rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	return &Preset{Name: name, Personal: true, Classes: table}, nil
+}
+
+// return a ValidationError if saving name would exceed the preset limit
+func checkPresetLimit(presets map[string][]classes.SpamClass, name string) error {
+	limit := viper.GetInt("presets_limit")
+	if _, ok := presets[name]; !ok && limit > 0 && len(presets) >= limit {
+		return validationResult([]string{fmt.Sprintf("personal preset limit %d reached", limit)})
+	}
+	return nil
+}
+
+func (savepresetCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	preset, err := planSavePreset(ctx, rc)
+	if err != nil {
+		return nil, err
+	}
+	err = updatePersonalPresets(rc.Sender, func(presets map[string][]classes.SpamClass) error {
+		err := checkPresetLimit(presets, preset.Name)
+		if err != nil {
+			return err
+		}
+		presets[preset.Name] = preset.Classes
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newPresetResponse(rc, *preset, "saved "+preset.Name), nil
+}
+
+func (savepresetCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	preset, err := planSavePreset(ctx, rc)
+	if err != nil {
+		return nil, err
+	}
+	presets, err := readPersonalPresets(rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+	err = checkPresetLimit(presets, preset.Name)
+	if err != nil {
+		return nil, err
+	}
+	return newPresetDryRunResponse(rc, *preset, "dry run: would save "+preset.Name), nil
+}
+
+func init() {
+	rootCmd.AddCommand(savepresetCmd)
+	RegisterCommand(savepresetCmd, savepresetCommand{})
+}
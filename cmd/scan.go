@@ -22,10 +22,9 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // scanCmd represents the scan command
@@ -37,16 +36,22 @@ Return a list of address books containing the scanned ADDRESS
 `,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		filterctl := NewFilterctlClient()
-		address := args[0]
-		var response APIBooksResponse
-		path := fmt.Sprintf("/filterctl/scan/%s/%s/", viper.GetString("sender"), address)
-		text, err := filterctl.Get(path, &response)
-		cobra.CheckErr(err)
-		fmt.Println(text)
+		RunCommand(cmd, args, nil)
 	},
 }
 
+type scanCommand struct{}
+
+func (scanCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	address := rc.Args[0]
+	return filterctl.Scan(ctx, rc.Sender, address)
+}
+
 func init() {
 	rootCmd.AddCommand(scanCmd)
+	RegisterCommand(scanCmd, scanCommand{})
 }
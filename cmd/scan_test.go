@@ -1,24 +1,26 @@
 package cmd
 
 import (
-	"fmt"
+	"context"
+	"testing"
+
 	"github.com/rstms/mabctl/api"
-	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
-	"testing"
 )
 
 func TestScanCommand(t *testing.T) {
-	err := InitIdentity()
-	require.Nil(t, err)
-	filterctl := NewFilterctlClient()
+	configure(t)
+	server := startFakeServer(t)
 	sender := "sender@example.org"
 	address := "address@example.org"
-	viper.Set("message_id", EncodedMessageID("test scan message id"))
-	var response api.BooksResponse
-	path := fmt.Sprintf("/filterctl/scan/%s/%s/", sender, address)
-	text, err := filterctl.Get(path, &response)
+	server.Filterctld.Seed(sender, api.UserDump{Books: map[string][]string{
+		"friends": {address},
+		"work":    {"boss@example.org"},
+	}})
+	filterctl, err := NewFilterctlClient(&RequestContext{Sender: sender, RequestID: "test scan message id"})
+	require.Nil(t, err)
+	response, err := filterctl.Scan(context.Background(), sender, address)
 	require.Nil(t, err)
-	fmt.Printf("text=%v\n", text)
-	fmt.Printf("response=%v\n", response)
+	require.Equal(t, []string{"friends"}, response.Books)
+	require.Equal(t, "test scan message id", response.Request)
 }
@@ -0,0 +1,179 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const MIN_JOB_INTERVAL = time.Minute
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02@15:04",
+	"2006-01-02",
+}
+
+// parse an interval such as '90m', '12h', '7d' or '2w'
+func parseInterval(value string) (time.Duration, bool) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(value, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(value, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit != 0 {
+		count, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil || count < 1 {
+			return 0, false
+		}
+		return time.Duration(count) * unit, true
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, false
+	}
+	return duration, true
+}
+
+// parse a time of day as HH:MM
+func parseClock(value string) (int, int, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time of day '%s': expected HH:MM", value)
+	}
+	return clock.Hour(), clock.Minute(), nil
+}
+
+// return the first time after 'after' matching a day specification (a
+// weekday name or 'tomorrow') and time of day, which are both optional
+// and separated by '@'.  The boolean result is false if value does not
+// name a day or time of day.
+func nextOccurrence(value string, after time.Time) (time.Time, bool, error) {
+	day, clock, hasClock := strings.Cut(strings.ToLower(value), "@")
+	weekday, isWeekday := weekdays[day]
+	if !hasClock && !isWeekday && day != "tomorrow" {
+		if _, _, err := parseClock(day); err != nil {
+			return time.Time{}, false, nil
+		}
+		day, clock, hasClock = "", day, true
+	}
+	if day != "" && day != "tomorrow" && !isWeekday {
+		return time.Time{}, false, nil
+	}
+	hour, minute := 0, 0
+	if hasClock {
+		var err error
+		hour, minute, err = parseClock(clock)
+		if err != nil {
+			return time.Time{}, true, err
+		}
+	}
+	start := time.Date(after.Year(), after.Month(), after.Day(), hour, minute, 0, 0, after.Location())
+	switch {
+	case day == "":
+		if !start.After(after) {
+			start = start.AddDate(0, 0, 1)
+		}
+		return start, true, nil
+	case day == "tomorrow":
+		return start.AddDate(0, 0, 1), true, nil
+	case isWeekday:
+		days := (int(weekday) - int(start.Weekday()) + 7) % 7
+		start = start.AddDate(0, 0, days)
+		if !start.After(after) {
+			start = start.AddDate(0, 0, 7)
+		}
+		return start, true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+// ParseWhen returns the time specified by the WHEN argument of the at
+// command
+func ParseWhen(when string, now time.Time) (time.Time, error) {
+	if interval, ok := parseInterval(when); ok {
+		return now.Add(interval), nil
+	}
+	next, ok, err := nextOccurrence(when, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ok {
+		return next, nil
+	}
+	for _, layout := range dateLayouts {
+		next, err := time.ParseInLocation(layout, when, now.Location())
+		if err == nil {
+			if !next.After(now) {
+				return time.Time{}, fmt.Errorf("time '%s' is in the past", when)
+			}
+			return next, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s'", when)
+}
+
+// NextScheduled returns the first time after 'after' matching the SCHEDULE
+// argument of the every command
+func NextScheduled(schedule string, after time.Time) (time.Time, error) {
+	switch strings.ToLower(schedule) {
+	case "hourly":
+		schedule = "1h"
+	case "daily":
+		schedule = "1d"
+	case "weekly":
+		schedule = "1w"
+	}
+	if interval, ok := parseInterval(schedule); ok {
+		if interval < MIN_JOB_INTERVAL {
+			return time.Time{}, fmt.Errorf("schedule interval '%s' is less than %v", schedule, MIN_JOB_INTERVAL)
+		}
+		return after.Add(interval), nil
+	}
+	if strings.HasPrefix(strings.ToLower(schedule), "tomorrow") {
+		return time.Time{}, fmt.Errorf("invalid schedule '%s'", schedule)
+	}
+	next, ok, err := nextOccurrence(schedule, after)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid schedule '%s'", schedule)
+	}
+	return next, nil
+}
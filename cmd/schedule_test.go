@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseWhen(t *testing.T) {
+	// Sunday
+	now := time.Date(2024, 6, 2, 12, 30, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		"90m":              now.Add(90 * time.Minute),
+		"2d":               now.AddDate(0, 0, 2),
+		"1w":               now.AddDate(0, 0, 7),
+		"18:00":            time.Date(2024, 6, 2, 18, 0, 0, 0, time.UTC),
+		"08:00":            time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC),
+		"tomorrow":         time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC),
+		"monday@09:15":     time.Date(2024, 6, 3, 9, 15, 0, 0, time.UTC),
+		"sunday@06:00":     time.Date(2024, 6, 9, 6, 0, 0, 0, time.UTC),
+		"2024-07-04":       time.Date(2024, 7, 4, 0, 0, 0, 0, time.UTC),
+		"2024-07-04@17:00": time.Date(2024, 7, 4, 17, 0, 0, 0, time.UTC),
+	}
+	for when, expected := range cases {
+		next, err := ParseWhen(when, now)
+		require.Nil(t, err, when)
+		require.Equal(t, expected, next, when)
+	}
+	for _, when := range []string{"", "fnord", "25:00", "monday@noon", "2024-01-01", "-1h"} {
+		_, err := ParseWhen(when, now)
+		require.NotNil(t, err, when)
+	}
+}
+
+func TestNextScheduled(t *testing.T) {
+	now := time.Date(2024, 6, 2, 12, 30, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		"hourly":      now.Add(time.Hour),
+		"daily":       now.AddDate(0, 0, 1),
+		"6h":          now.Add(6 * time.Hour),
+		"12:30":       time.Date(2024, 6, 3, 12, 30, 0, 0, time.UTC),
+		"fri@18:00":   time.Date(2024, 6, 7, 18, 0, 0, 0, time.UTC),
+		"sunday@6:00": time.Date(2024, 6, 9, 6, 0, 0, 0, time.UTC),
+	}
+	for schedule, expected := range cases {
+		next, err := NextScheduled(schedule, now)
+		require.Nil(t, err, schedule)
+		require.Equal(t, expected, next, schedule)
+	}
+	for _, schedule := range []string{"tomorrow", "10s", "2024-07-04", "fnord"} {
+		_, err := NextScheduled(schedule, now)
+		require.NotNil(t, err, schedule)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	viper.Set("jobs_dir", t.TempDir())
+	viper.Set("jobs_limit", 2)
+	defer viper.Set("jobs_dir", "")
+	now := time.Now()
+	rc := RequestContext{Sender: "user@example.com", RequestID: "jobs test", Command: "every"}
+
+	_, err := NewJob(&rc, "1h", now, []string{"restore"})
+	require.ErrorContains(t, err, "cannot be scheduled")
+	_, err = NewJob(&rc, "1h", now, []string{"set"})
+	require.NotNil(t, err)
+
+	once, err := NewJob(&rc, "", now.Add(-time.Minute), []string{"set", "--dry-run", "ham=2"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"--dry-run", "ham=2"}, once.Args)
+	require.Nil(t, AddJob(once))
+	hourly, err := NewJob(&rc, "1h", now.Add(-90*time.Minute), []string{"classes"})
+	require.Nil(t, err)
+	require.Nil(t, AddJob(hourly))
+	require.ErrorContains(t, AddJob(hourly), "limit")
+
+	due, err := dueJobs(rc.Sender, now)
+	require.Nil(t, err)
+	require.Len(t, due, 2)
+	jobs, err := ReadJobs(rc.Sender)
+	require.Nil(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, hourly.ID, jobs[0].ID)
+	require.Equal(t, hourly.Next.Add(2*time.Hour).Unix(), jobs[0].Next.Unix())
+
+	senders, err := JobSenders()
+	require.Nil(t, err)
+	require.Equal(t, []string{rc.Sender}, senders)
+}
+
+func TestDispatchNestedCommand(t *testing.T) {
+	viper.Set("jobs_dir", t.TempDir())
+	defer viper.Set("jobs_dir", "")
+	rc := RequestContext{Sender: "user@example.com", RequestID: "nested test", Command: "at", Args: []string{"1h", "reset", "--dry-run"}}
+	result, err := DispatchCommand(context.Background(), &rc)
+	require.Nil(t, err)
+	response, ok := result.(*APIJobResponse)
+	require.True(t, ok)
+	require.False(t, rc.DryRun)
+	require.Equal(t, "reset", response.Job.Command)
+	require.Equal(t, []string{"--dry-run"}, response.Job.Args)
+}
+
+func TestJobRequestErrors(t *testing.T) {
+	viper.Set("jobs_dir", t.TempDir())
+	viper.Set("jobs_limit", 1)
+	defer viper.Set("jobs_dir", "")
+	defer viper.Set("jobs_limit", 20)
+	ctx := context.Background()
+	sender := "user@example.com"
+	cases := []struct {
+		Command   string
+		Args      []string
+		Violation string
+	}{
+		{"at", []string{"banana", "classes"}, "invalid time 'banana'"},
+		{"every", []string{"fortnightly", "classes"}, "invalid schedule 'fortnightly'"},
+		{"at", []string{"1h", "fnord"}, "unknown command: fnord"},
+		{"every", []string{"daily", "jobs"}, "command 'jobs' cannot be scheduled"},
+		{"canceljob", []string{"nosuch"}, "job not found: nosuch"},
+	}
+	for _, c := range cases {
+		rc := RequestContext{Sender: sender, Command: c.Command, Args: c.Args}
+		_, err := DispatchCommand(ctx, &rc)
+		var invalid *ValidationError
+		require.True(t, errors.As(err, &invalid), c.Args)
+		require.Equal(t, []string{c.Violation}, invalid.Violations)
+	}
+
+	// dry runs report the job without changing the schedule
+	rc := RequestContext{Sender: sender, Command: "at", Args: []string{"--dry-run", "1h", "classes"}}
+	result, err := DispatchCommand(ctx, &rc)
+	require.Nil(t, err)
+	require.True(t, result.(*APIJobResponse).DryRun)
+	jobs, err := ReadJobs(sender)
+	require.Nil(t, err)
+	require.Empty(t, jobs)
+
+	rc = RequestContext{Sender: sender, Command: "every", Args: []string{"daily", "classes"}}
+	result, err = DispatchCommand(ctx, &rc)
+	require.Nil(t, err)
+	id := result.(*APIJobResponse).Job.ID
+
+	rc = RequestContext{Sender: sender, Command: "every", Args: []string{"-n", "daily", "classes"}}
+	_, err = DispatchCommand(ctx, &rc)
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid))
+	require.Equal(t, []string{"scheduled job limit 1 reached"}, invalid.Violations)
+
+	rc = RequestContext{Sender: sender, Command: "canceljob", Args: []string{"--dry-run", id}}
+	result, err = DispatchCommand(ctx, &rc)
+	require.Nil(t, err)
+	require.True(t, result.(*APIJobResponse).DryRun)
+	jobs, err = ReadJobs(sender)
+	require.Nil(t, err)
+	require.Len(t, jobs, 1)
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/rstms/filterctl/pkg/fakeserver"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+// start fake filterctld and rescand servers and configure the API clients
+// to use them for the duration of the test
+func startFakeServer(t *testing.T) *fakeserver.Server {
+	server, err := fakeserver.Start(t.TempDir())
+	require.Nil(t, err)
+	t.Cleanup(server.Close)
+	settings := map[string]any{
+		"server_url":        server.FilterctldURL(),
+		"rescand_url":       server.RescandURL(),
+		"cert":              server.Certs.ClientCert,
+		"key":               server.Certs.ClientKey,
+		"ca":                server.Certs.CA,
+		"breaker.threshold": 0,
+	}
+	for key, value := range settings {
+		previous := viper.Get(key)
+		viper.Set(key, value)
+		t.Cleanup(func() { viper.Set(key, previous) })
+	}
+	return server
+}
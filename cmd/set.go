@@ -22,45 +22,136 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"strconv"
 
+	"github.com/rstms/rspamd-classes/classes"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // setCmd represents the set command
 var setCmd = &cobra.Command{
-	Use:   "set CLASS=THRESHOLD",
-	Short: "set a single class name and threshold",
+	Use:   "set [+SUFFIX] CLASS=THRESHOLD [CLASS=THRESHOLD ...]",
+	Short: "set class names and thresholds",
 	Long: `
-Add or update a single class name and threshold value.
+Add or update one or more class names and threshold values.
 CLASS is an identifier string.
 THRESHOLD is a floating point number.
+Multiple assignments are applied together as a single change to the class
+table.  For example: 'set ham=2 probable=6 suspicious=9'
+The change is rejected if the resulting class table would reorder the
+classes, repeat a threshold, or change the fixed 'spam' threshold of 999.
+A leading +SUFFIX argument changes the classes used for mail addressed to the
+sender's plus-suffix address, starting from the sender's classes when the
+suffix has no table of its own.  For example: 'set +lists bulk=3'
 `,
-	Args: cobra.ExactArgs(1),
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		filterctl := NewFilterctlClient()
-		var response APIResponse
-		class := args[0]
-		matches := CLASS_PATTERN.FindStringSubmatch(class)
+		RunCommand(cmd, args, nil)
+	},
+}
 
-		if len(matches) != 3 {
-			cobra.CheckErr(fmt.Errorf("failed to parse class specifier '%s'", class))
-		}
-		name := matches[1]
-		threshold := matches[2]
-		_, err := strconv.ParseFloat(threshold, 32)
+type setCommand struct{}
+
+// setPlan holds the classes to set, the current class table of the selected
+// scope, and the table resulting from the set request, which must be valid
+type setPlan struct {
+	Scope       ClassScope
+	Assignments []classes.SpamClass
+	Before      []classes.SpamClass
+	After       []classes.SpamClass
+}
+
+func planSet(ctx context.Context, filterctl *APIClient, rc *RequestContext) (*setPlan, error) {
+	scope, args, err := parseClassScope(rc.Sender, rc.Args)
+	if err != nil {
+		return nil, err
+	}
+	assignments := []classes.SpamClass{}
+	violations := []string{}
+	if len(args) == 0 {
+		violations = append(violations, "no class assignments")
+	}
+	names := make(map[string]bool)
+	for _, arg := range args {
+		class, err := parseClassSpec(arg)
 		if err != nil {
-			cobra.CheckErr(fmt.Errorf("invalid threshold value in class specifier '%s' ", class))
+			violations = append(violations, err.Error())
+			continue
 		}
+		if names[class.Name] {
+			violations = append(violations, fmt.Sprintf("class '%s' is listed more than once", class.Name))
+		}
+		names[class.Name] = true
+		assignments = append(assignments, class)
+	}
+	if len(violations) > 0 {
+		return nil, validationResult(violations)
+	}
+	before, _, err := scopeClasses(ctx, filterctl, scope)
+	if err != nil {
+		return nil, err
+	}
+	after := before
+	for _, class := range assignments {
+		after = mergeClass(after, class)
+	}
+	err = validateClasses(after)
+	if err != nil {
+		return nil, err
+	}
+	return &setPlan{Scope: scope, Assignments: assignments, Before: before, After: after}, nil
+}
 
-		text, err := filterctl.Put(fmt.Sprintf("/filterctl/classes/%s/%s/%s/", viper.GetString("sender"), name, threshold), &response)
-		cobra.CheckErr(err)
-		fmt.Println(text)
-	},
+func (setCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planSet(ctx, filterctl, rc)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Scope.Suffix == "" && len(plan.Assignments) == 1 {
+		return filterctl.SetClass(ctx, rc.Sender, plan.Assignments[0].Name, plan.Assignments[0].Score)
+	}
+	// submit the complete table so the filter never sees a partial change,
+	// and a suffix without a table receives a copy of the sender's classes
+	response, err := resetScopeClasses(ctx, filterctl, plan.Scope, plan.After)
+	if err != nil {
+		return nil, err
+	}
+	if len(plan.Assignments) == 1 {
+		class := plan.Assignments[0]
+		response.Message = fmt.Sprintf("%s set %s=%s", plan.Scope.Address(), class.Name, formatThreshold(class.Score))
+	} else {
+		response.Message = fmt.Sprintf("%s set %d classes", plan.Scope.Address(), len(plan.Assignments))
+	}
+	return response, nil
+}
+
+func (setCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planSet(ctx, filterctl, rc)
+	if err != nil {
+		return nil, err
+	}
+	return newDryRunResponse(rc, diffClasses(plan.Before, normalizeClasses(plan.After)), nil), nil
+}
+
+func (setCommand) SnapshotScope(rc *RequestContext) (string, error) {
+	return CLASSES_SCOPE, nil
+}
+
+func (setCommand) ClassScope(rc *RequestContext) (ClassScope, error) {
+	scope, _, err := parseClassScope(rc.Sender, rc.Args)
+	return scope, err
 }
 
 func init() {
 	rootCmd.AddCommand(setCmd)
+	RegisterCommand(setCmd, setCommand{})
 }
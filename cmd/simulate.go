@@ -0,0 +1,189 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/spf13/cobra"
+)
+
+// the maximum number of changed messages listed in a simulate response
+const SIMULATE_LIST_LIMIT = 100
+
+// simulateCmd represents the simulate command
+var simulateCmd = &cobra.Command{
+	Use:   "simulate MAILBOX [CLASS=THRESHOLD ... | PRESET]",
+	Short: "simulate a class table against stored messages",
+	Long: `
+Count the messages which fall into each class under the sender's current
+class table and under a proposed table, using the X-Spam-Score header of
+each stored message.  The messages which would change class are listed.
+MAILBOX is a Maildir directory or an mbox file.  The proposed table is given
+as for the reset command; if it is omitted, the default classes are used.
+When used with the email subject line command the message body must contain
+the simulation data as JSON text: a 'Table' list holding the reset
+arguments, and a 'Messages' list with the 'Score' and optional 'Class',
+'MessageID' and 'Subject' values of each message.
+`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 1 && isRequestFile(args[0]) {
+			RunBodyCommand(cmd, args[0])
+			return
+		}
+		messages, skipped, err := ReadMailbox(args[0])
+		cobra.CheckErr(err)
+		request := APISimulateRequest{Table: args[1:], Skipped: skipped, Messages: messages}
+		body, err := json.Marshal(&request)
+		cobra.CheckErr(err)
+		RunCommand(cmd, []string{}, body)
+	},
+}
+
+type APISimulateRequest struct {
+	Table    []string
+	Skipped  int `json:",omitempty"`
+	Messages []SpamHeaders
+}
+
+type ClassCount struct {
+	Class    string
+	Current  int
+	Proposed int
+}
+
+type SimulatedChange struct {
+	MessageID string `json:",omitempty"`
+	Subject   string `json:",omitempty"`
+	Score     float32
+	Header    string `json:",omitempty"`
+	Current   string
+	Proposed  string
+}
+
+type APISimulateResponse struct {
+	APIResponse
+	Current  []classes.SpamClass
+	Proposed []classes.SpamClass
+	Messages int
+	Skipped  int
+	Counts   []ClassCount
+	Changes  int
+	Changed  []SimulatedChange
+	Table    []string
+}
+
+type simulateCommand struct{}
+
+func (simulateCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	var request APISimulateRequest
+	err := json.Unmarshal(rc.Body, &request)
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding simulation data: %v", err)
+	}
+	proposed, err := requestedClasses(rc.Sender, request.Table)
+	if err != nil {
+		return nil, err
+	}
+	if len(proposed) == 0 {
+		proposed = classes.DefaultClasses
+	}
+	proposed = normalizeClasses(proposed)
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	current, err := currentClasses(ctx, filterctl, rc.Sender)
+	if err != nil {
+		return nil, err
+	}
+
+	classifyCurrent := newClassifier(current)
+	classifyProposed := newClassifier(proposed)
+	currentCounts := make(map[string]int)
+	proposedCounts := make(map[string]int)
+	var response APISimulateResponse
+	response.Changed = []SimulatedChange{}
+	for _, message := range request.Messages {
+		before := classifyCurrent(message.Score)
+		after := classifyProposed(message.Score)
+		currentCounts[before]++
+		proposedCounts[after]++
+		if before == after {
+			continue
+		}
+		response.Changes++
+		if len(response.Changed) < SIMULATE_LIST_LIMIT {
+			response.Changed = append(response.Changed, SimulatedChange{
+				MessageID: message.MessageID,
+				Subject:   message.Subject,
+				Score:     message.Score,
+				Header:    message.Class,
+				Current:   before,
+				Proposed:  after,
+			})
+		}
+	}
+	response.Counts = []ClassCount{}
+	for _, class := range classRows(proposed, current) {
+		response.Counts = append(response.Counts, ClassCount{
+			Class:    class.Name,
+			Current:  currentCounts[class.Name],
+			Proposed: proposedCounts[class.Name],
+		})
+	}
+
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s simulate: %d of %d messages change class", rc.Sender, response.Changes, len(request.Messages))
+	response.Current = current
+	response.Proposed = proposed
+	response.Messages = len(request.Messages)
+	response.Skipped = request.Skipped
+	response.Table = formatClassCounts(response.Counts)
+	return &response, nil
+}
+
+// return text table lines showing the message count of each class
+func formatClassCounts(counts []ClassCount) []string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "CLASS\tCURRENT\tPROPOSED\tCHANGE\n")
+	for _, count := range counts {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%+d\n", count.Class, count.Current, count.Proposed, count.Proposed-count.Current)
+	}
+	w.Flush()
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+}
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+	RegisterBodyCommand(simulateCmd, simulateCommand{})
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulateCommand(t *testing.T) {
+	configure(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	server.Filterctld.AddUser(sender, "test-password")
+	setPresets(t, map[string]any{"strict": []string{"ham=0", "probable=3", "spam=999"}})
+
+	request := APISimulateRequest{Table: []string{"strict"}, Skipped: 1, Messages: testSpamHeaders}
+	body, err := json.Marshal(&request)
+	require.Nil(t, err)
+	rc := RequestContext{Sender: sender, Command: "simulate", Body: body}
+	result, err := simulateCommand{}.Run(context.Background(), &rc)
+	require.Nil(t, err)
+	response := result.(*APISimulateResponse)
+	require.Equal(t, 3, response.Messages)
+	require.Equal(t, 1, response.Skipped)
+	require.Equal(t, []ClassCount{
+		{Class: "ham", Current: 1, Proposed: 1},
+		{Class: "probable", Current: 1, Proposed: 0},
+		{Class: "spam", Current: 1, Proposed: 2},
+	}, response.Counts)
+	require.Equal(t, 1, response.Changes)
+	require.Equal(t, []SimulatedChange{
+		{MessageID: "two@example.org", Subject: "café", Score: 7, Header: "probable", Current: "probable", Proposed: "spam"},
+	}, response.Changed)
+	require.Equal(t, []string{
+		"CLASS     CURRENT  PROPOSED  CHANGE",
+		"ham       1        1         +0",
+		"probable  1        0         -1",
+		"spam      1        2         +1",
+	}, response.Table)
+
+	request = APISimulateRequest{Table: []string{"ham=1", "spam=10"}, Messages: testSpamHeaders}
+	body, err = json.Marshal(&request)
+	require.Nil(t, err)
+	rc = RequestContext{Sender: sender, Command: "simulate", Body: body}
+	_, err = simulateCommand{}.Run(context.Background(), &rc)
+	require.ErrorContains(t, err, "the 'spam' class threshold is fixed at 999; got 10")
+}
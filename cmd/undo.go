@@ -0,0 +1,326 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/spf13/cobra"
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo [N]",
+	Short: "undo a configuration change",
+	Long: `
+Restore the classes or address books saved before the Nth most recent
+configuration change listed by the history command.  N defaults to 1, the
+most recent change.  The undo is itself recorded in the history, so it may
+also be undone.
+`,
+	Args: cobra.RangeArgs(0, 1),
+	Run: func(cmd *cobra.Command, args []string) {
+		RunCommand(cmd, args, nil)
+	},
+}
+
+type APIUndoResponse struct {
+	APIResponse
+	Undone  HistoryEntry
+	Classes []ClassChange            `json:",omitempty"`
+	Books   []BookChange             `json:",omitempty"`
+	Aliases map[string][]ClassChange `json:",omitempty"`
+}
+
+type undoCommand struct{}
+
+// return the snapshot selected by the undo argument
+func undoSnapshot(rc *RequestContext) (*Snapshot, int, error) {
+	index := 1
+	if len(rc.Args) > 0 {
+		value, err := strconv.Atoi(rc.Args[0])
+		if err != nil || value < 1 {
+			return nil, 0, validationResult([]string{fmt.Sprintf("invalid history index: '%s'", rc.Args[0])})
+		}
+		index = value
+	}
+	snapshots, err := ReadHistory(rc.Sender)
+	if err != nil {
+		return nil, 0, err
+	}
+	if index > len(snapshots) {
+		return nil, 0, validationResult([]string{fmt.Sprintf("history index %d out of range; %d changes saved", index, len(snapshots))})
+	}
+	return snapshots[index-1], index, nil
+}
+
+// return the changes required to restore the snapshot
+func planUndo(ctx context.Context, filterctl *APIClient, sender string, snapshot *Snapshot) ([]ClassChange, []BookChange, error) {
+	switch snapshot.Scope {
+	case CLASSES_SCOPE:
+		scope := ClassScope{Sender: sender, Suffix: snapshot.Alias}
+		changes, err := planClassesUndo(ctx, filterctl, scope, snapshot.Classes)
+		return changes, nil, err
+	case BOOKS_SCOPE:
+		before, err := currentDumpBooks(ctx, filterctl, sender)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, diffBooks(before, snapshot.Books), nil
+	}
+	return nil, nil, fmt.Errorf("unknown snapshot scope: %s", snapshot.Scope)
+}
+
+// return the changes required to restore the saved class table of scope.  An
+// empty table means the suffix had no table and used the sender's classes.
+func planClassesUndo(ctx context.Context, filterctl *APIClient, scope ClassScope, saved []classes.SpamClass) ([]ClassChange, error) {
+	before, _, err := scopeClasses(ctx, filterctl, scope)
+	if err != nil {
+		return nil, err
+	}
+	after := saved
+	if len(after) == 0 && scope.Suffix != "" {
+		after, err = currentClasses(ctx, filterctl, scope.Sender)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return diffClasses(before, normalizeClasses(after)), nil
+}
+
+// return the changes required to restore the alias class tables saved in
+// the snapshot, keyed by suffix
+func planAliasesUndo(ctx context.Context, filterctl *APIClient, sender string, snapshot *Snapshot) (map[string][]ClassChange, error) {
+	var aliases map[string][]ClassChange
+	for _, scope := range snapshotAliasScopes(sender, snapshot) {
+		changes, err := planClassesUndo(ctx, filterctl, scope, snapshot.Aliases[scope.Suffix])
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) > 0 {
+			if aliases == nil {
+				aliases = make(map[string][]ClassChange)
+			}
+			aliases[scope.Suffix] = changes
+		}
+	}
+	return aliases, nil
+}
+
+// return the scopes of the alias class tables saved in the snapshot, sorted
+// by suffix
+func snapshotAliasScopes(sender string, snapshot *Snapshot) []ClassScope {
+	scopes := []ClassScope{}
+	for suffix := range snapshot.Aliases {
+		scopes = append(scopes, ClassScope{Sender: sender, Suffix: suffix})
+	}
+	sort.Slice(scopes, func(i, j int) bool { return scopes[i].Suffix < scopes[j].Suffix })
+	return scopes
+}
+
+// restore the saved class table of scope.  A suffix which had no table is
+// reverted to the sender's classes even when the tables match.
+func restoreClasses(ctx context.Context, filterctl *APIClient, scope ClassScope, saved []classes.SpamClass, changed bool) error {
+	if scope.Suffix != "" && len(saved) == 0 {
+		suffixes, err := ReadAliases(scope.Sender)
+		if err != nil || !slices.Contains(suffixes, scope.Suffix) {
+			return err
+		}
+		_, err = deleteScopeClasses(ctx, filterctl, scope)
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	_, err := resetScopeClasses(ctx, filterctl, scope, saved)
+	return err
+}
+
+// return the changes required to convert address books before into after
+func diffBooks(before, after map[string][]string) []BookChange {
+	names := []string{}
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	changes := []BookChange{}
+	for _, name := range names {
+		oldAddrs, inBefore := before[name]
+		newAddrs, inAfter := after[name]
+		switch {
+		case !inAfter:
+			changes = append(changes, BookChange{Book: name, Action: "delete", Removed: oldAddrs})
+		case !inBefore:
+			changes = append(changes, BookChange{Book: name, Action: "create", Added: newAddrs})
+		default:
+			added, removed := diffAddresses(oldAddrs, newAddrs)
+			if len(added) > 0 || len(removed) > 0 {
+				changes = append(changes, BookChange{Book: name, Action: "modify", Added: added, Removed: removed})
+			}
+		}
+	}
+	return changes
+}
+
+func (undoCommand) SnapshotScope(rc *RequestContext) (string, error) {
+	snapshot, _, err := undoSnapshot(rc)
+	if err != nil {
+		return "", err
+	}
+	return snapshot.Scope, nil
+}
+
+func (undoCommand) ClassScope(rc *RequestContext) (ClassScope, error) {
+	snapshot, _, err := undoSnapshot(rc)
+	if err != nil {
+		return ClassScope{}, err
+	}
+	return ClassScope{Sender: rc.Sender, Suffix: snapshot.Alias}, nil
+}
+
+func (undoCommand) AliasScopes(rc *RequestContext) ([]ClassScope, error) {
+	snapshot, _, err := undoSnapshot(rc)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotAliasScopes(rc.Sender, snapshot), nil
+}
+
+func (undoCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, index, err := undoSnapshot(rc)
+	if err != nil {
+		return nil, err
+	}
+	classChanges, bookChanges, err := planUndo(ctx, filterctl, rc.Sender, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	aliasChanges, err := planAliasesUndo(ctx, filterctl, rc.Sender, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Scope == CLASSES_SCOPE {
+		scope := ClassScope{Sender: rc.Sender, Suffix: snapshot.Alias}
+		err := restoreClasses(ctx, filterctl, scope, snapshot.Classes, len(classChanges) > 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, change := range bookChanges {
+		err := applyBookChange(ctx, filterctl, rc.Sender, change)
+		if err != nil {
+			return nil, err
+		}
+	}
+	count := len(classChanges) + len(bookChanges)
+	for _, scope := range snapshotAliasScopes(rc.Sender, snapshot) {
+		changes := aliasChanges[scope.Suffix]
+		err := restoreClasses(ctx, filterctl, scope, snapshot.Aliases[scope.Suffix], len(changes) > 0)
+		if err != nil {
+			return nil, err
+		}
+		count += len(changes)
+	}
+	var response APIUndoResponse
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s undo %s: %d changes", rc.Sender, snapshot.Command, count)
+	response.Undone = snapshot.Entry(index)
+	response.Classes = classChanges
+	response.Books = bookChanges
+	response.Aliases = aliasChanges
+	return &response, nil
+}
+
+func (undoCommand) DryRun(ctx context.Context, rc *RequestContext) (any, error) {
+	filterctl, err := NewFilterctlClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, _, err := undoSnapshot(rc)
+	if err != nil {
+		return nil, err
+	}
+	classChanges, bookChanges, err := planUndo(ctx, filterctl, rc.Sender, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	aliasChanges, err := planAliasesUndo(ctx, filterctl, rc.Sender, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if len(aliasChanges) == 0 {
+		return newDryRunResponse(rc, classChanges, bookChanges), nil
+	}
+	response := APIRestoreDryRunResponse{APIDryRunResponse: *newDryRunResponse(rc, classChanges, bookChanges), Aliases: aliasChanges}
+	count := len(classChanges) + len(bookChanges)
+	for _, changes := range aliasChanges {
+		count += len(changes)
+	}
+	response.Message = fmt.Sprintf("%s %s dry run: %d changes", rc.Sender, rc.Command, count)
+	return &response, nil
+}
+
+func applyBookChange(ctx context.Context, filterctl *APIClient, sender string, change BookChange) error {
+	if change.Action == "delete" {
+		_, err := filterctl.DeleteBook(ctx, sender, change.Book)
+		return err
+	}
+	if change.Action == "create" {
+		_, err := AddAddressBook(ctx, filterctl, sender, change.Book, change.Book)
+		if err != nil {
+			return err
+		}
+	}
+	for _, address := range change.Added {
+		_, err := AddAddress(ctx, filterctl, sender, change.Book, address)
+		if err != nil {
+			return err
+		}
+	}
+	for _, address := range change.Removed {
+		_, err := filterctl.DeleteAddress(ctx, sender, change.Book, address)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+	RegisterCommand(undoCmd, undoCommand{})
+}
@@ -22,12 +22,11 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // usageCmd represents the usage command
@@ -39,35 +38,58 @@ Output a description for each of the commands that may be used on the
 Subject line of an email to filterctl@emaildomain.ext.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		rule := "------------------------------------------------------------------------------\n"
-
-		commands := []struct {
-			Name   string
-			Args   string
-			Detail string
-		}{
-			{"classes", "", classesCmd.Long},
-			{"set", "CLASS=THRESHOLD", setCmd.Long},
-			{"delete", "[CLASS ...]", deleteCmd.Long},
-			{"reset", "[CLASS=THRESHOLD ...]", resetCmd.Long},
-			{"classify", "SCORE", classifyCmd.Long},
-			{"books", "", booksCmd.Long},
-			{"addrs", "BOOK_NAME", addrsCmd.Long},
-			{"mkbook", "BOOK_NAME [DESCRIPTION]", mkbookCmd.Long},
-			{"rmbook", "BOOK_NAME", rmbookCmd.Long},
-			{"mkaddr", "BOOK_NAME EMAIL_ADDRESS", mkaddrCmd.Long},
-			{"rmaddr", "BOOK_NAME EMAIL_ADDRESS", rmaddrCmd.Long},
-			{"scan", "EMAIL_ADDRESS", scanCmd.Long},
-			{"passwd", "", passwdCmd.Long},
-			{"dump", "", dumpCmd.Long},
-			{"restore", "", restoreCmd.Long},
-			{"rescan", "", rescanCmd.Long},
-			{"rescanstatus", "", rescanStatusCmd.Long},
-			{"version", "", versionCmd.Long},
-			{"usage", "", "\nOutput this message\n"},
-		}
+		RunCommand(cmd, args, nil)
+	},
+}
 
-		help := `### Mail Filter Control ####
+type usageCommand struct{}
+
+func (usageCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
+	rule := "------------------------------------------------------------------------------\n"
+
+	commands := []struct {
+		Name   string
+		Args   string
+		Detail string
+	}{
+		{"classes", "[+SUFFIX]", classesCmd.Long},
+		{"set", "[+SUFFIX] CLASS=THRESHOLD [CLASS=THRESHOLD ...]", setCmd.Long},
+		{"rename", "OLD_CLASS NEW_CLASS", renameCmd.Long},
+		{"delete", "[CLASS ...]", deleteCmd.Long},
+		{"reset", "[+SUFFIX] [CLASS=THRESHOLD ... | PRESET]", resetCmd.Long},
+		{"presets", "", presetsCmd.Long},
+		{"savepreset", "NAME", savepresetCmd.Long},
+		{"rmpreset", "NAME", rmpresetCmd.Long},
+		{"diffclasses", "[PRESET|default]", diffclassesCmd.Long},
+		{"exportclasses", "[+SUFFIX] [yaml|csv|json]", exportclassesCmd.Long},
+		{"importclasses", "[+SUFFIX] [replace|merge]", importclassesCmd.Long},
+		{"simulate", "", simulateCmd.Long},
+		{"recommend", "", recommendCmd.Long},
+		{"classify", "SCORE|LOW..HIGH[/STEP] ...", classifyCmd.Long},
+		{"books", "", booksCmd.Long},
+		{"addrs", "BOOK_NAME", addrsCmd.Long},
+		{"mkbook", "BOOK_NAME [DESCRIPTION]", mkbookCmd.Long},
+		{"rmbook", "BOOK_NAME", rmbookCmd.Long},
+		{"mkaddr", "BOOK_NAME EMAIL_ADDRESS", mkaddrCmd.Long},
+		{"importaddrs", "BOOK_NAME", importaddrsCmd.Long},
+		{"rmaddr", "BOOK_NAME EMAIL_ADDRESS", rmaddrCmd.Long},
+		{"scan", "EMAIL_ADDRESS", scanCmd.Long},
+		{"passwd", "", passwdCmd.Long},
+		{"dump", "", dumpCmd.Long},
+		{"restore", "", restoreCmd.Long},
+		{"rescan", "", rescanCmd.Long},
+		{"rescanstatus", "", rescanStatusCmd.Long},
+		{"history", "", historyCmd.Long},
+		{"undo", "[N]", undoCmd.Long},
+		{"at", "WHEN COMMAND [ARG ...]", atCmd.Long},
+		{"every", "SCHEDULE COMMAND [ARG ...]", everyCmd.Long},
+		{"jobs", "", jobsCmd.Long},
+		{"canceljob", "ID", canceljobCmd.Long},
+		{"version", "", versionCmd.Long},
+		{"usage", "", "\nOutput this message\n"},
+	}
+
+	help := `### Mail Filter Control ####
 # General Overview #
 The mail-filter-control-extension provides user control for the mail filter
 features implemented on your mail system.  Read the following sections for
@@ -85,6 +107,17 @@ Each class is associated with a maximum score value.  The highest class is
 'spam' with a fixed maximum.  A default set of classes is used if the user
 has not set any custom classes.
 
+# Class Presets #
+The mail system operator may define named class tables, such as 'strict' or
+'lenient', which are applied with the 'reset' command.  For example,
+'reset lenient' replaces the sender's classes with the 'lenient' table.  The
+'presets' command lists the available presets, and 'savepreset NAME' saves
+the current classes as a personal preset for later use.  The 'diffclasses'
+command compares the current classes with the defaults or a preset.
+The 'exportclasses' command returns the classes as an attached YAML, CSV or
+JSON file, which may be edited and sent back as an attachment with the
+'importclasses' command.
+
 # Address Book Filter #
 The system maintains address books which may be used to classify mail by
 sender address bypassing analysis of message content.  These address books are
@@ -99,6 +132,11 @@ associated with a recipient email address.  The header's value is set to the
 name of the address book containing the sender address.  Multiple headers may
 be present if a sender address is listed in multiple filter address books.
 
+# Importing Contacts #
+The 'importaddrs BOOK_NAME' command adds the email addresses from a vCard
+(.vcf) or CSV contacts file, sent as an attachment, to an address book.
+Addresses already in the book are skipped.
+
 # Plus Extension Aliasing #
 This mailserver supports the 'plus-extension' mechanism.  Incoming mail for
 any valid username with a '+suffix' will be accepted as addressed to the
@@ -107,6 +145,14 @@ part of the username preceeding the '+' character.  For example, mail sent to
 'user@[account_domain]'.  Plus-extension aliasing requires no configuration
 and is useful in coordination with client filtering rules.
 
+# Plus Extension Classes #
+Each plus-extension address may have its own spam classes.  A '+suffix'
+argument placed after the 'classes', 'set' or 'reset' command name selects
+the classes for 'username+suffix@[account_domain]'.  For example,
+'set +lists bulk=3' changes the classes for mail sent to the '+lists'
+address, and 'reset +lists' returns it to the user's classes.  An address
+without classes of its own uses the user's classes.
+
 # Filter Control Address Implementation Details #
 The email address 'filterctl@[account_domain]' accepts messages only from
 internal users connecting on a TLS-secured authorized connection.  Messages
@@ -126,38 +172,52 @@ by the mailserver a response message is sent from 'filterctl@[account_domain]'
 with the subject 'filterctl response'.  The body of this response message
 contains the command output.  By default, the system automatically deletes
 these control messages from the Inbox and Sent folders.
+
+# Dry Run #
+Commands that change the filter configuration (set, rename, delete, reset,
+importclasses, mkbook, rmbook, mkaddr, importaddrs, rmaddr, restore, rescan,
+undo, savepreset, rmpreset, at, every, canceljob) accept a '--dry-run' option
+placed after the command name.  For example: 'reset --dry-run ham=2 spam=999'.
+The response lists the changes the command would make, and nothing is
+modified.  Other commands do not accept '--dry-run'.
+
+# Undo #
+Before each command that changes classes or address books, the previous
+settings are saved.  The 'history' command lists the saved changes, and
+'undo N' restores the settings saved before the Nth most recent change.
+
+# Scheduled Commands #
+The 'at' and 'every' commands schedule another command to run later, once or
+repeatedly.  For example, 'at 7d rmaddr friends someone@example.com' removes
+an address after one week, and 'every friday@18:00 reset' restores the
+default classes each weekend.  The response to a scheduled command is sent
+when it runs.  The 'jobs' command lists scheduled commands, and 'canceljob ID'
+removes one.
 `
 
-		usage := "# filterctl subject line commands #\n"
-		usage += rule
-		for _, cmd := range commands {
-			name := cmd.Name
-			if cmd.Args != "" {
-				name += " " + cmd.Args
-			}
-			usage += fmt.Sprintf("%s\n%s\n", name, cmd.Detail)
-			usage += rule
+	usage := "# filterctl subject line commands #\n"
+	usage += rule
+	for _, cmd := range commands {
+		name := cmd.Name
+		if cmd.Args != "" {
+			name += " " + cmd.Args
 		}
+		usage += fmt.Sprintf("%s\n%s\n", name, cmd.Detail)
+		usage += rule
+	}
 
-		sender := viper.GetString("sender")
-		messageID, err := DecodedMessageID(viper.GetString("message_id"))
-		cobra.CheckErr(err)
-
-		var response APIUsageResponse
-
-		response.User = sender
-		response.Request = messageID
-		response.Success = true
-		response.Message = fmt.Sprintf("%s usage", sender)
-		response.Help = strings.Split(help, "\n")
-		response.Commands = strings.Split(usage, "\n")
+	var response APIUsageResponse
 
-		out, err := json.MarshalIndent(&response, "", "  ")
-		cobra.CheckErr(err)
-		fmt.Println(string(out))
-	},
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s usage", rc.Sender)
+	response.Help = strings.Split(help, "\n")
+	response.Commands = strings.Split(usage, "\n")
+	return &response, nil
 }
 
 func init() {
 	rootCmd.AddCommand(usageCmd)
+	RegisterCommand(usageCmd, usageCommand{})
 }
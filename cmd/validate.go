@@ -0,0 +1,93 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/rstms/rspamd-classes/classes"
+)
+
+// format a threshold as it would be typed in a class specifier
+func formatThreshold(score float32) string {
+	return strconv.FormatFloat(float64(score), 'f', -1, 32)
+}
+
+// validateClasses checks a complete class table, in the order given,
+// against the rules applied by the rspamd-classes library.  The library
+// silently drops or reorders classes which break these rules, so they are
+// reported to the sender instead.
+func validateClasses(table []classes.SpamClass) error {
+	violations := []string{}
+	names := make(map[string]bool)
+	scores := make(map[float32]string)
+	hasSpam := false
+	for i, class := range table {
+		threshold := formatThreshold(class.Score)
+		if names[class.Name] {
+			violations = append(violations, fmt.Sprintf("class '%s' is listed more than once", class.Name))
+			continue
+		}
+		names[class.Name] = true
+		if class.Name == classes.MAX_NAME {
+			hasSpam = true
+			if class.Score != classes.MAX_THRESHOLD {
+				violations = append(violations, fmt.Sprintf("the '%s' class threshold is fixed at %s; got %s", classes.MAX_NAME, formatThreshold(classes.MAX_THRESHOLD), threshold))
+			}
+		} else if class.Score >= classes.MAX_THRESHOLD {
+			violations = append(violations, fmt.Sprintf("class '%s' threshold %s must be less than the '%s' maximum %s", class.Name, threshold, classes.MAX_NAME, formatThreshold(classes.MAX_THRESHOLD)))
+		}
+		if other, ok := scores[class.Score]; ok {
+			violations = append(violations, fmt.Sprintf("classes '%s' and '%s' have the same threshold %s", other, class.Name, threshold))
+		} else {
+			scores[class.Score] = class.Name
+		}
+		if i > 0 && class.Score < table[i-1].Score {
+			previous := table[i-1]
+			violations = append(violations, fmt.Sprintf("class '%s' threshold %s must be greater than the threshold %s of the preceding class '%s'", class.Name, threshold, formatThreshold(previous.Score), previous.Name))
+		}
+	}
+	if !hasSpam {
+		violations = append(violations, fmt.Sprintf("the table must end with the '%s' class: %s=%s", classes.MAX_NAME, classes.MAX_NAME, formatThreshold(classes.MAX_THRESHOLD)))
+	}
+	return validationResult(violations)
+}
+
+// return table with the class's threshold replaced, or with the class
+// inserted before the first class with a higher threshold
+func mergeClass(table []classes.SpamClass, class classes.SpamClass) []classes.SpamClass {
+	merged := slices.Clone(table)
+	for i, existing := range merged {
+		if existing.Name == class.Name {
+			merged[i] = class
+			return merged
+		}
+	}
+	for i, existing := range merged {
+		if existing.Score > class.Score {
+			return slices.Insert(merged, i, class)
+		}
+	}
+	return append(merged, class)
+}
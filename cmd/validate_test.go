@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateClasses(t *testing.T) {
+	cases := []struct {
+		Args       []string
+		Violations []string
+	}{
+		{[]string{"ham=5", "probable=10", "spam=999"}, nil},
+		{[]string{"ham=-1.5", "spam=999"}, nil},
+		{[]string{"ham=5", "probable=10"}, []string{
+			"the table must end with the 'spam' class: spam=999",
+		}},
+		{[]string{"ham=5", "probable=3", "suspicious=3", "spam=10"}, []string{
+			"class 'probable' threshold 3 must be greater than the threshold 5 of the preceding class 'ham'",
+			"classes 'probable' and 'suspicious' have the same threshold 3",
+			"the 'spam' class threshold is fixed at 999; got 10",
+		}},
+		{[]string{"ham=5", "ham=6", "junk=1000", "spam=999"}, []string{
+			"class 'ham' is listed more than once",
+			"class 'junk' threshold 1000 must be less than the 'spam' maximum 999",
+			"class 'spam' threshold 999 must be greater than the threshold 1000 of the preceding class 'junk'",
+		}},
+		{[]string{"ham", "1ham=5", "spam=999"}, []string{
+			"failed to parse class specifier 'ham'",
+			"failed to parse class specifier '1ham=5'",
+		}},
+	}
+	for _, c := range cases {
+		_, err := parseClassSpecs(c.Args)
+		if c.Violations == nil {
+			require.Nil(t, err, c.Args)
+			continue
+		}
+		var invalid *ValidationError
+		require.True(t, errors.As(err, &invalid), c.Args)
+		require.Equal(t, c.Violations, invalid.Violations, c.Args)
+	}
+}
+
+func TestMergeClass(t *testing.T) {
+	table := classes.DefaultClasses
+	require.Equal(t, []classes.SpamClass{{Name: "ham", Score: 2}, {Name: "probable", Score: 10}, {Name: "spam", Score: 999}}, mergeClass(table, classes.SpamClass{Name: "ham", Score: 2}))
+	require.Equal(t, []classes.SpamClass{{Name: "ham", Score: 12}, {Name: "probable", Score: 10}, {Name: "spam", Score: 999}}, mergeClass(table, classes.SpamClass{Name: "ham", Score: 12}))
+	require.Equal(t, []classes.SpamClass{{Name: "ham", Score: 5}, {Name: "maybe", Score: 7}, {Name: "probable", Score: 10}, {Name: "spam", Score: 999}}, mergeClass(table, classes.SpamClass{Name: "maybe", Score: 7}))
+	require.Equal(t, classes.DefaultClasses, table)
+}
+
+func TestSetValidation(t *testing.T) {
+	configure(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	server.Filterctld.AddUser(sender, "test-password")
+
+	rc := RequestContext{Sender: sender, Command: "set", Args: []string{"ham=12"}}
+	_, err := setCommand{}.Run(context.Background(), &rc)
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid), err)
+	require.Equal(t, []string{"class 'probable' threshold 10 must be greater than the threshold 12 of the preceding class 'ham'"}, invalid.Violations)
+	require.Equal(t, classes.DefaultClasses, server.Filterctld.Classes(sender))
+
+	response, status, err := invalidRequestResponse(sender, "validation test", "set", invalid)
+	require.Nil(t, err)
+	require.Equal(t, "invalid", status)
+	require.Contains(t, string(response), "set failed: 1 problem found; nothing was changed")
+
+	rc = RequestContext{Sender: sender, Command: "set", Args: []string{"ham=7"}}
+	_, err = setCommand{}.Run(context.Background(), &rc)
+	require.Nil(t, err)
+	require.Equal(t, []classes.SpamClass{{Name: "ham", Score: 7}, {Name: "probable", Score: 10}, {Name: "spam", Score: 999}}, server.Filterctld.Classes(sender))
+}
+
+func TestSetMultiple(t *testing.T) {
+	configure(t)
+	server := startFakeServer(t)
+	sender := "test@mailcapsule.io"
+	server.Filterctld.AddUser(sender, "test-password")
+	ctx := context.Background()
+
+	// each assignment alone would break the ordering rule, but together
+	// they form a valid table
+	rc := RequestContext{Sender: sender, Command: "set", Args: []string{"ham=12", "probable=20", "low=1"}}
+	_, err := setCommand{}.Run(ctx, &rc)
+	require.Nil(t, err)
+	require.Equal(t, []classes.SpamClass{{Name: "low", Score: 1}, {Name: "ham", Score: 12}, {Name: "probable", Score: 20}, {Name: "spam", Score: 999}}, server.Filterctld.Classes(sender))
+
+	rc = RequestContext{Sender: sender, Command: "set", Args: []string{"ham=2", "ham=3", "bad"}}
+	_, err = setCommand{}.Run(ctx, &rc)
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid), err)
+	require.Equal(t, []string{"class 'ham' is listed more than once", "failed to parse class specifier 'bad'"}, invalid.Violations)
+}
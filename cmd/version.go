@@ -22,14 +22,13 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/rstms/mabctl/api"
 	"github.com/rstms/rspamd-classes/classes"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // versionCmd represents the version command
@@ -40,30 +39,32 @@ var versionCmd = &cobra.Command{
 Outputs program name, version, rspamd_classes library version, uid, and gid.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
+		RunCommand(cmd, args, nil)
+	},
+}
 
-		var response APIVersionResponse
-		var err error
+type versionCommand struct{}
 
-		response.User = viper.GetString("sender")
-		response.Request, err = DecodedMessageID(viper.GetString("message_id"))
-		cobra.CheckErr(err)
-		response.Success = true
-		response.Message = fmt.Sprintf("%s version", viper.GetString("sender"))
-		response.Name = os.Args[0]
-		response.Version = Version
-		response.Classes = classes.Version
-		response.Mabctl = api.Version
-		response.UID = os.Getuid()
-		response.GID = os.Getgid()
+func (versionCommand) Run(ctx context.Context, rc *RequestContext) (any, error) {
 
-		out, err := json.MarshalIndent(&response, "", "  ")
-		cobra.CheckErr(err)
-		fmt.Println(string(out))
-	},
+	var response APIVersionResponse
+
+	response.User = rc.Sender
+	response.Request = rc.RequestID
+	response.Success = true
+	response.Message = fmt.Sprintf("%s version", rc.Sender)
+	response.Name = os.Args[0]
+	response.Version = Version
+	response.Classes = classes.Version
+	response.Mabctl = api.Version
+	response.UID = os.Getuid()
+	response.GID = os.Getgid()
+	return &response, nil
 }
 
 func init() {
 	rootCmd.AddCommand(versionCmd)
+	RegisterCommand(versionCmd, versionCommand{})
 
 	// Here you will define your flags and configuration settings.
 
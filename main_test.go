@@ -2,39 +2,213 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
+	"flag"
 	"fmt"
+	"github.com/rstms/filterctl/cmd"
+	"github.com/rstms/filterctl/pkg/fakeserver"
+	"github.com/rstms/mabctl/api"
 	"github.com/stretchr/testify/require"
+	"io"
 	"log"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"testing"
 )
 
+var update = flag.Bool("update", false, "update golden files")
+
+var goldenPatterns = []struct {
+	Pattern *regexp.Regexp
+	Replace string
+}{
+	{regexp.MustCompile(`(?m)^Date: .*$`), "Date: <DATE>"},
+	{regexp.MustCompile(`"Name": ".*",(\s*)"Version": ".*"`), `"Name": "<PROGRAM>",${1}"Version": "<VERSION>"`},
+	{regexp.MustCompile(`"UID": [0-9]+`), `"UID": "<UID>"`},
+	{regexp.MustCompile(`"GID": [0-9]+`), `"GID": "<GID>"`},
+}
+
+type messageCase struct {
+	Name       string
+	Args       []string
+	APIKey     string
+	ExitCode   int
+	Status     string
+	HTTPStatus int
+	Reason     string
+}
+
+// build the program for the message tests
+func buildProgram(t *testing.T) string {
+	program := filepath.Join(t.TempDir(), "filterctl")
+	build := exec.Command("go", "build", "-o", program, ".")
+	output, err := build.CombinedOutput()
+	require.Nil(t, err, string(output))
+	return program
+}
+
+// start fake servers and write a config file directing the program to them.
+// The filterctld server requires the case's APIKey, if any, which the
+// program does not send.
+func setupMessageCase(t *testing.T, c messageCase) (string, string) {
+	dir := t.TempDir()
+	server, err := fakeserver.Start(dir)
+	require.Nil(t, err)
+	t.Cleanup(server.Close)
+	server.Filterctld.APIKey = c.APIKey
+	server.Filterctld.Seed("test@mailcapsule.io", api.UserDump{
+		Password: "test-password",
+		Books:    map[string][]string{"testbook": {"me@here.com"}},
+	})
+	server.Filterctld.AddUser("mkrueger@mailcapsule.io", "mkrueger-password")
+
+	config, err := os.ReadFile("testdata/config.yaml")
+	require.Nil(t, err)
+	config = fmt.Appendf(config, "server_url: %s\n", server.FilterctldURL())
+	config = fmt.Appendf(config, "rescand_url: %s\n", server.RescandURL())
+	config = fmt.Appendf(config, "cert: %s\nkey: %s\nca: %s\n", server.Certs.ClientCert, server.Certs.ClientKey, server.Certs.CA)
+	config = fmt.Appendf(config, "history_dir: %s\njobs_dir: %s\n", filepath.Join(dir, "history"), filepath.Join(dir, "jobs"))
+	config = fmt.Appendf(config, "presets_dir: %s\n", filepath.Join(dir, "presets"))
+	config = fmt.Appendf(config, "aliases_dir: %s\n", filepath.Join(dir, "aliases"))
+	config = fmt.Appendf(config, "breaker:\n  dir: %s\n", filepath.Join(dir, "breaker"))
+	configFile := filepath.Join(dir, "config.yaml")
+	err = os.WriteFile(configFile, config, 0600)
+	require.Nil(t, err)
+	return configFile, filepath.Join(dir, "audit")
+}
+
+// return the response message with the body decoded and volatile values
+// replaced
+func normalizeResponse(t *testing.T, message []byte) []byte {
+	header, body, found := bytes.Cut(message, []byte("\r\n\r\n"))
+	if found {
+		var decoded []byte
+		boundary := multipartBoundary.FindSubmatch(header)
+		if boundary != nil {
+			decoded = decodeParts(t, body, string(boundary[1]))
+		} else {
+			var err error
+			decoded, err = io.ReadAll(quotedprintable.NewReader(bytes.NewReader(body)))
+			require.Nil(t, err)
+		}
+		message = append(bytes.ReplaceAll(header, []byte("\r\n"), []byte("\n")), "\n\n"...)
+		message = append(message, decoded...)
+	}
+	for _, p := range goldenPatterns {
+		message = p.Pattern.ReplaceAll(message, []byte(p.Replace))
+	}
+	return message
+}
+
+var multipartBoundary = regexp.MustCompile(`Content-Type: multipart/mixed; boundary="([^"]+)"`)
+
+// return the headers and decoded content of each part of a multipart body
+func decodeParts(t *testing.T, body []byte, boundary string) []byte {
+	var decoded bytes.Buffer
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		var content io.Reader = part
+		if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+			content = base64.NewDecoder(base64.StdEncoding, part)
+		}
+		data, err := io.ReadAll(content)
+		require.Nil(t, err)
+		decoded.WriteString("--\n")
+		keys := []string{}
+		for key := range part.Header {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&decoded, "%s: %s\n", key, part.Header.Get(key))
+		}
+		decoded.WriteString("\n")
+		decoded.Write(data)
+	}
+	return decoded.Bytes()
+}
+
+func checkGolden(t *testing.T, name string, output []byte) {
+	filename := filepath.Join("testdata", name+".golden")
+	if *update {
+		err := os.WriteFile(filename, output, 0660)
+		require.Nil(t, err)
+	}
+	expected, err := os.ReadFile(filename)
+	require.Nil(t, err, "missing golden file; run 'go test -run TestMessages . -update'")
+	require.Equal(t, string(expected), string(output))
+}
+
 func TestMessages(t *testing.T) {
 
-	var cases = []struct {
-		Name          string
-		ExpectSuccess bool
-	}{
-		{"help", true},
-		{"restore", true},
-		{"reset", true},
-		{"classes", true},
-		{"delete-ham", true},
-		{"delete-all", true},
-		{"set", true},
-		{"version", true},
-		{"fnord", true},
-		{"empty", true},
-		{"nobody", true},
-		{"nosubject", true},
-		{"suffix", true},
-		{"forwarded", true},
-		{"forwarded2", true},
-		{"dump", true},
-		{"accounts", true},
+	var cases = []messageCase{
+		{Name: "help", Status: "success"},
+		{Name: "restore", Status: "success"},
+		{Name: "reset", Status: "success"},
+		{Name: "classes", Status: "success"},
+		{Name: "delete-ham", Status: "success"},
+		{Name: "delete-all", Status: "success"},
+		{Name: "set", Status: "success"},
+		{Name: "reset-invalid", Status: "invalid"},
+		{Name: "set-invalid", Status: "invalid"},
+		{Name: "set-multiple", Status: "success"},
+		{Name: "set-alias", Status: "success"},
+		{Name: "classes-alias", Status: "success"},
+		{Name: "rename", Status: "success"},
+		{Name: "presets", Status: "success"},
+		{Name: "reset-preset", Status: "success"},
+		{Name: "diffclasses", Status: "success"},
+		{Name: "exportclasses", Status: "success"},
+		{Name: "importclasses", Status: "success"},
+		{Name: "classify", Status: "success"},
+		{Name: "classify-isolated", Args: []string{"--isolate-commands"}, Status: "success"},
+		{Name: "simulate", Status: "success"},
+		{Name: "simulate-isolated", Args: []string{"--isolate-commands"}, Status: "success"},
+		{Name: "recommend", Status: "success"},
+		{Name: "recommend-isolated", Args: []string{"--isolate-commands"}, Status: "success"},
+		{Name: "version", Status: "success"},
+		{Name: "fnord", Status: "unknown"},
+		{Name: "empty", Status: "success"},
+		{Name: "nobody", Status: "success"},
+		{Name: "nosubject", Status: "success"},
+		{Name: "suffix", Status: "success"},
+		{Name: "forwarded", Status: "success"},
+		{Name: "forwarded2", Status: "success"},
+		{Name: "dump", Status: "success"},
+		{Name: "importaddrs", Status: "success"},
+		{Name: "accounts", Status: "success"},
+		{Name: "unauthorized", APIKey: "test-api-key", Status: "unauthorized", HTTPStatus: 401},
+		{Name: "not-found", Status: "not_found", HTTPStatus: 404},
+		{Name: "reject-message-id", ExitCode: 1, Status: "rejected", Reason: "missing Message-ID header"},
+		{Name: "reject-from-missing", ExitCode: 1, Status: "rejected", Reason: "missing From: address header"},
+		{Name: "reject-from-multiple", ExitCode: 1, Status: "rejected", Reason: "From: multiple addresses not allowed"},
+		{Name: "reject-from-domain", ExitCode: 1, Status: "rejected", Reason: "From: invalid domain: example.com"},
+		{Name: "reject-from-user", Args: []string{"--insecure-disable-username-check=false"}, ExitCode: 1, Status: "rejected", Reason: "From: invalid user: nosuchuser"},
+		{Name: "reject-dkim-missing", ExitCode: 1, Status: "rejected", Reason: "missing DKIM signature"},
+		{Name: "reject-dkim-multiple", ExitCode: 1, Status: "rejected", Reason: "multiple DKIM signatures detected"},
+		{Name: "reject-dkim-domain", ExitCode: 1, Status: "rejected", Reason: "domain not found in DKIM Signature"},
+		{Name: "reject-to-missing", ExitCode: 1, Status: "rejected", Reason: "missing To: address header"},
+		{Name: "reject-to-multiple", ExitCode: 1, Status: "rejected", Reason: "To: multiple addresses not allowed"},
+		{Name: "reject-received-missing", ExitCode: 1, Status: "rejected", Reason: "missing Received header"},
+		{Name: "reject-received-multiple", ExitCode: 1, Status: "rejected", Reason: "multiple Received headers detected"},
+		{Name: "reject-received-format", ExitCode: 1, Status: "rejected", Reason: "Received: parse failed: from localhost by testhost.mailcapsule.io"},
+		{Name: "reject-received-hostname", ExitCode: 1, Status: "rejected", Reason: "Received: hostname mismatch; expected testhost.mailcapsule.io, got otherhost.mailcapsule.io"},
+		{Name: "reject-received-user", ExitCode: 1, Status: "rejected", Reason: "Received: user mismatch; expected test, got other"},
+		{Name: "reject-received-suffix", ExitCode: 1, Status: "rejected", Reason: "Received: suffix mismatch; expected friends, got "},
+		{Name: "reject-received-domain", ExitCode: 1, Status: "rejected", Reason: "Received: invalid domain: example.com"},
 	}
 	log.SetOutput(os.Stderr)
+	program := buildProgram(t)
 
 	selectedTest, selectionPresent := os.LookupEnv("TEST_MESSAGE")
 	for _, c := range cases {
@@ -45,39 +219,38 @@ func TestMessages(t *testing.T) {
 		}
 
 		t.Run(c.Name, func(t *testing.T) {
-			log.Printf("BEGIN_TEST: %s\n", c.Name)
+			configFile, auditFile := setupMessageCase(t, c)
 			input, err := os.ReadFile("testdata/" + c.Name)
 			require.Nil(t, err)
-			ibuf := bytes.NewBuffer(input)
 			obuf := bytes.Buffer{}
 			ebuf := bytes.Buffer{}
-			cmd := exec.Command("./filterctl", "--config", "testdata/config.yaml")
-			cmd.Stdin = ibuf
+			args := append([]string{"--config", configFile, "--audit-file", auditFile}, c.Args...)
+			cmd := exec.Command(program, args...)
+			cmd.Stdin = bytes.NewBuffer(input)
 			cmd.Stdout = &obuf
 			cmd.Stderr = &ebuf
-			fmt.Printf("Run %s %+v\n", c.Name, cmd)
 			runErr := cmd.Run()
-			var exitCode int
+			exitCode := cmd.ProcessState.ExitCode()
 			if runErr != nil {
-				switch e := runErr.(type) {
-				case *exec.ExitError:
-					exitCode = e.ExitCode()
-				default:
-					require.Nil(t, runErr)
-				}
-			} else {
-				exitCode = cmd.ProcessState.ExitCode()
+				_, ok := runErr.(*exec.ExitError)
+				require.True(t, ok, runErr)
 			}
-			fmt.Printf("Run %s returned: exitCode=%v err=%+v\n", c.Name, exitCode, runErr)
-			err = os.WriteFile("testdata/"+c.Name+".out", obuf.Bytes(), 0660)
-			require.Nil(t, err)
-			err = os.WriteFile("testdata/"+c.Name+".err", ebuf.Bytes(), 0660)
-			require.Nil(t, err)
-			if c.ExpectSuccess {
-				require.Zero(t, exitCode)
-			} else {
-				require.NotZero(t, exitCode)
+			if t.Failed() || exitCode != c.ExitCode {
+				t.Logf("stderr:\n%s", ebuf.String())
 			}
+			require.Equal(t, c.ExitCode, exitCode)
+			checkGolden(t, c.Name, normalizeResponse(t, obuf.Bytes()))
+			checkAudit(t, auditFile, c)
 		})
 	}
 }
+
+func checkAudit(t *testing.T, filename string, c messageCase) {
+	records, err := cmd.ReadAudit(filename, nil)
+	require.Nil(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, c.Status, records[0].Status)
+	require.Equal(t, c.HTTPStatus, records[0].HTTPStatus)
+	require.Equal(t, c.Reason, records[0].Reason)
+	require.Equal(t, c.Status != "rejected", records[0].Authorized)
+}
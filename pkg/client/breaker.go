@@ -0,0 +1,132 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Breaker is a circuit breaker whose state is kept in a file, so that
+// short-lived processes fail fast while a server is known to be down.
+// After Threshold consecutive failures, requests are refused until
+// Cooldown has passed; the next request then tests the server.
+type Breaker struct {
+	Filename  string
+	Threshold int
+	Cooldown  time.Duration
+}
+
+type breakerState struct {
+	Failures  int
+	OpenUntil time.Time
+}
+
+// Allow returns an error wrapping ErrUnavailable if the circuit is open
+func (b *Breaker) Allow() error {
+	var state breakerState
+	err := b.update(syscall.LOCK_SH, func(s *breakerState) bool {
+		state = *s
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(state.OpenUntil) {
+		return fmt.Errorf("%w: circuit open until %s after %d failures", ErrUnavailable, state.OpenUntil.Format(time.RFC3339), state.Failures)
+	}
+	return nil
+}
+
+// Success closes the circuit
+func (b *Breaker) Success() error {
+	return b.update(syscall.LOCK_EX, func(s *breakerState) bool {
+		if s.Failures == 0 && s.OpenUntil.IsZero() {
+			return false
+		}
+		*s = breakerState{}
+		return true
+	})
+}
+
+// Failure records a failed request, opening the circuit at the threshold
+func (b *Breaker) Failure() error {
+	return b.update(syscall.LOCK_EX, func(s *breakerState) bool {
+		s.Failures++
+		if s.Failures >= b.Threshold {
+			s.OpenUntil = time.Now().Add(b.Cooldown)
+		}
+		return true
+	})
+}
+
+// read the state file under lock, writing it back if modify returns true
+func (b *Breaker) update(lock int, modify func(*breakerState) bool) error {
+	flags := os.O_RDONLY
+	if lock == syscall.LOCK_EX {
+		flags = os.O_RDWR | os.O_CREATE
+	}
+	file, err := os.OpenFile(b.Filename, flags, 0600)
+	if errors.Is(err, os.ErrNotExist) {
+		modify(&breakerState{})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed opening breaker state: %v", err)
+	}
+	defer file.Close()
+	err = syscall.Flock(int(file.Fd()), lock)
+	if err != nil {
+		return fmt.Errorf("failed locking breaker state: %v", err)
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	var state breakerState
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		// a damaged state file is treated as a closed circuit
+		json.Unmarshal(data, &state)
+	}
+	if !modify(&state) {
+		return nil
+	}
+	data, err = json.Marshal(&state)
+	if err != nil {
+		return err
+	}
+	err = file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteAt(data, 0)
+	if err != nil {
+		return fmt.Errorf("failed writing breaker state: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+)
+
+// CertInfo describes one certificate
+type CertInfo struct {
+	Subject        string
+	Issuer         string
+	Serial         string
+	DNSNames       []string `json:",omitempty"`
+	EmailAddresses []string `json:",omitempty"`
+	IPAddresses    []string `json:",omitempty"`
+	NotBefore      time.Time
+	NotAfter       time.Time
+	IsCA           bool
+}
+
+// CertReport describes the client certificate, its key, and the CA used to
+// verify the servers.  Verified is true if the client certificate chains to
+// the CA.  Problems found are listed in Errors.
+type CertReport struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	Cert     *CertInfo `json:",omitempty"`
+	CA       []CertInfo
+	KeyMatch bool
+	Verified bool
+	Errors   []string `json:",omitempty"`
+}
+
+func newCertInfo(cert *x509.Certificate) CertInfo {
+	info := CertInfo{
+		Subject:        cert.Subject.String(),
+		Issuer:         cert.Issuer.String(),
+		Serial:         cert.SerialNumber.Text(16),
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		NotBefore:      cert.NotBefore,
+		NotAfter:       cert.NotAfter,
+		IsCA:           cert.IsCA,
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	return info
+}
+
+// return the certificates in a PEM file
+func readCertificates(filename string) ([]*x509.Certificate, []byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	certs := []*x509.Certificate{}
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, nil, fmt.Errorf("%s: no certificates found", filename)
+	}
+	return certs, data, nil
+}
+
+// CheckCertificates reports on the client certificate, key and CA files
+// named in config at time now
+func CheckCertificates(config *Config, now time.Time) *CertReport {
+	report := CertReport{
+		CertFile: config.Cert,
+		KeyFile:  config.Key,
+		CAFile:   config.CA,
+		CA:       []CertInfo{},
+	}
+	fail := func(format string, args ...any) {
+		report.Errors = append(report.Errors, fmt.Sprintf(format, args...))
+	}
+
+	certs, certPEM, err := readCertificates(config.Cert)
+	if err != nil {
+		fail("client certificate: %v", err)
+	} else {
+		info := newCertInfo(certs[0])
+		report.Cert = &info
+		if now.After(certs[0].NotAfter) {
+			fail("client certificate expired %s", certs[0].NotAfter.Format(time.RFC3339))
+		} else if now.Before(certs[0].NotBefore) {
+			fail("client certificate is not valid until %s", certs[0].NotBefore.Format(time.RFC3339))
+		}
+		keyPEM, err := os.ReadFile(config.Key)
+		if err != nil {
+			fail("client key: %v", err)
+		} else if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+			fail("client key: %v", err)
+		} else {
+			report.KeyMatch = true
+		}
+	}
+
+	caCerts, _, err := readCertificates(config.CA)
+	if err != nil {
+		fail("certificate authority: %v", err)
+	}
+	roots := x509.NewCertPool()
+	for _, cert := range caCerts {
+		report.CA = append(report.CA, newCertInfo(cert))
+		roots.AddCert(cert)
+		if now.After(cert.NotAfter) {
+			fail("certificate authority '%s' expired %s", cert.Subject, cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+
+	if len(certs) > 0 && len(caCerts) > 0 {
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			fail("client certificate verification failed: %v", err)
+		} else {
+			report.Verified = true
+		}
+	}
+	return &report
+}
+
+// Expiring returns a warning for each certificate in the report which
+// expires within the given duration after now
+func (r *CertReport) Expiring(now time.Time, within time.Duration) []string {
+	warnings := []string{}
+	check := func(label string, info CertInfo) {
+		if now.Before(info.NotAfter) && now.Add(within).After(info.NotAfter) {
+			days := int(info.NotAfter.Sub(now).Hours() / 24)
+			warnings = append(warnings, fmt.Sprintf("%s '%s' expires in %d days at %s", label, info.Subject, days, info.NotAfter.Format(time.RFC3339)))
+		}
+	}
+	if r.Cert != nil {
+		check("client certificate", *r.Cert)
+	}
+	for _, info := range r.CA {
+		check("certificate authority", info)
+	}
+	return warnings
+}
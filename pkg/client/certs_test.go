@@ -0,0 +1,116 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// create a certificate signed by parent, or self-signed if parent is nil
+func newTestCert(t *testing.T, name string, parent *testCert, notAfter time.Time) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	signer := &testCert{cert: &template, key: key}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.DNSNames = []string{name}
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		signer = parent
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, signer.cert, &key.PublicKey, signer.key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) writeCert(t *testing.T, filename string) string {
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+	require.Nil(t, os.WriteFile(filename, data, 0600))
+	return filename
+}
+
+func (c *testCert) writeKey(t *testing.T, filename string) string {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	require.Nil(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	require.Nil(t, os.WriteFile(filename, data, 0600))
+	return filename
+}
+
+func TestCheckCertificates(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	ca := newTestCert(t, "test CA", nil, now.AddDate(1, 0, 0))
+	cert := newTestCert(t, "filterctl.example.com", ca, now.AddDate(0, 0, 10))
+	config := Config{
+		Cert: cert.writeCert(t, filepath.Join(dir, "client.pem")),
+		Key:  cert.writeKey(t, filepath.Join(dir, "client.key")),
+		CA:   ca.writeCert(t, filepath.Join(dir, "ca.pem")),
+	}
+
+	report := CheckCertificates(&config, now)
+	require.Empty(t, report.Errors)
+	require.True(t, report.KeyMatch)
+	require.True(t, report.Verified)
+	require.Equal(t, "CN=filterctl.example.com", report.Cert.Subject)
+	require.Equal(t, "CN=test CA", report.Cert.Issuer)
+	require.Equal(t, []string{"filterctl.example.com"}, report.Cert.DNSNames)
+	require.Len(t, report.CA, 1)
+	require.True(t, report.CA[0].IsCA)
+	require.Empty(t, report.Expiring(now, 7*24*time.Hour))
+	warnings := report.Expiring(now, 30*24*time.Hour)
+	require.Len(t, warnings, 1)
+	require.Contains(t, warnings[0], "client certificate 'CN=filterctl.example.com' expires in 9 days")
+
+	// expired
+	report = CheckCertificates(&config, now.AddDate(0, 0, 11))
+	require.False(t, report.Verified)
+	require.Contains(t, report.Errors[0], "client certificate expired")
+
+	// key from another certificate
+	other := newTestCert(t, "other.example.com", ca, now.AddDate(1, 0, 0))
+	config.Key = other.writeKey(t, filepath.Join(dir, "other.key"))
+	report = CheckCertificates(&config, now)
+	require.False(t, report.KeyMatch)
+	require.True(t, report.Verified)
+	require.Len(t, report.Errors, 1)
+
+	// certificate not signed by the configured CA
+	config.Key = filepath.Join(dir, "client.key")
+	config.CA = newTestCert(t, "other CA", nil, now.AddDate(1, 0, 0)).writeCert(t, filepath.Join(dir, "other_ca.pem"))
+	report = CheckCertificates(&config, now)
+	require.True(t, report.KeyMatch)
+	require.False(t, report.Verified)
+	require.Contains(t, report.Errors[0], "verification failed")
+
+	// missing files
+	report = CheckCertificates(&Config{Cert: filepath.Join(dir, "missing.pem"), CA: filepath.Join(dir, "missing_ca.pem")}, now)
+	require.Nil(t, report.Cert)
+	require.Len(t, report.Errors, 2)
+}
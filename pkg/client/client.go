@@ -0,0 +1,268 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+// Package client implements a client for the filterctld and rescand APIs.
+// Requests are authenticated with a TLS client certificate and an optional
+// API key.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type Config struct {
+	URL     string
+	Cert    string
+	Key     string
+	CA      string
+	APIKey  string
+	Verbose bool
+	Retry   RetryPolicy
+	Breaker *Breaker
+}
+
+const UNIX_SCHEME = "unix://"
+
+// requests sent over a unix socket use this URL for the host header
+const UNIX_BASE_URL = "http://localhost"
+
+// Client sends requests to a filterctld or rescand server.  User and
+// Request are copied into each response.  If Breaker is set, requests fail
+// with ErrUnavailable while the server is known to be down.
+type Client struct {
+	Client  *http.Client
+	URL     string
+	APIKey  string
+	User    string
+	Request string
+	Verbose bool
+	Retry   RetryPolicy
+	Breaker *Breaker
+}
+
+// New returns a client for config.URL.  A URL of the form
+// unix:///path/to.sock connects to a local server socket without TLS;
+// other URLs use the client certificate for https.
+func New(config *Config) (*Client, error) {
+	c := Client{
+		URL:     config.URL,
+		APIKey:  config.APIKey,
+		Verbose: config.Verbose,
+		Retry:   config.Retry,
+		Breaker: config.Breaker,
+	}
+	socketPath, ok := strings.CutPrefix(config.URL, UNIX_SCHEME)
+	if ok {
+		if !strings.HasPrefix(socketPath, "/") {
+			return nil, fmt.Errorf("unix socket URL requires an absolute path: %s", config.URL)
+		}
+		c.URL = UNIX_BASE_URL
+		c.Client = &http.Client{Transport: unixTransport(socketPath)}
+		return &c, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+	if err != nil {
+		return nil, fmt.Errorf("error loading client certificate pair: %v", err)
+	}
+
+	caCert, err := os.ReadFile(config.CA)
+	if err != nil {
+		return nil, fmt.Errorf("error loading certificate authority file: %v", err)
+	}
+
+	caCertPool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("error opening system cert pool: %v", err)
+	}
+	caCertPool.AppendCertsFromPEM(caCert)
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      caCertPool,
+	}
+	c.Client = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+	}
+	return &c, nil
+}
+
+// return a transport which connects every request to a unix socket
+func unixTransport(socketPath string) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+}
+
+// return a request path with each segment escaped
+func path(segments ...string) string {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = url.PathEscape(segment)
+	}
+	return "/" + strings.Join(escaped, "/") + "/"
+}
+
+// Envelope is implemented by every API response.  The client stamps each
+// decoded response with its User and Request values.
+type Envelope interface {
+	Stamp(user, request string)
+}
+
+func (c *Client) Get(ctx context.Context, path string, response Envelope) error {
+	return c.request(ctx, "GET", path, nil, response)
+}
+
+func (c *Client) Post(ctx context.Context, path string, request any, response Envelope) error {
+	return c.request(ctx, "POST", path, request, response)
+}
+
+func (c *Client) Put(ctx context.Context, path string, response Envelope) error {
+	return c.request(ctx, "PUT", path, nil, response)
+}
+
+func (c *Client) Delete(ctx context.Context, path string, response Envelope) error {
+	return c.request(ctx, "DELETE", path, nil, response)
+}
+
+// call sends a request and returns the decoded response of type T
+func call[T any, PT interface {
+	*T
+	Envelope
+}](ctx context.Context, c *Client, method, path string, request any) (*T, error) {
+	response := PT(new(T))
+	err := c.request(ctx, method, path, request, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *Client) request(ctx context.Context, method, path string, requestData any, responseData Envelope) error {
+	if c.Breaker != nil {
+		err := c.Breaker.Allow()
+		if errors.Is(err, ErrUnavailable) {
+			return fmt.Errorf("%s %s: %w", method, path, err)
+		}
+		if err != nil {
+			log.Printf("WARNING: %v\n", err)
+		}
+	}
+	var requestBytes []byte
+	if requestData != nil {
+		var err error
+		requestBytes, err = json.Marshal(requestData)
+		if err != nil {
+			return fmt.Errorf("failed marshalling JSON body for %s request: %v", method, err)
+		}
+		if c.Verbose {
+			log.Printf("request: %s\n", string(requestBytes))
+		}
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = c.send(ctx, method, path, requestBytes, responseData)
+		if err == nil || attempt >= c.Retry.Attempts || !retryable(method, err) {
+			break
+		}
+		delay := c.Retry.backoff(attempt - 1)
+		if c.Verbose {
+			log.Printf("retrying %s %s in %v: %v\n", method, path, delay, err)
+		}
+		if sleep(ctx, delay) != nil {
+			break
+		}
+	}
+	if c.Breaker != nil {
+		c.recordResult(err)
+	}
+	if unavailable(err) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
+// update the circuit breaker with the result of a request
+func (c *Client) recordResult(err error) {
+	var breakerErr error
+	switch {
+	case err == nil:
+		breakerErr = c.Breaker.Success()
+	case unavailable(err):
+		breakerErr = c.Breaker.Failure()
+	}
+	if breakerErr != nil {
+		log.Printf("WARNING: %v\n", breakerErr)
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, requestBytes []byte, responseData Envelope) error {
+	if c.Verbose {
+		log.Printf("<-- %s %s", method, c.URL+path)
+	}
+	var requestBuffer io.Reader
+	if requestBytes != nil {
+		requestBuffer = bytes.NewReader(requestBytes)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, c.URL+path, requestBuffer)
+	if err != nil {
+		return fmt.Errorf("failed creating %s request: %v", method, err)
+	}
+	request.Header.Add("X-Api-Key", c.APIKey)
+	response, err := c.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("failure reading response body: %w", err)
+	}
+	if c.Verbose {
+		log.Printf("--> [%d] %v\n", response.StatusCode, string(body))
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return newAPIError(method, path, response.StatusCode, body)
+	}
+	err = json.Unmarshal(body, responseData)
+	if err != nil {
+		return fmt.Errorf("failed decoding JSON response: %v", err)
+	}
+	responseData.Stamp(c.User, c.Request)
+	return nil
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.RequestURI)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(r.URL.Path, "/filterctl/books/") {
+			json.NewEncoder(w).Encode(map[string]any{"success": true, "books": []map[string]any{{"bookname": "my friends"}}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"Success": true, "Message": "ok", "Books": []string{"my friends"}})
+	}))
+	defer server.Close()
+	c := Client{Client: server.Client(), URL: server.URL, User: "user@example.com", Request: "test"}
+	ctx := context.Background()
+
+	response, err := c.Scan(ctx, "user@example.com", "a/b@example.com")
+	require.Nil(t, err)
+	require.Equal(t, []string{"my friends"}, response.Books)
+	require.Equal(t, "user@example.com", response.User)
+	require.Equal(t, "test", response.Request)
+
+	_, err = c.DeleteAddress(ctx, "user@example.com", "my friends", "x?y@example.com")
+	require.Nil(t, err)
+	_, err = c.SetClass(ctx, "user@example.com", "ham", 2.5)
+	require.Nil(t, err)
+	_, err = c.RescanStatus(ctx, "")
+	require.Nil(t, err)
+
+	// any type embedding Response may be decoded without client changes
+	var class ClassResponse
+	err = c.Get(ctx, "/filterctl/class/user@example.com/3/", &class)
+	require.Nil(t, err)
+	require.True(t, class.Success)
+	require.Equal(t, "user@example.com", class.User)
+
+	books, err := c.Books(ctx, "user@example.com")
+	require.Nil(t, err)
+	require.Equal(t, "test", books.Request)
+	require.Equal(t, "my friends", books.Books[0].BookName)
+
+	require.Equal(t, []string{
+		"GET /filterctl/scan/user@example.com/a%2Fb@example.com/",
+		"DELETE /filterctl/address/user@example.com/my%20friends/x%3Fy@example.com/",
+		"PUT /filterctl/classes/user@example.com/ham/2.5/",
+		"GET /rescan/",
+		"GET /filterctl/class/user@example.com/3/",
+		"GET /filterctl/books/user@example.com/",
+	}, requests)
+}
+
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/filterctl/classes/nobody@example.com/":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"Success": false, "Message": "unknown user"}`))
+		case "/filterctl/classes/forbidden@example.com/":
+			w.WriteHeader(http.StatusForbidden)
+		case "/filterctl/classes/busy@example.com/":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("overloaded\n"))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	c := Client{Client: server.Client(), URL: server.URL}
+	ctx := context.Background()
+
+	_, err := c.Classes(ctx, "nobody@example.com")
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	require.True(t, errors.Is(err, ErrNotFound))
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	require.Equal(t, "GET", apiErr.Method)
+	require.Equal(t, "/filterctl/classes/nobody@example.com/", apiErr.Path)
+	require.Equal(t, "unknown user", apiErr.Message)
+	require.False(t, apiErr.Retryable)
+
+	_, err = c.Classes(ctx, "forbidden@example.com")
+	require.True(t, errors.Is(err, ErrUnauthorized))
+	require.ErrorContains(t, err, "Forbidden")
+
+	_, err = c.Classes(ctx, "busy@example.com")
+	require.True(t, errors.As(err, &apiErr))
+	require.True(t, errors.Is(err, ErrServer))
+	require.True(t, apiErr.Retryable)
+	require.Equal(t, "overloaded", apiErr.Message)
+
+	_, err = c.DeleteClasses(ctx, "user@example.com")
+	require.True(t, errors.As(err, &apiErr))
+	require.True(t, errors.Is(err, ErrServer))
+	require.False(t, apiErr.Retryable)
+}
+
+func TestRetry(t *testing.T) {
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		if count < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"Success": true}`))
+	}))
+	defer server.Close()
+	c := Client{Client: server.Client(), URL: server.URL, Retry: RetryPolicy{Attempts: 3, Delay: time.Millisecond}}
+	ctx := context.Background()
+
+	response, err := c.Classes(ctx, "user@example.com")
+	require.Nil(t, err)
+	require.True(t, response.Success)
+	require.Equal(t, 3, count)
+
+	// POST is not repeated after reaching the server
+	count = 0
+	_, err = c.ResetClasses(ctx, "user@example.com", nil)
+	require.True(t, errors.Is(err, ErrUnavailable))
+	require.True(t, errors.Is(err, ErrServer))
+	require.Equal(t, 1, count)
+}
+
+func TestBreaker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Success": true}`))
+	}))
+	url := server.URL
+	server.Close()
+	breaker := Breaker{Filename: filepath.Join(t.TempDir(), "breaker.json"), Threshold: 2, Cooldown: time.Hour}
+	c := Client{Client: http.DefaultClient, URL: url, Breaker: &breaker, Retry: RetryPolicy{Attempts: 2, Delay: time.Millisecond}}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := c.Classes(ctx, "user@example.com")
+		require.True(t, errors.Is(err, ErrUnavailable))
+		require.ErrorContains(t, err, "request failed")
+	}
+	_, err := c.Classes(ctx, "user@example.com")
+	require.True(t, errors.Is(err, ErrUnavailable))
+	require.ErrorContains(t, err, "circuit open")
+
+	require.Nil(t, breaker.Success())
+	require.Nil(t, breaker.Allow())
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var ErrUnauthorized = errors.New("unauthorized")
+var ErrNotFound = errors.New("not found")
+var ErrServer = errors.New("server error")
+var ErrRequest = errors.New("request rejected")
+
+const MAX_ERROR_MESSAGE = 256
+
+// APIError is returned when the server responds with a non-2xx status.
+// errors.Is matches ErrUnauthorized for 401 and 403, ErrNotFound for 404,
+// ErrServer for 5xx and ErrRequest for other statuses.
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	Message    string
+	Retryable  bool
+}
+
+func newAPIError(method, path string, statusCode int, body []byte) *APIError {
+	e := APIError{
+		StatusCode: statusCode,
+		Method:     method,
+		Path:       path,
+		Message:    serverMessage(body),
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(statusCode)
+	}
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		e.Retryable = true
+	}
+	return &e
+}
+
+// return the message from an error response body
+func serverMessage(body []byte) string {
+	var response struct {
+		Message string
+	}
+	err := json.Unmarshal(body, &response)
+	if err == nil && response.Message != "" {
+		return response.Message
+	}
+	message := strings.TrimSpace(string(body))
+	if len(message) > MAX_ERROR_MESSAGE {
+		message = message[:MAX_ERROR_MESSAGE] + "..."
+	}
+	return message
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: API returned status [%d] %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode >= 500:
+		return ErrServer
+	}
+	return ErrRequest
+}
@@ -0,0 +1,124 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/rstms/mabctl/api"
+	"github.com/rstms/rspamd-classes/classes"
+)
+
+// Classes returns the user's spam class table
+func (c *Client) Classes(ctx context.Context, user string) (*ClassesResponse, error) {
+	return call[ClassesResponse](ctx, c, "GET", path("filterctl", "classes", user), nil)
+}
+
+// SetClass sets the threshold of a class, adding the class if necessary
+func (c *Client) SetClass(ctx context.Context, user, class string, threshold float32) (*Response, error) {
+	score := strconv.FormatFloat(float64(threshold), 'f', -1, 32)
+	return call[Response](ctx, c, "PUT", path("filterctl", "classes", user, class, score), nil)
+}
+
+// DeleteClass removes a class from the user's class table
+func (c *Client) DeleteClass(ctx context.Context, user, class string) (*Response, error) {
+	return call[Response](ctx, c, "DELETE", path("filterctl", "classes", user, class), nil)
+}
+
+// DeleteClasses removes the user's class table, restoring the defaults
+func (c *Client) DeleteClasses(ctx context.Context, user string) (*Response, error) {
+	return call[Response](ctx, c, "DELETE", path("filterctl", "classes", user), nil)
+}
+
+// ResetClasses replaces the user's class table.  An empty table restores
+// the default classes.
+func (c *Client) ResetClasses(ctx context.Context, user string, table []classes.SpamClass) (*ClassesResponse, error) {
+	request := ClassesRequest{Address: user, Classes: table}
+	return call[ClassesResponse](ctx, c, "POST", path("filterctl", "classes"), &request)
+}
+
+// Classify returns the user's class name for a spam score
+func (c *Client) Classify(ctx context.Context, user string, score float32) (*Response, error) {
+	value := strconv.FormatFloat(float64(score), 'f', -1, 32)
+	return call[Response](ctx, c, "GET", path("filterctl", "class", user, value), nil)
+}
+
+// Books returns the user's address book names
+func (c *Client) Books(ctx context.Context, user string) (*BooksResponse, error) {
+	return call[BooksResponse](ctx, c, "GET", path("filterctl", "books", user), nil)
+}
+
+// AddBook creates an address book
+func (c *Client) AddBook(ctx context.Context, user, book, description string) (*Response, error) {
+	request := BookRequest{Username: user, Bookname: book, Description: description}
+	return call[Response](ctx, c, "POST", path("filterctl", "book"), &request)
+}
+
+// DeleteBook deletes an address book and all of its addresses
+func (c *Client) DeleteBook(ctx context.Context, user, book string) (*Response, error) {
+	return call[Response](ctx, c, "DELETE", path("filterctl", "book", user, book), nil)
+}
+
+// Addresses returns the addresses in one of the user's address books
+func (c *Client) Addresses(ctx context.Context, user, book string) (*AddressesResponse, error) {
+	return call[AddressesResponse](ctx, c, "GET", path("filterctl", "addresses", user, book), nil)
+}
+
+// AddAddress adds an address to an address book.  The server reports an
+// unknown user or book in the response message.
+func (c *Client) AddAddress(ctx context.Context, user, book, address, name string) (*Response, error) {
+	request := AddressRequest{Username: user, Bookname: book, Address: address, Name: name}
+	return call[Response](ctx, c, "POST", path("filterctl", "address"), &request)
+}
+
+// DeleteAddress removes an address from an address book
+func (c *Client) DeleteAddress(ctx context.Context, user, book, address string) (*Response, error) {
+	return call[Response](ctx, c, "DELETE", path("filterctl", "address", user, book, address), nil)
+}
+
+// AddUser creates a CardDAV user account
+func (c *Client) AddUser(ctx context.Context, user, email, password string) (*Response, error) {
+	request := UserRequest{Username: user, Email: email, Password: password}
+	return call[Response](ctx, c, "POST", path("filterctl", "user"), &request)
+}
+
+// Scan returns the names of the user's address books containing address
+func (c *Client) Scan(ctx context.Context, user, address string) (*ScanResponse, error) {
+	return call[ScanResponse](ctx, c, "GET", path("filterctl", "scan", user, address), nil)
+}
+
+// Password returns the user's CardDAV password
+func (c *Client) Password(ctx context.Context, user string) (*PasswordResponse, error) {
+	return call[PasswordResponse](ctx, c, "GET", path("filterctl", "passwd", user), nil)
+}
+
+// Dump returns the user's classes, address books and password
+func (c *Client) Dump(ctx context.Context, user string) (*DumpResponse, error) {
+	return call[DumpResponse](ctx, c, "GET", path("filterctl", "dump", user), nil)
+}
+
+// Restore adds the address books and addresses from a configuration dump
+func (c *Client) Restore(ctx context.Context, user string, dump api.ConfigDump) (*Response, error) {
+	request := RestoreRequest{Username: user, Dump: dump}
+	return call[Response](ctx, c, "POST", path("filterctl", "restore"), &request)
+}
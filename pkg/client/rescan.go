@@ -0,0 +1,42 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"context"
+)
+
+// Rescan submits a request to reclassify messages in one of the user's
+// mail folders.  The client URL must address rescand.
+func (c *Client) Rescan(ctx context.Context, request RescanRequest) (*RescanResponse, error) {
+	return call[RescanResponse](ctx, c, "POST", path("rescan"), &request)
+}
+
+// RescanStatus returns the status of a rescan request, or of all requests
+// if id is empty.  The client URL must address rescand.
+func (c *Client) RescanStatus(ctx context.Context, id string) (*RescanResponse, error) {
+	requestPath := path("rescan")
+	if id != "" {
+		requestPath = path("rescan", id)
+	}
+	return call[RescanResponse](ctx, c, "GET", requestPath, nil)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package client
+
+import (
+	"github.com/rstms/mabctl/api"
+	"github.com/rstms/rspamd-classes/classes"
+)
+
+type Response struct {
+	User    string
+	Request string
+	Message string
+	Success bool
+}
+
+func (r *Response) Stamp(user, request string) {
+	r.User = user
+	r.Request = request
+}
+
+type ClassesResponse struct {
+	Response
+	Classes []classes.SpamClass
+}
+
+type ClassResponse struct {
+	Response
+	Class string
+}
+
+// BooksResponse is the address book list returned by mabctl
+type BooksResponse api.BooksResponse
+
+func (r *BooksResponse) Stamp(user, request string) {
+	r.User = user
+	r.Request = request
+}
+
+type ScanResponse struct {
+	Response
+	Books []string
+}
+
+type AddressesResponse struct {
+	Response
+	Addresses []any
+}
+
+type PasswordResponse struct {
+	Response
+	Password string
+}
+
+type DumpResponse struct {
+	Response
+	Classes  []classes.SpamClass
+	Books    map[string]any
+	Password string
+}
+
+type ClassesRequest struct {
+	Address string
+	Classes []classes.SpamClass
+}
+
+type UserRequest struct {
+	Username string
+	Email    string
+	Password string
+}
+
+type BookRequest struct {
+	Username    string
+	Bookname    string
+	Description string
+}
+
+type AddressRequest struct {
+	Username string
+	Bookname string
+	Address  string
+	Name     string
+}
+
+type RestoreRequest struct {
+	Username string
+	Dump     api.ConfigDump
+}
+
+type RescanRequest struct {
+	Username   string
+	Folder     string
+	MessageIds []string
+}
+
+type RescanResult struct {
+	Pathname string
+	Message  string
+	Headers  map[string]string
+}
+
+type RescanStatus struct {
+	Id           string
+	Running      bool
+	Total        int
+	Completed    int
+	SuccessCount int
+	FailCount    int
+	LatestFile   string
+	Request      RescanRequest
+	Errors       []RescanResult
+	Actions      []RescanResult
+}
+
+type RescanResponse struct {
+	Response
+	Status map[string]RescanStatus
+}
@@ -0,0 +1,81 @@
+//go:build linux
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type peerCredKey struct{}
+
+// start a local stand-in server which accepts requests only from
+// connections whose peer credentials match uid
+func startPeerCredServer(t *testing.T, socketPath string, uid uint32) {
+	listener, err := net.Listen("unix", socketPath)
+	require.Nil(t, err)
+	server := &http.Server{
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			raw, err := conn.(*net.UnixConn).SyscallConn()
+			if err != nil {
+				return ctx
+			}
+			var cred *syscall.Ucred
+			raw.Control(func(fd uintptr) {
+				cred, _ = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+			})
+			return context.WithValue(ctx, peerCredKey{}, cred)
+		},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cred, ok := r.Context().Value(peerCredKey{}).(*syscall.Ucred)
+			if !ok || cred == nil || cred.Uid != uid {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"Success": false, "Message": "peer not authorized"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"Success": true, "Message": fmt.Sprintf("uid=%d", cred.Uid)})
+		}),
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	uid := uint32(os.Getuid())
+	ctx := context.Background()
+
+	allowed := filepath.Join(dir, "allowed.sock")
+	startPeerCredServer(t, allowed, uid)
+	c, err := New(&Config{URL: "unix://" + allowed})
+	require.Nil(t, err)
+	response, err := c.Classes(ctx, "user@example.com")
+	require.Nil(t, err)
+	require.Equal(t, fmt.Sprintf("uid=%d", uid), response.Message)
+
+	denied := filepath.Join(dir, "denied.sock")
+	startPeerCredServer(t, denied, uid+1)
+	c, err = New(&Config{URL: "unix://" + denied})
+	require.Nil(t, err)
+	_, err = c.Classes(ctx, "user@example.com")
+	require.True(t, errors.Is(err, ErrUnauthorized))
+	require.ErrorContains(t, err, "peer not authorized")
+
+	c, err = New(&Config{URL: "unix://" + filepath.Join(dir, "missing.sock"), Retry: RetryPolicy{Attempts: 2}})
+	require.Nil(t, err)
+	_, err = c.Classes(ctx, "user@example.com")
+	require.True(t, errors.Is(err, ErrUnavailable))
+
+	_, err = New(&Config{URL: "unix://relative.sock"})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,409 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package fakeserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rstms/filterctl/pkg/client"
+	"github.com/rstms/mabctl/api"
+	"github.com/rstms/rspamd-classes/classes"
+)
+
+type book struct {
+	Description string
+	Addresses   []string
+}
+
+type account struct {
+	Password string
+	Books    map[string]*book
+}
+
+// Filterctld is an in-memory implementation of the filterctld API.  Users
+// must be created with AddUser, Seed, or a restore request before address
+// books are added.
+type Filterctld struct {
+	APIKey   string
+	mutex    sync.Mutex
+	classes  *classes.SpamClasses
+	accounts map[string]*account
+	rejected map[string]bool
+}
+
+func NewFilterctld() *Filterctld {
+	spamClasses, _ := classes.New("")
+	// the library shares its DefaultClasses slice as the default table
+	spamClasses.SetClasses(classes.DEFAULT_NAME, classes.DefaultClasses)
+	return &Filterctld{
+		classes:  spamClasses,
+		accounts: make(map[string]*account),
+		rejected: make(map[string]bool),
+	}
+}
+
+// return the request path segments following prefix
+func pathSegments(r *http.Request, prefix string) ([]string, bool) {
+	escaped, ok := strings.CutPrefix(r.URL.EscapedPath(), prefix)
+	if !ok {
+		return nil, false
+	}
+	escaped = strings.Trim(escaped, "/")
+	if escaped == "" {
+		return []string{}, true
+	}
+	segments := strings.Split(escaped, "/")
+	for i, segment := range segments {
+		value, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, false
+		}
+		segments[i] = value
+	}
+	return segments, true
+}
+
+func reply(w http.ResponseWriter, status int, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func fail(w http.ResponseWriter, status int, format string, args ...any) {
+	reply(w, status, &client.Response{Success: false, Message: fmt.Sprintf(format, args...)})
+}
+
+func ok(format string, args ...any) client.Response {
+	return client.Response{Success: true, Message: fmt.Sprintf(format, args...)}
+}
+
+func decode(w http.ResponseWriter, r *http.Request, request any) bool {
+	err := json.NewDecoder(r.Body).Decode(request)
+	if err != nil {
+		fail(w, http.StatusBadRequest, "failed decoding request: %v", err)
+		return false
+	}
+	return true
+}
+
+func newPassword() string {
+	data := make([]byte, 12)
+	rand.Read(data)
+	return hex.EncodeToString(data)
+}
+
+// AddUser creates a user account, generating a password if none is given
+func (f *Filterctld) AddUser(user, password string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.addUser(user, password)
+}
+
+func (f *Filterctld) addUser(user, password string) *account {
+	if password == "" {
+		password = newPassword()
+	}
+	a, exists := f.accounts[user]
+	if !exists {
+		a = &account{Books: make(map[string]*book)}
+		f.accounts[user] = a
+	}
+	a.Password = password
+	return a
+}
+
+// RejectAddress makes requests adding address to a book fail, for testing
+// commands which stop partway
+func (f *Filterctld) RejectAddress(address string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.rejected[address] = true
+}
+
+// Seed creates a user account with the address books in dump
+func (f *Filterctld) Seed(user string, dump api.UserDump) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.restore(user, dump)
+}
+
+func (f *Filterctld) restore(user string, dump api.UserDump) {
+	a, exists := f.accounts[user]
+	if !exists || dump.Password != "" {
+		a = f.addUser(user, dump.Password)
+	}
+	for name, addresses := range dump.Books {
+		b, exists := a.Books[name]
+		if !exists {
+			b = &book{Description: name}
+			a.Books[name] = b
+		}
+		for _, address := range addresses {
+			if !slices.Contains(b.Addresses, address) {
+				b.Addresses = append(b.Addresses, address)
+			}
+		}
+	}
+}
+
+// Books returns a copy of the user's address books
+func (f *Filterctld) Books(user string) map[string][]string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.dumpBooks(user)
+}
+
+func (f *Filterctld) dumpBooks(user string) map[string][]string {
+	books := make(map[string][]string)
+	a, exists := f.accounts[user]
+	if !exists {
+		return books
+	}
+	for name, b := range a.Books {
+		books[name] = slices.Clone(b.Addresses)
+	}
+	return books
+}
+
+// Classes returns the user's spam class table
+func (f *Filterctld) Classes(user string) []classes.SpamClass {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return slices.Clone(f.classes.GetClasses(user))
+}
+
+// return the user's address book, writing an error response if it does
+// not exist
+func (f *Filterctld) book(w http.ResponseWriter, operation, user, name string) (*book, bool) {
+	a, exists := f.accounts[user]
+	if !exists {
+		fail(w, http.StatusNotFound, "%s failed: Unknown user: %s", operation, user)
+		return nil, false
+	}
+	b, exists := a.Books[name]
+	if !exists {
+		fail(w, http.StatusNotFound, "QueryAddressBook failed: 404 Not Found")
+		return nil, false
+	}
+	return b, true
+}
+
+func (f *Filterctld) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.APIKey != "" && r.Header.Get("X-Api-Key") != f.APIKey {
+		fail(w, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+	p, found := pathSegments(r, "/filterctl/")
+	if !found || len(p) == 0 {
+		fail(w, http.StatusNotFound, "not found: %s", r.URL.Path)
+		return
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	endpoint := r.Method + " " + p[0]
+	args := p[1:]
+	switch {
+	case endpoint == "GET classes" && len(args) == 1:
+		reply(w, http.StatusOK, &client.ClassesResponse{Response: ok("%s classes", args[0]), Classes: f.classes.GetClasses(args[0])})
+	case endpoint == "PUT classes" && len(args) == 3:
+		score, err := strconv.ParseFloat(args[2], 32)
+		if err != nil {
+			fail(w, http.StatusBadRequest, "invalid threshold: %s", args[2])
+			return
+		}
+		f.classes.SetThreshold(args[0], args[1], float32(score))
+		reply(w, http.StatusOK, ok("%s set %s=%s", args[0], args[1], args[2]))
+	case endpoint == "DELETE classes" && len(args) == 2:
+		f.classes.DeleteClass(args[0], args[1])
+		reply(w, http.StatusOK, ok("%s deleted class %s", args[0], args[1]))
+	case endpoint == "DELETE classes" && len(args) == 1:
+		f.classes.DeleteClasses(args[0])
+		reply(w, http.StatusOK, ok("%s deleted all classes", args[0]))
+	case endpoint == "POST classes" && len(args) == 0:
+		var request client.ClassesRequest
+		if !decode(w, r, &request) {
+			return
+		}
+		if len(request.Classes) == 0 {
+			f.classes.DeleteClasses(request.Address)
+		} else {
+			f.classes.SetClasses(request.Address, request.Classes)
+		}
+		reply(w, http.StatusOK, &client.ClassesResponse{Response: ok("%s reset classes", request.Address), Classes: f.classes.GetClasses(request.Address)})
+	case endpoint == "GET class" && len(args) == 2:
+		score, err := strconv.ParseFloat(args[1], 32)
+		if err != nil {
+			fail(w, http.StatusBadRequest, "invalid score: %s", args[1])
+			return
+		}
+		class := f.classes.GetClass([]string{args[0]}, float32(score))
+		reply(w, http.StatusOK, &client.ClassResponse{Response: ok("%s", class), Class: class})
+	case endpoint == "GET books" && len(args) == 1:
+		f.getBooks(w, args[0])
+	case endpoint == "POST book" && len(args) == 0:
+		var request client.BookRequest
+		if !decode(w, r, &request) {
+			return
+		}
+		a, exists := f.accounts[request.Username]
+		if !exists {
+			fail(w, http.StatusNotFound, "AddAddressBook failed: Unknown user: %s", request.Username)
+			return
+		}
+		if _, exists := a.Books[request.Bookname]; exists {
+			fail(w, http.StatusConflict, "AddAddressBook failed: book exists: %s", request.Bookname)
+			return
+		}
+		a.Books[request.Bookname] = &book{Description: request.Description}
+		reply(w, http.StatusOK, ok("added address book %s", request.Bookname))
+	case endpoint == "DELETE book" && len(args) == 2:
+		if _, found := f.book(w, "DeleteAddressBook", args[0], args[1]); !found {
+			return
+		}
+		delete(f.accounts[args[0]].Books, args[1])
+		reply(w, http.StatusOK, ok("deleted address book %s", args[1]))
+	case endpoint == "GET addresses" && len(args) == 2:
+		b, found := f.book(w, "Addresses", args[0], args[1])
+		if !found {
+			return
+		}
+		addresses := []any{}
+		for _, address := range b.Addresses {
+			addresses = append(addresses, address)
+		}
+		reply(w, http.StatusOK, &client.AddressesResponse{Response: ok("%s %s addresses", args[0], args[1]), Addresses: addresses})
+	case endpoint == "POST address" && len(args) == 0:
+		var request client.AddressRequest
+		if !decode(w, r, &request) {
+			return
+		}
+		b, found := f.book(w, "AddAddress", request.Username, request.Bookname)
+		if !found {
+			return
+		}
+		if f.rejected[request.Address] {
+			fail(w, http.StatusBadRequest, "AddAddress failed: address rejected: %s", request.Address)
+			return
+		}
+		if !slices.Contains(b.Addresses, request.Address) {
+			b.Addresses = append(b.Addresses, request.Address)
+		}
+		reply(w, http.StatusOK, ok("added %s to %s", request.Address, request.Bookname))
+	case endpoint == "DELETE address" && len(args) == 3:
+		b, found := f.book(w, "DeleteAddress", args[0], args[1])
+		if !found {
+			return
+		}
+		index := slices.Index(b.Addresses, args[2])
+		if index < 0 {
+			fail(w, http.StatusNotFound, "DeleteAddress failed: address not found: %s", args[2])
+			return
+		}
+		b.Addresses = slices.Delete(b.Addresses, index, index+1)
+		reply(w, http.StatusOK, ok("deleted %s from %s", args[2], args[1]))
+	case endpoint == "POST user" && len(args) == 0:
+		var request client.UserRequest
+		if !decode(w, r, &request) {
+			return
+		}
+		f.addUser(request.Username, request.Password)
+		reply(w, http.StatusOK, ok("added user %s", request.Username))
+	case endpoint == "GET scan" && len(args) == 2:
+		names := []string{}
+		if a, exists := f.accounts[args[0]]; exists {
+			for name, b := range a.Books {
+				if slices.Contains(b.Addresses, args[1]) {
+					names = append(names, name)
+				}
+			}
+		}
+		sort.Strings(names)
+		reply(w, http.StatusOK, &client.ScanResponse{Response: ok("%s scan %s", args[0], args[1]), Books: names})
+	case endpoint == "GET passwd" && len(args) == 1:
+		a, exists := f.accounts[args[0]]
+		if !exists {
+			fail(w, http.StatusNotFound, "Unknown user: %s", args[0])
+			return
+		}
+		reply(w, http.StatusOK, &client.PasswordResponse{Response: ok("%s password", args[0]), Password: a.Password})
+	case endpoint == "GET dump" && len(args) == 1:
+		response := client.DumpResponse{
+			Response: ok("%s dump", args[0]),
+			Classes:  f.classes.GetClasses(args[0]),
+			Books:    make(map[string]any),
+		}
+		for name, addresses := range f.dumpBooks(args[0]) {
+			response.Books[name] = addresses
+		}
+		if a, exists := f.accounts[args[0]]; exists {
+			response.Password = a.Password
+		}
+		reply(w, http.StatusOK, &response)
+	case endpoint == "POST restore" && len(args) == 0:
+		var request client.RestoreRequest
+		if !decode(w, r, &request) {
+			return
+		}
+		dump, exists := request.Dump.Users[request.Username]
+		if !exists {
+			fail(w, http.StatusBadRequest, "Restore failed: no configuration for user: %s", request.Username)
+			return
+		}
+		f.restore(request.Username, dump)
+		reply(w, http.StatusOK, ok("restored %d address books for %s", len(dump.Books), request.Username))
+	default:
+		fail(w, http.StatusNotFound, "not found: %s %s", r.Method, r.URL.Path)
+	}
+}
+
+func (f *Filterctld) getBooks(w http.ResponseWriter, user string) {
+	var response client.BooksResponse
+	response.Success = true
+	response.Message = fmt.Sprintf("%s books", user)
+	response.Books = []api.Book{}
+	if a, exists := f.accounts[user]; exists {
+		names := []string{}
+		for name := range a.Books {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			response.Books = append(response.Books, api.Book{
+				UserName:    user,
+				BookName:    name,
+				Description: a.Books[name].Description,
+				Contacts:    len(a.Books[name].Addresses),
+			})
+		}
+	}
+	reply(w, http.StatusOK, &response)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package fakeserver
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/rstms/filterctl/pkg/client"
+)
+
+// Rescand is an in-memory implementation of the rescand API.  Each rescan
+// request completes immediately.
+type Rescand struct {
+	APIKey string
+	mutex  sync.Mutex
+	nextID int
+	status map[string]client.RescanStatus
+}
+
+func NewRescand() *Rescand {
+	return &Rescand{status: make(map[string]client.RescanStatus)}
+}
+
+func (s *Rescand) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.APIKey != "" && r.Header.Get("X-Api-Key") != s.APIKey {
+		fail(w, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+	p, found := pathSegments(r, "/rescan/")
+	if !found && r.URL.Path == "/rescan" {
+		p, found = []string{}, true
+	}
+	if !found {
+		fail(w, http.StatusNotFound, "not found: %s", r.URL.Path)
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch {
+	case r.Method == "POST" && len(p) == 0:
+		var request client.RescanRequest
+		if !decode(w, r, &request) {
+			return
+		}
+		if request.Username == "" || request.Folder == "" {
+			fail(w, http.StatusBadRequest, "rescan request requires Username and Folder")
+			return
+		}
+		s.nextID++
+		id := strconv.Itoa(s.nextID)
+		status := client.RescanStatus{
+			Id:           id,
+			Total:        len(request.MessageIds),
+			Completed:    len(request.MessageIds),
+			SuccessCount: len(request.MessageIds),
+			Request:      request,
+			Errors:       []client.RescanResult{},
+			Actions:      []client.RescanResult{},
+		}
+		for _, messageID := range request.MessageIds {
+			pathname := filepath.Join(request.Folder, messageID)
+			status.LatestFile = pathname
+			status.Actions = append(status.Actions, client.RescanResult{Pathname: pathname, Message: "rescanned"})
+		}
+		s.status[id] = status
+		reply(w, http.StatusOK, &client.RescanResponse{Response: ok("rescan %s started", id), Status: map[string]client.RescanStatus{id: status}})
+	case r.Method == "GET" && len(p) == 0:
+		response := client.RescanResponse{Response: ok("rescan status"), Status: make(map[string]client.RescanStatus)}
+		for id, status := range s.status {
+			response.Status[id] = status
+		}
+		reply(w, http.StatusOK, &response)
+	case r.Method == "GET" && len(p) == 1:
+		status, exists := s.status[p[0]]
+		if !exists {
+			fail(w, http.StatusNotFound, "unknown rescan id: %s", p[0])
+			return
+		}
+		reply(w, http.StatusOK, &client.RescanResponse{Response: ok("rescan status"), Status: map[string]client.RescanStatus{p[0]: status}})
+	default:
+		fail(w, http.StatusNotFound, "not found: %s %s", r.Method, r.URL.Path)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright © 2024 Matt Krueger <mkrueger@rstms.net>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+// Package fakeserver implements in-memory filterctld and rescand servers for
+// testing.  The servers listen on localhost with httptest and require a
+// client certificate issued by a generated test CA.
+package fakeserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/rstms/filterctl/pkg/client"
+)
+
+// Server runs a fake filterctld and a fake rescand
+type Server struct {
+	Certs      *Certs
+	Filterctld *Filterctld
+	Rescand    *Rescand
+	filterctld *httptest.Server
+	rescand    *httptest.Server
+}
+
+// Start generates a test PKI in dir and starts both servers
+func Start(dir string) (*Server, error) {
+	certs, err := NewCerts(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := Server{
+		Certs:      certs,
+		Filterctld: NewFilterctld(),
+		Rescand:    NewRescand(),
+	}
+	s.filterctld, err = NewTLSServer(s.Filterctld, certs)
+	if err != nil {
+		return nil, err
+	}
+	s.rescand, err = NewTLSServer(s.Rescand, certs)
+	if err != nil {
+		s.filterctld.Close()
+		return nil, err
+	}
+	return &s, nil
+}
+
+// NewTLSServer starts an httptest server for handler which requires a
+// client certificate issued by the test CA
+func NewTLSServer(handler http.Handler, certs *Certs) (*httptest.Server, error) {
+	cert, err := tls.LoadX509KeyPair(certs.ServerCert, certs.ServerKey)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := os.ReadFile(certs.CA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates found in %s", certs.CA)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	return server, nil
+}
+
+// FilterctldURL returns the base URL of the fake filterctld
+func (s *Server) FilterctldURL() string {
+	return s.filterctld.URL
+}
+
+// RescandURL returns the base URL of the fake rescand
+func (s *Server) RescandURL() string {
+	return s.rescand.URL
+}
+
+// Config returns a client configuration for url using the test client
+// certificate
+func (s *Server) Config(url string) *client.Config {
+	return &client.Config{
+		URL:  url,
+		Cert: s.Certs.ClientCert,
+		Key:  s.Certs.ClientKey,
+		CA:   s.Certs.CA,
+	}
+}
+
+func (s *Server) Close() {
+	s.filterctld.Close()
+	s.rescand.Close()
+}
@@ -0,0 +1,184 @@
+package fakeserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rstms/filterctl/pkg/client"
+	"github.com/rstms/mabctl/api"
+	"github.com/rstms/rspamd-classes/classes"
+	"github.com/stretchr/testify/require"
+)
+
+const user = "test@example.org"
+
+func startServer(t *testing.T) *Server {
+	server, err := Start(t.TempDir())
+	require.Nil(t, err)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClasses(t *testing.T) {
+	server := startServer(t)
+	c, err := client.New(server.Config(server.FilterctldURL()))
+	require.Nil(t, err)
+	ctx := context.Background()
+
+	response, err := c.Classes(ctx, user)
+	require.Nil(t, err)
+	require.Equal(t, classes.DefaultClasses, response.Classes)
+
+	_, err = c.SetClass(ctx, user, "maybe", 7.5)
+	require.Nil(t, err)
+	class, err := c.Classify(ctx, user, 6)
+	require.Nil(t, err)
+	require.Equal(t, "maybe", class.Message)
+
+	_, err = c.DeleteClass(ctx, user, "maybe")
+	require.Nil(t, err)
+	reset, err := c.ResetClasses(ctx, user, []classes.SpamClass{{Name: "clean", Score: 3}})
+	require.Nil(t, err)
+	require.Equal(t, []classes.SpamClass{{Name: "clean", Score: 3}, {Name: "spam", Score: 999}}, reset.Classes)
+
+	_, err = c.DeleteClasses(ctx, user)
+	require.Nil(t, err)
+	require.Equal(t, classes.DefaultClasses, server.Filterctld.Classes(user))
+}
+
+func TestBooks(t *testing.T) {
+	server := startServer(t)
+	c, err := client.New(server.Config(server.FilterctldURL()))
+	require.Nil(t, err)
+	ctx := context.Background()
+
+	_, err = c.AddBook(ctx, user, "friends", "")
+	require.ErrorContains(t, err, "Unknown user")
+	_, err = c.AddUser(ctx, user, user, "")
+	require.Nil(t, err)
+	_, err = c.AddAddress(ctx, user, "friends", "a@example.com", "")
+	require.ErrorContains(t, err, "QueryAddressBook failed: 404 Not Found")
+	_, err = c.AddBook(ctx, user, "friends", "")
+	require.Nil(t, err)
+	_, err = c.AddAddress(ctx, user, "friends", "a@example.com", "")
+	require.Nil(t, err)
+	_, err = c.AddAddress(ctx, user, "friends", "b+x@example.com", "")
+	require.Nil(t, err)
+
+	books, err := c.Books(ctx, user)
+	require.Nil(t, err)
+	require.Len(t, books.Books, 1)
+	require.Equal(t, "friends", books.Books[0].BookName)
+	require.Equal(t, 2, books.Books[0].Contacts)
+
+	addresses, err := c.Addresses(ctx, user, "friends")
+	require.Nil(t, err)
+	require.Equal(t, []any{"a@example.com", "b+x@example.com"}, addresses.Addresses)
+	_, err = c.Addresses(ctx, user, "fnord")
+	require.True(t, errors.Is(err, client.ErrNotFound))
+
+	scan, err := c.Scan(ctx, user, "b+x@example.com")
+	require.Nil(t, err)
+	require.Equal(t, []string{"friends"}, scan.Books)
+
+	_, err = c.DeleteAddress(ctx, user, "friends", "b+x@example.com")
+	require.Nil(t, err)
+	require.Equal(t, map[string][]string{"friends": {"a@example.com"}}, server.Filterctld.Books(user))
+
+	password, err := c.Password(ctx, user)
+	require.Nil(t, err)
+	require.Len(t, password.Password, 24)
+
+	dump, err := c.Dump(ctx, user)
+	require.Nil(t, err)
+	require.Equal(t, password.Password, dump.Password)
+	require.Equal(t, map[string]any{"friends": []any{"a@example.com"}}, dump.Books)
+
+	restore := api.ConfigDump{Users: map[string]api.UserDump{user: {Books: map[string][]string{"work": {"boss@example.com"}}}}}
+	_, err = c.Restore(ctx, user, restore)
+	require.Nil(t, err)
+	require.Equal(t, []string{"boss@example.com"}, server.Filterctld.Books(user)["work"])
+
+	_, err = c.DeleteBook(ctx, user, "friends")
+	require.Nil(t, err)
+	_, err = c.DeleteBook(ctx, user, "friends")
+	require.True(t, errors.Is(err, client.ErrNotFound))
+}
+
+func TestRescan(t *testing.T) {
+	server := startServer(t)
+	c, err := client.New(server.Config(server.RescandURL()))
+	require.Nil(t, err)
+	ctx := context.Background()
+
+	response, err := c.Rescan(ctx, client.RescanRequest{Username: user, Folder: "/INBOX", MessageIds: []string{"1", "2"}})
+	require.Nil(t, err)
+	require.Len(t, response.Status, 1)
+	for id, status := range response.Status {
+		require.Equal(t, 2, status.SuccessCount)
+		response, err = c.RescanStatus(ctx, id)
+		require.Nil(t, err)
+		require.Equal(t, 2, response.Status[id].Completed)
+	}
+	_, err = c.RescanStatus(ctx, "fnord")
+	require.True(t, errors.Is(err, client.ErrNotFound))
+	_, err = c.Rescan(ctx, client.RescanRequest{Username: user})
+	require.True(t, errors.Is(err, client.ErrRequest))
+}
+
+func TestClientCertificateRequired(t *testing.T) {
+	server := startServer(t)
+	config := server.Config(server.FilterctldURL())
+	config.Cert = server.Certs.ServerCert
+	config.Key = server.Certs.ServerKey
+	c, err := client.New(config)
+	require.Nil(t, err)
+	_, err = c.Classes(context.Background(), user)
+	require.NotNil(t, err)
+
+	server.Filterctld.APIKey = "secret"
+	config = server.Config(server.FilterctldURL())
+	config.APIKey = "wrong"
+	c, err = client.New(config)
+	require.Nil(t, err)
+	_, err = c.Classes(context.Background(), user)
+	var apiErr *client.APIError
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+}
+
+func TestCertificateMismatch(t *testing.T) {
+	server := startServer(t)
+	other, err := NewCerts(t.TempDir())
+	require.Nil(t, err)
+	breaker := client.Breaker{Filename: filepath.Join(t.TempDir(), "breaker.json"), Threshold: 1, Cooldown: time.Hour}
+
+	// server certificate issued by a CA the client does not trust
+	config := server.Config(server.FilterctldURL())
+	config.CA = other.CA
+	config.Breaker = &breaker
+	config.Retry = client.RetryPolicy{Attempts: 3, Delay: time.Millisecond}
+	c, err := client.New(config)
+	require.Nil(t, err)
+	_, err = c.Classes(context.Background(), user)
+	require.NotNil(t, err)
+	require.False(t, errors.Is(err, client.ErrUnavailable), err)
+
+	// client certificate issued by a CA the server does not trust
+	config = server.Config(server.FilterctldURL())
+	config.Cert = other.ClientCert
+	config.Key = other.ClientKey
+	config.Breaker = &breaker
+	c, err = client.New(config)
+	require.Nil(t, err)
+	_, err = c.Classes(context.Background(), user)
+	require.NotNil(t, err)
+	require.False(t, errors.Is(err, client.ErrUnavailable), err)
+
+	// neither failure opens the circuit
+	require.Nil(t, breaker.Allow())
+}